@@ -6,11 +6,11 @@ _dcx_completions() {
     _init_completion || return
 
     # Main commands
-    local commands="version update plugin config help"
+    local commands="version update plugin config env oracle tns help"
 
     # Subcommands
     local plugin_cmds="list install remove update info load help"
-    local config_cmds="get set show paths init edit help"
+    local config_cmds="get set unset list edit path show effective profile bundle paths init validate describe convert undo yaml-get yaml-set yaml-delete yaml-merge yaml-diff help"
 
     case "${prev}" in
         dcx)
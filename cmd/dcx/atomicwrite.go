@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Config files are rewritten atomically: the new contents go to a temp
+// file in the same directory, which is synced and renamed over the file,
+// so an interrupted write leaves either the old or the new file. Writers
+// hold an advisory lock for the whole read-modify-write, so concurrent
+// config_set calls don't lose updates. The lock files live in the runtime
+// directory (getRuntimeDir/locks), named after the target's absolute path,
+// rather than littering the target's directory; locks are thus per user.
+
+// maxBackups is how many .bak.N files --backup keeps per file
+const maxBackups = 10
+
+// backupWrites is --backup: keep the previous contents as <file>.bak.N
+var backupWrites bool
+
+// fileLock is an exclusive advisory lock on a config file
+type fileLock struct {
+	path string // the file being protected
+	f    *os.File
+}
+
+// lockFile waits for the lock of path. The lock is released by unlock or
+// when the process exits.
+func lockFile(path string) (*fileLock, error) {
+	path = lockedPath(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(getRuntimeDir(), "locks")
+	if err := securePrivateDir(dir); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(path))
+	name := fmt.Sprintf("%s-%x.lock", filepath.Base(path), sum[:8])
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockHandle(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("cannot lock %s: %w", path, err)
+	}
+	return &fileLock{path: path, f: f}, nil
+}
+
+// lockedPath is the file a lock on path protects: the symlink target, as
+// an absolute path. It names the lock file and is kept in fileLock.path.
+func lockedPath(path string) string {
+	path = resolveWritePath(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// holds reports whether l is the lock of path
+func (l *fileLock) holds(path string) bool {
+	return l != nil && l.path == lockedPath(path)
+}
+
+// unlock releases the lock
+func (l *fileLock) unlock() {
+	if l != nil {
+		unlockHandle(l.f)
+		l.f.Close()
+	}
+}
+
+// resolveWritePath follows a symlink so the rename replaces its target,
+// not the link
+func resolveWritePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// writeFileAtomic replaces path with data, keeping the file's mode (and
+// owner, where possible). With backup the old contents are kept first.
+func writeFileAtomic(path string, data []byte, backup bool) error {
+	return writeFileAtomicMode(path, data, backup, 0644)
+}
+
+// writeFileAtomicMode is writeFileAtomic with the mode of a new file
+func writeFileAtomicMode(path string, data []byte, backup bool, mode os.FileMode) error {
+	path = resolveWritePath(path)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		mode = info.Mode().Perm()
+		if backup {
+			if err := backupFile(path); err != nil {
+				return err
+			}
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return err
+	}
+	if info != nil {
+		keepOwner(tmp, info)
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	committed = true
+	syncDir(dir)
+	return nil
+}
+
+// backupFile copies path, with its mode, to the next <path>.bak.N and
+// drops the oldest backups beyond maxBackups
+func backupFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	backups := listBackups(path)
+	next := 1
+	if len(backups) > 0 {
+		next = backups[len(backups)-1] + 1
+	}
+	if err := writeFileAtomicMode(backupName(path, next), data, false, info.Mode().Perm()); err != nil {
+		return err
+	}
+	backups = append(backups, next)
+	for _, n := range backups[:max(0, len(backups)-maxBackups)] {
+		os.Remove(backupName(path, n))
+	}
+	return nil
+}
+
+// listBackups returns the N of every <path>.bak.N, oldest first
+func listBackups(path string) []int {
+	matches, _ := filepath.Glob(path + ".bak.*")
+	var numbers []int
+	for _, match := range matches {
+		if n, err := strconv.Atoi(strings.TrimPrefix(match, path+".bak.")); err == nil && n > 0 {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+func backupName(path string, n int) string {
+	return fmt.Sprintf("%s.bak.%d", path, n)
+}
+
+// configUndo restores the newest backup of a file and removes it, so
+// repeated undos walk back through the history
+func configUndo(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx config undo <file>")
+		os.Exit(1)
+	}
+
+	lock, err := lockFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer lock.unlock()
+
+	path := lock.path
+	backups := listBackups(path)
+	if len(backups) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no backup of %s found (write with --backup to keep one)\n", path)
+		os.Exit(1)
+	}
+	backup := backupName(path, backups[len(backups)-1])
+	data, err := os.ReadFile(backup)
+	if err == nil {
+		err = writeFileAtomic(path, data, false)
+	}
+	if err == nil {
+		err = os.Remove(backup)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Restored %s from %s\n", path, backup)
+}
@@ -28,7 +28,7 @@ func isOracleBinary(name string) bool {
 
 // findBinary locates a binary using the following search order:
 // For Oracle tools (sqlplus, rman, expdp, impdp, etc.):
-//  1. ORACLE_HOME/bin
+//  1. ORACLE_HOME/bin (or the oratab home of ORACLE_SID)
 //  2. DCX_HOME/bin (bundled)
 //  3. System PATH
 //
@@ -39,13 +39,27 @@ func isOracleBinary(name string) bool {
 //
 // Returns the full path to the binary or an error if not found
 func findBinary(name string) (string, error) {
-	// For Oracle binaries, check ORACLE_HOME/bin first
+	return findBinaryForSID(name, "")
+}
+
+// findBinaryForSID is findBinary with an explicit SID: when sid is set,
+// Oracle tools are looked up only in the home registered for it in oratab
+// instead of ORACLE_HOME, never in another home, DCX_HOME/bin or PATH
+func findBinaryForSID(name, sid string) (string, error) {
+	// For Oracle binaries, check the Oracle home first
 	if isOracleBinary(name) {
-		if oracleHome := os.Getenv("ORACLE_HOME"); oracleHome != "" {
+		oracleHome, err := resolveOracleHome(sid)
+		if err != nil {
+			return "", err
+		}
+		if oracleHome != "" {
 			oracleBin := filepath.Join(oracleHome, "bin", name)
 			if isExecutable(oracleBin) {
 				return oracleBin, nil
 			}
+			if sid != "" {
+				return "", fmt.Errorf("%s not found in %s", name, filepath.Join(oracleHome, "bin"))
+			}
 		}
 	}
 
@@ -72,6 +86,24 @@ func findBinary(name string) (string, error) {
 	return "", fmt.Errorf("binary not found: %s", name)
 }
 
+// resolveOracleHome picks the Oracle home used for Oracle binaries
+// Priority: oratab entry for sid > ORACLE_HOME > oratab entry for ORACLE_SID.
+// Only an explicit sid that cannot be resolved is an error; otherwise no
+// home is "".
+func resolveOracleHome(sid string) (string, error) {
+	if sid != "" {
+		return findOracleHome(sid, oracleOptions{})
+	}
+	if oracleHome := os.Getenv("ORACLE_HOME"); oracleHome != "" {
+		return oracleHome, nil
+	}
+	if envSID := os.Getenv("ORACLE_SID"); envSID != "" {
+		home, _ := findOracleHome(envSID, oracleOptions{})
+		return home, nil
+	}
+	return "", nil
+}
+
 // isExecutable checks if a file exists and is executable
 func isExecutable(path string) bool {
 	info, err := os.Stat(path)
@@ -92,10 +124,14 @@ func handleBinary(args []string) {
 	switch args[0] {
 	case "find":
 		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "Usage: dcx binary find <name>")
+			fmt.Fprintln(os.Stderr, "Usage: dcx binary find <name> [--sid <SID>]")
 			os.Exit(1)
 		}
-		path, err := findBinary(args[1])
+		sid := ""
+		if len(args) >= 4 && args[2] == "--sid" {
+			sid = args[3]
+		}
+		path, err := findBinaryForSID(args[1], sid)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
@@ -103,7 +139,7 @@ func handleBinary(args []string) {
 		fmt.Println(path)
 
 	case "list":
-		listBinaries()
+		listBinaries(len(args) > 1 && args[1] == "--names")
 
 	case "help", "-h", "--help":
 		printBinaryHelp()
@@ -119,31 +155,33 @@ func handleBinary(args []string) {
 	}
 }
 
-func listBinaries() {
-	binDir := getBinDir()
+// listBinaries prints the merged registry with the resolved path of each
+// binary. With namesOnly, only the names are printed (one per line).
+func listBinaries(namesOnly bool) {
+	binaries, err := knownBinaries()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
 
-	binaries := []struct {
-		name     string
-		required bool
-	}{
-		{"gum", true},
-		{"yq", true},
-		{"rg", false},
-		{"fd", false},
-		{"sd", false},
-		{"sg", false},
+	if namesOnly {
+		for _, b := range binaries {
+			fmt.Println(b.Name)
+		}
+		return
 	}
 
-	fmt.Printf("%-10s %-10s %-8s %s\n", "Name", "Required", "Status", "Path")
-	fmt.Printf("%-10s %-10s %-8s %s\n", "----", "--------", "------", "----")
+	binDir := getBinDir()
+
+	fmt.Printf("%-10s %-10s %-8s %-20s %s\n", "Name", "Required", "Status", "Source", "Path")
+	fmt.Printf("%-10s %-10s %-8s %-20s %s\n", "----", "--------", "------", "------", "----")
 
 	for _, b := range binaries {
 		required := "no"
-		if b.required {
+		if b.Required {
 			required = "yes"
 		}
 
-		path, err := findBinary(b.name)
+		path, err := findBinary(b.Name)
 		status := "missing"
 		pathDisplay := "-"
 
@@ -157,7 +195,7 @@ func listBinaries() {
 			}
 		}
 
-		fmt.Printf("%-10s %-10s %-8s %s\n", b.name, required, status, pathDisplay)
+		fmt.Printf("%-10s %-10s %-8s %-20s %s\n", b.Name, required, status, b.Source, pathDisplay)
 	}
 }
 
@@ -165,11 +203,19 @@ func printBinaryHelp() {
 	fmt.Println(`Usage: dcx binary <command>
 
 Commands:
-  find <name>    Find path to binary (bundled or system)
-  list           List all known binaries and their status
-  help           Show this help
+  find <name> [--sid SID]  Find path to binary (bundled or system)
+  list [--names]           List all known binaries and their status
+  help                     Show this help
+
+Known binaries come from etc/tools.yaml, the user tools.yaml
+(~/.config/dcx/tools.yaml) and the binaries: list of installed plugins.
+
+Oracle tools (sqlplus, rman, expdp, ...) are searched in ORACLE_HOME/bin
+first. With --sid, only the home registered for that SID in oratab is
+searched; a tool missing there is an error, not a PATH lookup.
 
 Examples:
-  dcx binary find gum    # Returns path to gum binary
-  dcx binary list        # List all binaries`)
+  dcx binary find gum                # Returns path to gum binary
+  dcx binary find sqlplus --sid ORCL # sqlplus from ORCL's Oracle home
+  dcx binary list                    # List all binaries`)
 }
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config bundles implement the plugin contract's config hand-off
+// (docs/architecture/plugin-contract-dcx-oracle.md, 2.2 and 2.4): the core
+// computes and validates the effective config and passes it to the plugin
+// as the env vars its plugin.yaml declares under config_env.
+
+// Bundle output formats
+var bundleFormats = []string{"env", "json", "null-delimited"}
+
+// exitPreflight is the contract's exit code for failed preflight validation
+const exitPreflight = 3
+
+// bundleVar is one env var of a bundle and where its value came from
+type bundleVar struct {
+	envVar
+	key    string
+	origin configOrigin
+	secret bool
+}
+
+// configBundle handles "dcx config bundle --plugin NAME [--format F]"
+func configBundle(args []string) {
+	opts, rest, err := parseConfigOptions(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	pluginName, format, quiet := "", "env", false
+	if opts.jsonOutput {
+		format = "json"
+	}
+	for i := 0; i < len(rest); i++ {
+		switch arg := rest[i]; {
+		case arg == "--plugin" || arg == "--format":
+			if i+1 >= len(rest) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", arg)
+				os.Exit(2)
+			}
+			if arg == "--plugin" {
+				pluginName = rest[i+1]
+			} else {
+				format = rest[i+1]
+			}
+			i++
+		case strings.HasPrefix(arg, "--plugin="):
+			pluginName = strings.TrimPrefix(arg, "--plugin=")
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		case arg == "--quiet" || arg == "-q":
+			quiet = true
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown option: %s\n", arg)
+			os.Exit(2)
+		}
+	}
+	if pluginName == "" {
+		fmt.Fprintln(os.Stderr, "Usage: dcx config bundle --plugin <name> [--format env|json|null-delimited]")
+		os.Exit(2)
+	}
+	if !slices.Contains(bundleFormats, format) {
+		fmt.Fprintf(os.Stderr, "Error: unknown format: %s (use %s)\n", format, strings.Join(bundleFormats, ", "))
+		os.Exit(2)
+	}
+
+	plugin, err := findPlugin(pluginName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(plugin.ConfigEnv) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: plugin %s declares no config_env in its plugin.yaml\n", plugin.Name)
+		os.Exit(1)
+	}
+
+	ec, err := loadEffectiveConfig(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	vars, problems, err := buildBundle(ec, plugin, !opts.raw)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", problem)
+		}
+		fmt.Fprintf(os.Stderr, "%d problem(s) found; the %s config bundle was not produced\n", len(problems), plugin.Name)
+		os.Exit(exitPreflight)
+	}
+
+	if !quiet {
+		logBundle(plugin, ec, vars)
+	}
+	if err := writeBundle(vars, format); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// buildBundle maps the plugin's config keys to its env vars. Missing
+// required keys and values its config_schema rejects are returned as
+// problems; secret references are resolved, with the store opened once.
+func buildBundle(ec *EffectiveConfig, plugin *PluginManifest, interpolate bool) ([]bundleVar, []string, error) {
+	var problems []string
+
+	if section := ec.lookup(plugin.Name); section != nil && plugin.ConfigSchema != nil {
+		for _, p := range validateNode(plugin.ConfigSchema, section, plugin.Name, nil) {
+			problems = append(problems, fmt.Sprintf("%s: %s  # %s", p.Path, p.Message, ec.origin(findOriginNode(section, p.Path, plugin.Name))))
+		}
+	}
+
+	in := newInterpolator(ec.Root, true)
+	var vars []bundleVar
+	var refs []secretValue
+	for _, v := range plugin.ConfigEnv {
+		segs, err := parseKeyPath(v.Key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("config_env.%s: %v", v.Name, err)
+		}
+		node := resolveAlias(ec.lookup(v.Key))
+		if node == nil || node.Kind == yaml.ScalarNode && (node.ShortTag() == "!!null" || node.Value == "") {
+			if required, why := bundleRequired(ec, v); required {
+				problems = append(problems, fmt.Sprintf("%s (%s) is required%s", v.Name, v.Key, why))
+			}
+			continue
+		}
+
+		if interpolate {
+			if err := in.expandTree(node, segs); err != nil {
+				return nil, nil, err
+			}
+		}
+		known := len(refs)
+		collectSecretRefs(node, segs, &refs)
+		vars = append(vars, bundleVar{
+			envVar: envVar{Name: v.Name},
+			key:    v.Key,
+			origin: ec.origin(node),
+			secret: v.Secret || len(refs) > known || isSensitiveKey(segs[len(segs)-1].key),
+		})
+	}
+	if len(problems) > 0 {
+		return nil, problems, nil
+	}
+
+	if err := resolveSecretRefs(refs, make(map[*yaml.Node]bool)); err != nil {
+		return nil, nil, err
+	}
+	for i := range vars {
+		node := resolveAlias(ec.lookup(vars[i].key))
+		if node.Kind == yaml.ScalarNode {
+			vars[i].Value = node.Value
+			continue
+		}
+		out, err := nodeToJSON(node, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		vars[i].Value = strings.TrimSpace(string(out))
+	}
+
+	if ec.Profile.Name != "" {
+		vars = append(vars, bundleVar{envVar: envVar{"DCX_PROFILE", ec.Profile.Name}, origin: configOrigin{Layer: ec.Profile.Source}})
+	}
+	return vars, nil, nil
+}
+
+// bundleRequired reports whether a missing key is required, and why
+// (" when oracle.mode=network-link") for conditional ones
+func bundleRequired(ec *EffectiveConfig, v PluginEnvVar) (bool, string) {
+	if v.Required {
+		return true, ""
+	}
+	for _, cond := range v.RequiredIf {
+		key, want, hasValue := strings.Cut(cond, "=")
+		node := resolveAlias(ec.lookup(strings.TrimSpace(key)))
+		switch {
+		case node == nil:
+		case hasValue:
+			if node.Kind == yaml.ScalarNode && node.Value == strings.TrimSpace(want) {
+				return true, " when " + cond
+			}
+		case node.Kind != yaml.ScalarNode || node.ShortTag() != "!!null" && node.Value != "" && node.Value != "false":
+			return true, " when " + cond + " is set"
+		}
+	}
+	return false, ""
+}
+
+// findOriginNode finds the node a validation problem points at, for its
+// origin; path is relative to the top of the effective config
+func findOriginNode(section *yaml.Node, path, prefix string) *yaml.Node {
+	rel := strings.TrimPrefix(strings.TrimPrefix(path, prefix), ".")
+	if rel == "" {
+		return section
+	}
+	if segs, err := parseKeyPath(rel); err == nil {
+		if node := findNode(section, segs); node != nil {
+			return node
+		}
+	}
+	return section
+}
+
+// logBundle prints the bundle on stderr for reproducibility, secrets redacted
+func logBundle(plugin *PluginManifest, ec *EffectiveConfig, vars []bundleVar) {
+	fmt.Fprintf(os.Stderr, "# dcx config bundle --plugin %s (profile: %s)\n", plugin.Name, ec.Profile)
+	for _, v := range vars {
+		value := v.Value
+		if v.secret {
+			value = redacted
+		}
+		source := v.origin.String()
+		if v.key != "" {
+			source = v.key + ", " + source
+		}
+		fmt.Fprintf(os.Stderr, "%s=%s  # %s\n", v.Name, value, source)
+	}
+}
+
+// writeBundle prints the bundle on stdout in one of the data-only
+// formats of writeEnvData
+func writeBundle(vars []bundleVar, format string) error {
+	env := make([]envVar, 0, len(vars))
+	for _, v := range vars {
+		env = append(env, v.envVar)
+	}
+	return writeEnvData(os.Stdout, format, env)
+}
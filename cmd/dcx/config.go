@@ -1,9 +1,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -49,43 +52,118 @@ func loadProjectConfig() (*ProjectConfig, error) {
 // handleConfig handles the "dcx config" subcommand
 func handleConfig(args []string) {
 	if len(args) == 0 {
-		configShow()
+		configShow(configOptions{})
 		return
 	}
 
+	if strings.HasPrefix(args[0], "yaml-") {
+		format, rest, err := extractFormatFlag(args[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fileFormat = format
+		args = append([]string{args[0]}, rest...)
+	}
+	if args[0] != "yaml-get" {
+		backupWrites, args = extractBoolFlag(args, "--backup")
+	}
+
 	switch args[0] {
 	case "show":
-		configShow()
+		opts, _, err := parseConfigOptions(args[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		configShow(opts)
+
+	case "profile":
+		opts, _, err := parseConfigOptions(args[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		configProfileCommand(opts)
 
 	case "get":
-		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "Usage: dcx config get <key>")
+		// dcx config get <key> [default] [--system|--global|--local]
+		configGetCommand(args[1:])
+
+	case "set":
+		// dcx config set <key> <value> [--system|--global|--local] [--type T]
+		configSetCommand(args[1:])
+
+	case "unset":
+		// dcx config unset <key> [--system|--global|--local]
+		configUnsetCommand(args[1:])
+
+	case "list":
+		// dcx config list [--system|--global|--local] [--explain]
+		configList(args[1:])
+
+	case "edit":
+		// dcx config edit [--system|--global|--local]
+		configEdit(args[1:])
+
+	case "path":
+		// dcx config path [--system|--global|--local]
+		configPathCommand(args[1:])
+
+	case "effective":
+		opts, _, err := parseConfigOptions(args[1:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		configGet(args[1])
+		configEffective(opts)
 
 	case "paths":
 		configPaths()
 
+	case "bundle":
+		// dcx config bundle --plugin NAME [--format env|json|null-delimited]
+		configBundle(args[1:])
+
+	case "undo":
+		// dcx config undo <file>
+		configUndo(args[1:])
+
+	case "convert":
+		// dcx config convert <in> <out> [--from F] [--to F]
+		configConvert(args[1:])
+
+	case "validate":
+		// dcx config validate [file...] [--schema NAME]
+		configValidate(args[1:])
+
+	case "describe":
+		// dcx config describe <key> [--schema NAME]
+		configDescribe(args[1:])
+
 	case "yaml-get":
-		// dcx config yaml-get <file> <key> [default]
-		if len(args) < 3 {
-			fmt.Fprintln(os.Stderr, "Usage: dcx config yaml-get <file> <key> [default]")
-			os.Exit(1)
-		}
-		defaultVal := ""
-		if len(args) >= 4 {
-			defaultVal = args[3]
-		}
-		yamlGet(args[1], args[2], defaultVal)
+		// dcx config yaml-get <file> <key> [default] [--json|--raw0]
+		yamlGetCommand(args[1:])
 
 	case "yaml-set":
-		// dcx config yaml-set <file> <key> <value>
-		if len(args) < 4 {
-			fmt.Fprintln(os.Stderr, "Usage: dcx config yaml-set <file> <key> <value>")
+		// dcx config yaml-set <file> <key> <value> [--type T] [--value-file F]
+		yamlSetCommand(args[1:])
+
+	case "yaml-delete":
+		// dcx config yaml-delete <file> <key>
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "Usage: dcx config yaml-delete <file> <key>")
 			os.Exit(1)
 		}
-		yamlSet(args[1], args[2], args[3])
+		yamlDelete(args[1], args[2])
+
+	case "yaml-merge":
+		// dcx config yaml-merge <base> <overlay> [-o out] [--list S] [--key F]
+		yamlMergeCommand(args[1:])
+
+	case "yaml-diff":
+		// dcx config yaml-diff <a> <b> [--json]
+		yamlDiffCommand(args[1:])
 
 	case "yaml-has":
 		// dcx config yaml-has <file> <key>
@@ -112,11 +190,11 @@ func handleConfig(args []string) {
 
 	default:
 		// Treat as key to get
-		configGet(args[0])
+		configGet(args[0], nil, configOptions{})
 	}
 }
 
-func configShow() {
+func configShow(opts configOptions) {
 	config, err := loadProjectConfig()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -133,9 +211,70 @@ func configShow() {
 	fmt.Printf("  bin: %s\n", getBinDir())
 	fmt.Printf("  etc: %s\n", getEtcDir())
 	fmt.Printf("  cache: %s\n", getCacheDir())
+
+	ec, err := loadEffectiveConfig(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println()
+	fmt.Printf("Profile: %s\n", ec.Profile)
+	fmt.Println()
+	fmt.Println("Layers (lowest precedence first):")
+	for _, line := range configLayersSummary(ec) {
+		fmt.Printf("  %s\n", line)
+	}
+
+	if secrets := configSecrets(ec); len(secrets) > 0 {
+		fmt.Println()
+		fmt.Println("Secrets:")
+		for _, line := range secrets {
+			fmt.Printf("  %s\n", line)
+		}
+	}
 }
 
-func configGet(key string) {
+// configGet prints a key of the effective config, falling back to the
+// legacy path/project aliases (home, bin, platform, ...) and then to
+// defaultVal when it is not nil
+func configGet(key string, defaultVal *string, opts configOptions) {
+	ec, err := loadEffectiveConfig(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if node := ec.lookup(key); node != nil {
+		segs, _ := parseKeyPath(key)
+		if !opts.raw {
+			if err := newInterpolator(ec.Root, opts.strict).expandTree(node, segs); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		sensitive := make(map[*yaml.Node]bool)
+		if opts.secrets {
+			if err := resolveSecrets(node, segs, sensitive); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if opts.jsonOutput {
+			value, err := nodeToJSONValue(node)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			printJSON(value)
+		} else {
+			fmt.Println(renderValue(node))
+		}
+		if opts.explain {
+			explainConfigKey(ec, key, node, sensitive)
+		}
+		return
+	}
+
 	config, err := loadProjectConfig()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -160,11 +299,41 @@ func configGet(key string) {
 	case "platform":
 		fmt.Println(detectPlatform())
 	default:
+		if defaultVal != nil {
+			fmt.Println(*defaultVal)
+			return
+		}
 		fmt.Fprintf(os.Stderr, "Unknown config key: %s\n", key)
 		os.Exit(1)
 	}
 }
 
+// explainConfigKey prints on stderr which layer supplied key and the
+// values it overrode, so stdout stays the plain value. Resolved secrets
+// are redacted.
+func explainConfigKey(ec *EffectiveConfig, key string, node *yaml.Node, sensitive map[*yaml.Node]bool) {
+	if node.Kind == yaml.MappingNode {
+		walkMappingLeaves(node, key, func(path string, leaf *yaml.Node) {
+			fmt.Fprintf(os.Stderr, "%s = %s  # %s\n", path, displayValue(leaf, sensitive), ec.origin(leaf))
+		})
+		return
+	}
+
+	winner := ec.origin(node)
+	fmt.Fprintf(os.Stderr, "%s: %s\n", key, winner)
+	segs, _ := parseKeyPath(key)
+	for i := len(ec.Layers) - 1; i >= 0; i-- {
+		layer := ec.Layers[i]
+		if layer.Root == nil || layer.Name == winner.Layer && layer.File == winner.File {
+			continue
+		}
+		if shadowed := findNode(layer.Root, segs); shadowed != nil {
+			origin := configOrigin{Layer: layer.Name, File: layer.File, Line: shadowed.Line}
+			fmt.Fprintf(os.Stderr, "  overrides %s = %s\n", origin, renderInline(shadowed))
+		}
+	}
+}
+
 func configPaths() {
 	fmt.Printf("DCX_HOME=%s\n", getDCHome())
 	fmt.Printf("DCX_BIN_DIR=%s\n", getBinDir())
@@ -178,14 +347,117 @@ func printConfigHelp() {
 
 Commands:
   show                         Show all configuration
-  get <key>                    Get a specific config value
+  get <key> [default]          Get a value from the effective config (or,
+                               with a scope, from that layer's file)
+  set <key> <value>            Set a value in a layer file (default: --global)
+      [--type T]               string|int|float|bool|null|json|yaml
+      [--value-file F|-]       Read the value from a file or stdin (yaml)
+  unset <key>                  Remove a key from a layer file (default: --global)
+  list                         Print key=value for every value (--explain adds
+                               the layer; with a scope, that file only)
+  edit                         Open a layer file in $VISUAL/$EDITOR (default: --global)
+  path                         Print the file a scope writes to (default: --global)
+  effective                    Print the merged effective config
+  profile                      Print the selected profile name (if any)
+  bundle --plugin NAME         Print the env vars a plugin reads its config
+                               from (config_env in its plugin.yaml)
+         [--format F]          env (default), json or null-delimited
+         [--quiet]             Don't log the bundle (secrets redacted) on stderr
+                               Exit: 3 when a required key is missing
   paths                        Print paths as shell variables
-  yaml-get <file> <key> [def]  Get value from YAML file
+  validate [file...]           Check config files against etc/schemas
+           [--schema NAME]     config, defaults, project, tools, plugin or a file
+                               Default: config layers, tools.yaml, plugin.yaml
+  describe <key>               Show the documentation of a key
+           [--schema NAME]     Schema to look in (default: config)
+  convert <in> <out>           Rewrite a config file in another format
+          [--from F] [--to F]  Formats when the file names don't say ("-" is stdio)
+  undo <file>                  Restore the newest <file>.bak.N (see --backup)
+  yaml-get <file> <key> [def]  Get value from YAML file (maps/lists as YAML)
+           [--json]            Print the value as JSON
+           [--raw0]            NUL-terminated scalars or list items
+           [--no-interpolate]  Print ${...} references unexpanded
+           [--strict]          Fail on an undefined ${...} (exit 2)
+           [--resolve-secrets] Resolve cred:// and env:// references
+                               Exit: 0 found (null too), 1 missing, 2 error
   yaml-set <file> <key> <val>  Set value in YAML file
+           [--type T]          string|int|float|bool|null|json|yaml
+           [--value-file F|-]  Read the value from a file or stdin (yaml)
+  yaml-delete <file> <key>     Remove a key or list item
+  yaml-merge <base> <overlay>  Overlay one file on another (stdout or -o)
+           [-o out]            Write the result to out (may be base)
+           [--list S]          Lists: replace (default), append, merge-by-key
+           [--key F]           Item field for merge-by-key (default: name)
+  yaml-diff <a> <b> [--json]   Changed, added and removed paths (exit 1 if any)
   yaml-has <file> <key>        Check if key exists (exit 0/1)
   yaml-keys <file> [path]      List keys at path
 
-Available Keys:
+File Formats (yaml-* commands, convert):
+  yaml      .yaml, .yml and anything unrecognized
+  json      .json
+  toml      .toml (comments are not kept)
+  env       .env, .env.* (flat; nested keys are joined: db.host -> DB_HOST)
+  --format F overrides the file name for every yaml-* command
+
+Writes (set, unset, edit, yaml-set, yaml-delete, yaml-merge -o, convert):
+  Files are replaced atomically (temp file, fsync, rename) under a lock,
+  keeping their mode; concurrent writers never lose each other's updates
+  --backup                     Keep the old contents as <file>.bak.N (last 10)
+
+Key Paths (all config commands):
+  log.level                    Nested keys
+  plugins.dirs[0]              List index ([-1] is the last item)
+  urls."linux-amd64"           Quoted key (may contain dots)
+  versions["1.2.3"]            Bracketed quoted key
+  tools.*.version              Wildcard over keys or items ([*] too)
+  plugins.dirs[+]              Append to a list (yaml-set)
+
+Scopes (get, set, unset, list, edit, path):
+  --system                     $DCX_SYSTEM_CONFIG_DIR/config.yaml (/etc/dcx)
+  --global                     ~/.config/dcx/config.yaml ($XDG_CONFIG_HOME)
+  --local                      Nearest .dcx/config.yaml (created in the
+                               nearest .dcx, or ./.dcx, when there is none)
+  With --profile P the scope's profile file is used (config.P.yaml)
+
+Options (get, list, effective, show, bundle):
+  --profile <name>             Select a profile (default: $DCX_PROFILE, then
+                               the nearest .dcx/profile file)
+  --explain                    Show which layer supplied each value
+  --no-interpolate             Print ${...} references unexpanded
+  --strict                     Fail on an undefined ${...} reference
+  --resolve-secrets            Resolve cred:// and env:// references (get)
+  --set <key=value>            Override a key for this call (repeatable)
+  --json                       JSON output
+
+Interpolation (get, effective, yaml-get):
+  ${NAME}                      Config key (next to the value, then from the
+                               top), environment variable or DCX_* path
+  ${NAME:-default}             Default when NAME is undefined ($VAR allowed)
+  $${text}                     A literal ${text}
+  An undefined ${NAME} is left as written (an error with --strict)
+
+Secret References (get, yaml-get with --resolve-secrets):
+  cred://service/env/name      Credential from the encrypted store (dcx cred)
+  env://VAR                    Environment variable (error when unset)
+  Without the flag references print as written; show and --explain never
+  print resolved secrets, and show lists password-like plain-text values.
+
+Layers (later layers win):
+  project    etc/project.yaml
+  defaults   etc/defaults.yaml
+  system     /etc/dcx/config.yaml ($DCX_SYSTEM_CONFIG_DIR)
+  global     $XDG_CONFIG_HOME/dcx/config.yaml
+  local      nearest .dcx/config.yaml from the working directory
+  env        DCX_<KEY> for known keys (log.level -> DCX_LOG_LEVEL)
+  flags      --set key=value
+
+Profiles (--profile prod):
+  profiles.prod                Section of a config file, merged over the file
+  config.prod.yaml             Sibling of a config file, merged over it too
+  Each file layer is followed by its profile layers (global:prod, ...).
+  The selected profile is exported to plugins as DCX_PROFILE.
+
+Key Aliases:
   name           Project short name (DCX)
   full_name      Project full name
   repo           GitHub repository
@@ -198,146 +470,578 @@ Available Keys:
 Examples:
   dcx config show
   dcx config get repo
+  dcx config get log.level --explain
+  dcx config effective --explain
+  dcx config set log.level debug --local
+  dcx config unset log.level --local
+  dcx config list --global
+  dcx config get oracle.host --profile staging
+  dcx config bundle --plugin oracle --format null-delimited
   dcx config paths
   dcx config yaml-get config.yaml database.host localhost
+  mapfile -d '' dirs < <(dcx config yaml-get config.yaml plugins.dirs --raw0)
   dcx config yaml-set config.yaml log.level debug
+  dcx config yaml-set config.yaml plugins.dirs --type json '["a","b"]'
+  dcx config yaml-set config.yaml 'plugins.dirs[+]' /opt/dcx/plugins
+  dcx config yaml-get etc/tools.yaml 'tools.*.version'
+  dcx config yaml-merge base.yaml site.yaml --list merge-by-key -o base.yaml
+  dcx config yaml-diff old.yaml new.yaml
+  dcx config yaml-get package.json version
+  dcx config yaml-set .env LOG_LEVEL debug
+  dcx config convert config.yaml config.toml
+  dcx config yaml-set config.yaml log.level debug --backup
+  dcx config undo config.yaml
+  dcx config validate
+  dcx config describe log.level
+  dcx config get oracle.password --resolve-secrets
+  dcx config describe --schema tools 'tools.*.extract'
   eval "$(dcx config paths)"  # Export paths to shell`)
 }
 
-// yamlGet gets a value from a YAML file using dot-notation key
-func yamlGet(file, key, defaultVal string) {
-	data, err := os.ReadFile(file)
+// yamlGetCommand parses "yaml-get <file> <key> [default] [--json|--raw0]
+// [--no-interpolate|--strict] [--resolve-secrets]" and runs yamlGet
+func yamlGetCommand(args []string) {
+	var positional []string
+	format := ""
+	interpolate, strict, secrets := true, false, false
+	for _, arg := range args {
+		switch arg {
+		case "--json", "--raw0":
+			format = strings.TrimPrefix(arg, "--")
+		case "--no-interpolate":
+			interpolate = false
+		case "--strict":
+			strict = true
+		case "--resolve-secrets":
+			secrets = true
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	if len(positional) < 2 || len(positional) > 3 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx config yaml-get <file> <key> [default] [--json|--raw0]")
+		os.Exit(2)
+	}
+	var defaultVal *string
+	if len(positional) == 3 {
+		defaultVal = &positional[2]
+	}
+	os.Exit(yamlGet(positional[0], positional[1], defaultVal, format, interpolate, strict, secrets))
+}
+
+// yamlGet prints the value at a key path of a YAML file and returns the
+// exit code: 0 when found (null and "" included), 1 when the key is
+// missing and no default was given, 2 for a bad path or unreadable file.
+// Scalars print raw and maps/lists as YAML; format "json" prints JSON and
+// "raw0" prints NUL-terminated scalars or list items for bash mapfile.
+// A wildcard path prints every match. ${...} references in the values are
+// expanded unless interpolate is false (undefined ones are errors when
+// strict); cred:// and env:// references only when secrets is true.
+func yamlGet(file, key string, defaultVal *string, format string, interpolate, strict, secrets bool) int {
+	printDefault := func() int {
+		switch {
+		case defaultVal == nil:
+			return 1
+		case format == "json":
+			out, _ := json.Marshal(*defaultVal)
+			fmt.Println(string(out))
+		case format == "raw0":
+			fmt.Print(*defaultVal + "\x00")
+		default:
+			fmt.Println(*defaultVal)
+		}
+		return 0
+	}
+
+	segs, err := parseKeyPath(key)
 	if err != nil {
-		fmt.Println(defaultVal)
-		return
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
 	}
 
-	var root map[string]interface{}
-	if err := yaml.Unmarshal(data, &root); err != nil {
-		fmt.Println(defaultVal)
-		return
+	doc, err := loadYAMLDocument(file)
+	if err != nil {
+		if defaultVal == nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		return printDefault()
+	}
+	if _, statErr := os.Stat(file); statErr != nil && defaultVal == nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", statErr)
+		return 2
 	}
 
-	value := getNestedValue(root, key)
-	if value == nil {
-		fmt.Println(defaultVal)
-		return
+	matches := doc.find(segs)
+	if len(matches) == 0 {
+		return printDefault()
+	}
+
+	var nodes []*yaml.Node
+	var refs []secretValue
+	in := newInterpolator(doc.root(), strict)
+	for _, m := range matches {
+		if interpolate {
+			if err := in.expandTree(m.node, m.path); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 2
+			}
+		}
+		if secrets {
+			collectSecretRefs(m.node, m.path, &refs)
+		}
+		nodes = append(nodes, resolveAlias(m.node))
+	}
+	// all matches at once, so the credential store is opened once
+	if err := resolveSecretRefs(refs, make(map[*yaml.Node]bool)); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
 	}
 
-	fmt.Println(value)
+	switch format {
+	case "json":
+		var value interface{}
+		if hasWildcard(segs) {
+			list := make([]interface{}, 0, len(nodes))
+			for _, node := range nodes {
+				v, err := nodeToJSONValue(node)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					return 2
+				}
+				list = append(list, v)
+			}
+			value = list
+		} else if value, err = nodeToJSONValue(nodes[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		printJSON(value)
+
+	case "raw0":
+		for _, node := range nodes {
+			items := []*yaml.Node{node}
+			if node.Kind == yaml.SequenceNode {
+				items = node.Content
+			}
+			for _, item := range items {
+				item = resolveAlias(item)
+				if item.Kind == yaml.ScalarNode {
+					if item.ShortTag() != "!!null" {
+						fmt.Print(item.Value)
+					}
+				} else {
+					out, err := nodeToJSON(item, false)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+						return 2
+					}
+					os.Stdout.Write(out)
+				}
+				fmt.Print("\x00")
+			}
+		}
+
+	default:
+		for _, node := range nodes {
+			if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null" {
+				fmt.Println()
+				continue
+			}
+			fmt.Println(renderValue(node))
+		}
+	}
+	return 0
 }
 
-// yamlSet sets a value in a YAML file using dot-notation key
-func yamlSet(file, key, value string) {
-	var root map[string]interface{}
+// yamlSetCommand parses "yaml-set <file> <key> [value] [--type T]
+// [--value-file F|-]" and runs yamlSet
+func yamlSetCommand(args []string) {
+	var positional []string
+	valueType := ""
+	valueFile := ""
 
-	data, err := os.ReadFile(file)
-	if err == nil {
-		yaml.Unmarshal(data, &root)
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--type" || arg == "--value-file":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", arg)
+				os.Exit(1)
+			}
+			if arg == "--type" {
+				valueType = args[i+1]
+			} else {
+				valueFile = args[i+1]
+			}
+			i++
+		case strings.HasPrefix(arg, "--type="):
+			valueType = strings.TrimPrefix(arg, "--type=")
+		case strings.HasPrefix(arg, "--value-file="):
+			valueFile = strings.TrimPrefix(arg, "--value-file=")
+		default:
+			positional = append(positional, arg)
+		}
 	}
-	if root == nil {
-		root = make(map[string]interface{})
+
+	if valueFile != "" && len(positional) == 2 {
+		var data []byte
+		var err error
+		if valueFile == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(valueFile)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if valueType == "" {
+			valueType = "yaml"
+		}
+		positional = append(positional, strings.TrimRight(string(data), "\n"))
 	}
 
-	setNestedValue(root, key, value)
+	if len(positional) < 3 && !(len(positional) == 2 && valueType == "null") {
+		fmt.Fprintln(os.Stderr, "Usage: dcx config yaml-set <file> <key> <value> [--type T] [--value-file F|-]")
+		os.Exit(1)
+	}
+	positional = append(positional, "")
+	yamlSet(positional[0], positional[1], positional[2], valueType)
+}
+
+// yamlSet sets a value in a YAML file using a key path, leaving
+// comments, key order and formatting of the rest of the file intact
+func yamlSet(file, key, value, valueType string) {
+	doc, err := editYAMLDocument(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer doc.close()
 
-	output, err := yaml.Marshal(root)
+	segs := doc.keyPath(keyPathOrExit(key))
+	node, err := yamlValueNode(value, valueType, findNode(doc.root(), segs))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Create directory if needed
-	dir := filepath.Dir(file)
-	if dir != "" && dir != "." {
-		os.MkdirAll(dir, 0755)
+	if err := doc.set(segs, node); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	if err := os.WriteFile(file, output, 0644); err != nil {
+	if err := doc.save(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-// yamlHas checks if a key exists in YAML file
-func yamlHas(file, key string) {
-	data, err := os.ReadFile(file)
+// yamlDelete removes a key or list item from a YAML file
+func yamlDelete(file, key string) {
+	segs := keyPathOrExit(key)
+
+	doc, err := editYAMLDocument(file)
 	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	defer doc.close()
 
-	var root map[string]interface{}
-	if err := yaml.Unmarshal(data, &root); err != nil {
+	if err := doc.delete(segs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v: %s\n", err, key)
 		os.Exit(1)
 	}
 
-	if getNestedValue(root, key) == nil {
+	if err := doc.save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-	os.Exit(0)
 }
 
-// yamlKeys lists keys at a path in YAML file
-func yamlKeys(file, path string) {
-	data, err := os.ReadFile(file)
+// yamlMergeCommand parses "yaml-merge <base> <overlay> [-o out]
+// [--list S] [--key F]" and overlays the first document of overlay on base
+func yamlMergeCommand(args []string) {
+	var positional []string
+	output := ""
+	opts := yamlMergeOptions{lists: listReplace, listKey: "name"}
+
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "-o", "--output", "--list", "--key":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", arg)
+				os.Exit(1)
+			}
+			switch arg {
+			case "--list":
+				opts.lists = args[i+1]
+			case "--key":
+				opts.listKey = args[i+1]
+			default:
+				output = args[i+1]
+			}
+			i++
+		default:
+			positional = append(positional, arg)
+		}
+	}
+
+	if len(positional) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx config yaml-merge <base> <overlay> [-o out] [--list replace|append|merge-by-key] [--key field]")
+		os.Exit(1)
+	}
+	switch opts.lists {
+	case listReplace, listAppend, listMergeByKey:
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown list strategy: %s (use replace, append, merge-by-key)\n", opts.lists)
+		os.Exit(1)
+	}
+
+	// writing back to the base file (-o base) is a read-modify-write
+	load := loadYAMLDocument
+	if output != "" && resolveWritePath(output) == resolveWritePath(positional[0]) {
+		load = editYAMLDocument
+	}
+	doc, err := load(positional[0])
 	if err != nil {
-		return
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	overlay, err := loadYAMLDocument(positional[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	var root map[string]interface{}
-	if err := yaml.Unmarshal(data, &root); err != nil {
-		return
+	if root := overlay.root(); root != nil {
+		if err := doc.merge(nil, root, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
-	var target map[string]interface{}
-	if path == "" || path == "." {
-		target = root
+	if output != "" {
+		doc.path = output
+		if format := formatForPath(output); format != doc.format {
+			// nothing of the base file's layout carries over
+			doc.format, doc.data, doc.reencode = format, nil, true
+		}
+		err = doc.save()
 	} else {
-		val := getNestedValue(root, path)
-		if m, ok := val.(map[string]interface{}); ok {
-			target = m
+		var out []byte
+		if out, err = doc.bytes(); err == nil {
+			_, err = os.Stdout.Write(out)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// yamlDiffCommand prints the structural differences between two YAML
+// files. Like diff(1) it exits 0 when equal, 1 when different, 2 on error.
+func yamlDiffCommand(args []string) {
+	var positional []string
+	jsonOutput := false
+	for _, arg := range args {
+		if arg == "--json" {
+			jsonOutput = true
 		} else {
-			return
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx config yaml-diff <a> <b> [--json]")
+		os.Exit(2)
+	}
+
+	var roots [2]*yaml.Node
+	for i, file := range positional {
+		if _, err := os.Stat(file); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+		doc, err := loadYAMLDocument(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+		roots[i] = doc.root()
+		if roots[i] == nil {
+			roots[i] = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+	}
+
+	changes := diffNodes("", roots[0], roots[1], nil)
+
+	if jsonOutput {
+		var out []map[string]interface{}
+		for _, c := range changes {
+			entry := map[string]interface{}{"op": c.Op, "path": c.Path}
+			for field, node := range map[string]*yaml.Node{"old": c.Old, "new": c.New} {
+				if node != nil {
+					var v interface{}
+					resolveAlias(node).Decode(&v)
+					entry[field] = v
+				}
+			}
+			out = append(out, entry)
+		}
+		if out == nil {
+			out = []map[string]interface{}{}
+		}
+		printJSON(out)
+	} else {
+		for _, c := range changes {
+			switch c.Op {
+			case "added":
+				fmt.Printf("+ %s: %s\n", c.Path, renderInline(resolveAlias(c.New)))
+			case "removed":
+				fmt.Printf("- %s: %s\n", c.Path, renderInline(resolveAlias(c.Old)))
+			default:
+				fmt.Printf("~ %s: %s -> %s\n", c.Path, renderInline(resolveAlias(c.Old)), renderInline(resolveAlias(c.New)))
+			}
 		}
 	}
 
-	for k := range target {
-		fmt.Println(k)
+	if len(changes) > 0 {
+		os.Exit(1)
 	}
 }
 
-// getNestedValue gets a value from a nested map using dot notation
-func getNestedValue(m map[string]interface{}, key string) interface{} {
-	parts := strings.Split(key, ".")
-	var current interface{} = m
+// configConvert rewrites a config file in another format. Formats come
+// from the file names unless --from/--to are given; "-" reads stdin or
+// writes stdout (YAML unless --from/--to say otherwise).
+func configConvert(args []string) {
+	var positional []string
+	formats := map[string]string{"--from": "", "--to": ""}
 
-	for _, part := range parts {
-		if cm, ok := current.(map[string]interface{}); ok {
-			current = cm[part]
-		} else {
-			return nil
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "--from", "--to":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", arg)
+				os.Exit(1)
+			}
+			format, err := parseFormat(args[i+1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			formats[arg] = format
+			i++
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx config convert <in> <out> [--from F] [--to F]")
+		os.Exit(1)
+	}
+	in, out := positional[0], positional[1]
+	from, to := formats["--from"], formats["--to"]
+	if from == "" {
+		from = detectFormat(in)
+	}
+	if to == "" {
+		to = detectFormat(out)
+	}
+
+	var data []byte
+	var err error
+	if in == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(in)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	src, err := parseYAMLDocument(in, data, from)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(src.docs) > 1 && to != formatYAML {
+		fmt.Fprintf(os.Stderr, "Error: %s holds %d documents; %s files hold one\n", in, len(src.docs), to)
+		os.Exit(1)
+	}
+
+	dst := &yamlDocument{path: out, format: to, docs: src.docs, indent: src.indent, reencode: true}
+	if out == "-" {
+		var text []byte
+		if text, err = dst.bytes(); err == nil {
+			_, err = os.Stdout.Write(text)
 		}
+	} else {
+		err = dst.save()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// yamlHas checks if a key exists in YAML file (any match for wildcards)
+func yamlHas(file, key string) {
+	segs := keyPathOrExit(key)
+
+	doc, err := loadYAMLDocument(file)
+	if err != nil {
+		os.Exit(1)
 	}
 
-	return current
+	for _, m := range doc.find(segs) {
+		if resolveAlias(m.node).ShortTag() != "!!null" {
+			os.Exit(0)
+		}
+	}
+	os.Exit(1)
 }
 
-// setNestedValue sets a value in a nested map using dot notation
-func setNestedValue(m map[string]interface{}, key string, value string) {
-	parts := strings.Split(key, ".")
+// yamlKeys lists keys at a path in YAML file, in file order. Lists yield
+// their indices; a wildcard path lists the keys of every match once.
+func yamlKeys(file, path string) {
+	segs := keyPathOrExit(path)
+
+	doc, err := loadYAMLDocument(file)
+	if err != nil {
+		return
+	}
 
-	for i := 0; i < len(parts)-1; i++ {
-		part := parts[i]
-		if _, ok := m[part]; !ok {
-			m[part] = make(map[string]interface{})
+	seen := make(map[string]bool)
+	for _, m := range doc.find(segs) {
+		var keys []string
+		switch target := resolveAlias(m.node); target.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(target.Content); i += 2 {
+				keys = append(keys, target.Content[i].Value)
+			}
+		case yaml.SequenceNode:
+			for i := range target.Content {
+				keys = append(keys, strconv.Itoa(i))
+			}
 		}
-		if next, ok := m[part].(map[string]interface{}); ok {
-			m = next
-		} else {
-			m[part] = make(map[string]interface{})
-			m = m[part].(map[string]interface{})
+		for _, k := range keys {
+			if !seen[k] {
+				seen[k] = true
+				fmt.Println(k)
+			}
 		}
 	}
+}
 
-	m[parts[len(parts)-1]] = value
+// keyPathOrExit parses a key path, exiting with an error when invalid
+func keyPathOrExit(path string) []pathSegment {
+	segs, err := parseKeyPath(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return segs
 }
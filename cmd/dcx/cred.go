@@ -3,11 +3,14 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/datacosmos-br/dcx/internal/keystore"
 )
 
 // getLibDir returns the lib directory path for shell libraries
@@ -49,6 +52,22 @@ func handleCred(args []string) {
 		credDelete(args[1:])
 	case "export":
 		credExport(args[1:])
+	case "exec":
+		credExec(args[1:])
+	case "migrate-format":
+		credMigrateFormat(args[1:])
+	case "verify":
+		credVerify(args[1:])
+	case "passwd":
+		credPasswd(args[1:])
+	case "recover":
+		credRecover(args[1:])
+	case "unlock":
+		credUnlock(args[1:])
+	case "lock":
+		credLock(args[1:])
+	case "agent":
+		credAgentCommand(args[1:])
 	case "help", "-h", "--help":
 		printCredHelp()
 	default:
@@ -63,18 +82,48 @@ func printCredHelp() {
 	fmt.Println(`Usage: dcx cred <command> [options]
 
 Commands:
-  set <key> <value>    Store a credential
+  set <key>            Store a credential, prompting for the value (no echo);
+                       empty values are refused from every source
+      [--stdin]        Read the value from stdin
+      [--from-file F]  Read the value from a file
+      [--from-env VAR] Take the value from an environment variable
+      [--generate]     Store a random secret (not printed; see get)
+      [--length N]     Its length (default: 32)
+      [--charset C]    alnum (default), alpha, digits, hex, symbols, or
+                       the characters to use
+      [<value>]        On the command line (visible in history and ps)
   get <key>            Retrieve a credential
   list [--json]        List all credential keys
   delete <key> [-y]    Remove a credential
-  export [--prefix X]  Export credentials as environment variables
+  export               Export credentials as environment variables
+      [--prefix X]     Only keys starting with X
+      [--only K,...]   Only these keys or variable names (each must exist)
+      [--map key=VAR]  Export key as VAR instead of SERVICE_ENV_NAME
+      [--format F]     shell (default; export lines for eval), env
+                       (NAME=value), json, dotenv or nul (NAME=value\0);
+                       all but shell are data for parsing, never eval
+  exec [...] -- CMD    Run CMD with the credentials (selected with --prefix,
+                       --only and --map as for export) in its environment
+      [--files]        Instead write them to 0600 files in a tmpfs
+                       directory removed on exit, passing NAME_FILE=path
+  migrate-format       Upgrade a version 1.0 store to the current format
+  verify               Check the master password (exit 1 wrong, 2 locked out)
+  passwd               Change the master password (re-encrypts every value)
+  recover              Reset a forgotten master password with the recovery
+                       key; issues a new recovery key
+  unlock [--ttl D]     Start an agent that keeps the store unlocked for D
+                       (default: 15m) for get and export
+  lock                 Stop the agent, wiping the key from memory
 
 Key Format:
   Keys must use the format: service/environment/name
   Examples: oracle/prod/password, aws/staging/secret_key
 
 Examples:
-  dcx cred set oracle/prod/password mySecretPass
+  dcx cred set oracle/prod/password
+  echo "$PASS" | dcx cred set oracle/prod/password --stdin
+  dcx cred set oracle/prod/password --from-file /run/secrets/oracle
+  dcx cred set oracle/prod/wallet_pw --generate --length 24 --charset symbols
   dcx cred get oracle/prod/password
   dcx cred list
   dcx cred list --json
@@ -82,38 +131,100 @@ Examples:
   dcx cred delete oracle/prod/password -y
   dcx cred export --prefix oracle/prod
   eval "$(dcx cred export --prefix oracle/prod)"
+  dcx cred export --only oracle/prod/password --map oracle/prod/password=DB_PASSWORD --format env
+  dcx cred export --prefix oracle/prod --format json
+  dcx cred exec --prefix oracle/prod -- impdp system@PROD parfile=imp.par
+  dcx cred exec --only oracle/prod/password --files -- ./load.sh
+  dcx cred passwd
+  dcx cred recover
+  dcx cred unlock --ttl 30m
+  dcx cred lock
+
+Store:
+  $DCX_HOME/etc/credentials.enc (mode 0600), created by the first set.
+  Values are encrypted with AES-256-GCM under a key derived from the master
+  password (PBKDF2-SHA256). Version 1.0 stores are read as they are and
+  upgraded by the next write or by migrate-format. Version 1.0 values open
+  without a password, so no copy of the old file is kept; shred any you made.
+
+Unlocking:
+  A wrong master password is rejected at once. A prompt allows 3 attempts,
+  waiting longer after each. With cred.lockout set (dcx config set
+  cred.lockout true) failures are counted across runs, and after 3 the next
+  try waits cred.lockout_delay seconds, doubling with each further failure.
+  delete needs no password, except to upgrade a version 1.0 store.
+
+Agent:
+  Like ssh-agent, the agent holds the key (never the password) and answers
+  get and export over a unix socket that only your user can use (mode
+  0600; on Linux, callers are also checked with SO_PEERCRED). It exits on
+  lock or when the TTL runs out, and sees values set after it started.
+
+Exec:
+  The credentials reach the command only, never the calling shell, and
+  DCX_KEYRING_PASSWORD is removed from its environment. The command
+  replaces dcx (on unix), so its exit code and signals are its own; with
+  --files, dcx waits to remove the files, relays SIGTERM, SIGHUP, SIGUSR1
+  and SIGUSR2, and exits as the command did. Exit 127: command not found.
+
+Recovery:
+  The recovery key shown when the store is created can unlock it in place
+  of the master password. passwd keeps it valid; recover replaces it.
+  Stores created before recover existed get a new one from passwd.
 
 Environment:
-  DCX_KEYRING_PASSWORD  Master password for automation (optional)`)
+  DCX_KEYRING_PASSWORD      Master password for automation (optional)
+  DCX_KEYRING_NEW_PASSWORD  New password for passwd and recover
+  DCX_RECOVERY_KEY          Recovery key for recover
+  DCX_CRED_AGENT_SOCK       Agent socket (default: $XDG_RUNTIME_DIR/dcx/agent.sock)
+  DCX_CRED_FILE             Use another store file`)
 }
 
 // credSet stores a credential
 func credSet(args []string) {
-	if len(args) < 2 {
-		fmt.Fprintln(os.Stderr, "Usage: dcx cred set <key> <value>")
+	key, src, err := parseCredSetArgs(args)
+	if err != nil {
+		if !errors.Is(err, errCredSetUsage) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		fmt.Fprintln(os.Stderr, "Usage: dcx cred set <key> [--stdin | --from-file F | --from-env VAR | --generate]")
 		fmt.Fprintln(os.Stderr, "Key format: service/environment/name")
 		os.Exit(1)
 	}
 
-	key := args[0]
-	value := args[1]
-
-	// Validate key format (must contain at least 2 slashes)
-	parts := strings.Split(key, "/")
-	if len(parts) < 3 {
+	if !keystore.ValidKey(key) {
 		fmt.Fprintln(os.Stderr, "Error: Invalid key format. Use: service/environment/name")
 		fmt.Fprintln(os.Stderr, "Example: oracle/prod/password")
 		os.Exit(1)
 	}
+	if src.literal != nil {
+		fmt.Fprintln(os.Stderr, "Warning: a value on the command line is visible in shell history and ps; omit it to be prompted, or use --stdin")
+	}
 
-	// Execute shell command
-	output, err := runCredCommand(fmt.Sprintf("cred_set %q %q", key, value))
+	// read the value before taking the store lock, which a prompt would hold
+	value, err := src.read(key)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Print(output)
+	store, lock, err := editCredStore(true, true)
+	if err == nil {
+		defer lock.unlock()
+		if err = store.SetValue(key, value); err == nil {
+			err = store.Save()
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if src.generated {
+		fmt.Printf("[INFO] Generated a %d-character secret: %s\n", src.length, key)
+		return
+	}
+	fmt.Printf("[INFO] Credential stored: %s\n", key)
 }
 
 // credGet retrieves a credential
@@ -123,21 +234,23 @@ func credGet(args []string) {
 		os.Exit(1)
 	}
 
-	key := args[0]
-
-	// Execute shell command
-	output, err := runCredCommand(fmt.Sprintf("cred_get %q", key))
+	store, err := openCredValues()
 	if err != nil {
-		// Don't output the error message, just exit with status 1
-		// The shell function already printed the error
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	value, err := store.Value(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
 	// Output the clean value (for scripting)
-	fmt.Print(output)
+	fmt.Print(value)
 }
 
-// credList lists all credential keys
+// credList lists all credential keys; names are not encrypted, so no
+// password is needed
 func credList(args []string) {
 	jsonOutput := false
 
@@ -147,24 +260,14 @@ func credList(args []string) {
 		}
 	}
 
-	// Execute shell command
-	output, err := runCredCommand("cred_list")
+	store, err := loadCredStore()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	keys := store.Keys()
 
 	if jsonOutput {
-		// Parse output into JSON array
-		lines := strings.Split(strings.TrimSpace(output), "\n")
-		var keys []string
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line != "" {
-				keys = append(keys, line)
-			}
-		}
-
 		jsonBytes, err := json.Marshal(keys)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
@@ -172,7 +275,9 @@ func credList(args []string) {
 		}
 		fmt.Println(string(jsonBytes))
 	} else {
-		fmt.Print(output)
+		for _, key := range keys {
+			fmt.Println(key)
+		}
 	}
 }
 
@@ -205,83 +310,220 @@ func credDelete(args []string) {
 		}
 	}
 
-	// Execute shell command
-	output, err := runCredCommand(fmt.Sprintf("cred_delete %q", key))
+	store, lock, err := editCredStore(false, false)
+	if err == nil {
+		defer lock.unlock()
+		if err = store.Delete(key); err == nil {
+			err = store.Save()
+		}
+	}
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Print(output)
+	fmt.Printf("[INFO] Credential deleted: %s\n", key)
 }
 
-// credExport exports credentials as environment variables
-func credExport(args []string) {
-	prefix := ""
-	showEnv := false
-
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "--prefix":
-			if i+1 < len(args) {
-				prefix = args[i+1]
-				i++
-			} else {
-				fmt.Fprintln(os.Stderr, "Error: --prefix requires a value")
-				os.Exit(1)
-			}
-		case "--env":
-			showEnv = true
+// credMigrateFormat rewrites a version 1.0 store in the current format.
+// No backup of the old file is kept: its values open without a password.
+func credMigrateFormat(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx cred migrate-format")
+		os.Exit(1)
+	}
+
+	store, lock, err := editCredStore(false, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer lock.unlock()
+
+	from := store.LoadedVersion()
+	if from == keystore.Version {
+		fmt.Printf("[INFO] %s is already version %s\n", store.Path(), keystore.Version)
+		return
+	}
+	if err := store.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("[INFO] Upgraded %s from version %s to %s\n", store.Path(), from, keystore.Version)
+	if backups := listBackups(store.Path()); len(backups) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: backups of %s may hold version %s values, which open without a password; shred them:\n", store.Path(), from)
+		fmt.Fprintf(os.Stderr, "  shred -u %s.bak.*\n", store.Path())
+	}
+}
+
+// credVerify checks the master password, for cred_open
+func credVerify(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx cred verify")
+		os.Exit(1)
+	}
+	if _, err := openCredStore(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, errLockedOut) {
+			os.Exit(2)
 		}
+		os.Exit(1)
 	}
+}
 
-	// Build command
-	var cmd string
-	if prefix != "" {
-		cmd = fmt.Sprintf("cred_export %q", prefix)
-	} else {
-		cmd = "cred_export"
+// credFile returns the path of the credential store
+func credFile() string {
+	if path := os.Getenv("DCX_CRED_FILE"); path != "" {
+		return path
+	}
+	return filepath.Join(getDCHome(), "etc", "credentials.enc")
+}
+
+// loadCredStore reads the credential store without unlocking it
+func loadCredStore() (*keystore.Store, error) {
+	store, err := keystore.Load(credFile())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("credentials file not found: %s", credFile())
 	}
+	return store, err
+}
 
-	// Execute shell command
-	output, err := runCredCommand(cmd)
+// openCredStore reads and unlocks the credential store
+func openCredStore() (*keystore.Store, error) {
+	store, err := loadCredStore()
 	if err != nil {
-		fmt.Fprintln(os.Stderr, output)
-		os.Exit(1)
+		return nil, err
 	}
+	if err := unlockCredStore(store); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
 
-	if showEnv {
-		// Already in export format
-		fmt.Print(output)
-	} else {
-		fmt.Print(output)
+// editCredStore locks the store file for a read-modify-write and, when the
+// values must be read or sealed (unlock), unlocks the store; with create a
+// missing store is initialized. A store in an older format is always
+// unlocked, which upgrades it for Save.
+func editCredStore(create, unlock bool) (*keystore.Store, *fileLock, error) {
+	path := credFile()
+	lock, err := lockFile(path)
+	if err != nil {
+		return nil, nil, err
 	}
+
+	var store *keystore.Store
+	if _, statErr := os.Stat(path); create && errors.Is(statErr, fs.ErrNotExist) {
+		store, err = initCredStore(path)
+	} else if store, err = loadCredStore(); err == nil && (unlock || store.LoadedVersion() != keystore.Version) {
+		err = unlockCredStore(store)
+	}
+	if err != nil {
+		lock.unlock()
+		return nil, nil, err
+	}
+	return store, lock, nil
 }
 
-// runCredCommand executes a cred.sh function and returns output
-func runCredCommand(funcCall string) (string, error) {
-	libDir := getLibDir()
-	credShPath := filepath.Join(libDir, "cred.sh")
+// errNoTerminal is returned by readPassword when there is no terminal
+var errNoTerminal = errors.New("no terminal to prompt on")
 
-	// Check if cred.sh exists
-	if _, err := os.Stat(credShPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("credential library not found: %s\nEnsure DCX_HOME is set correctly", credShPath)
+// readMasterPassword asks for the master password
+func readMasterPassword(prompt string) (string, error) {
+	password, err := readPassword(prompt)
+	if errors.Is(err, errNoTerminal) {
+		err = errors.New("no terminal to ask for the master password (set DCX_KEYRING_PASSWORD)")
 	}
+	return password, err
+}
 
-	// Build bash command that sources cred.sh and calls the function
-	bashCmd := fmt.Sprintf("source %q && %s", credShPath, funcCall)
+// readPassword asks for a password on the terminal without echo
+func readPassword(prompt string) (string, error) {
+	tty, err := openTerminal()
+	if err != nil {
+		return "", errNoTerminal
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	restore := disableEcho(tty)
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	restore()
+	fmt.Fprintln(os.Stderr)
+	if err != nil && line == "" {
+		return "", fmt.Errorf("cannot read password: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
 
-	// Execute with bash
-	cmd := exec.Command("bash", "-c", bashCmd)
+// initCredStore creates the store on first use: it asks for the master
+// password (twice) and shows the recovery key once
+func initCredStore(path string) (*keystore.Store, error) {
+	if os.Getenv("DCX_KEYRING_PASSWORD") == "" {
+		fmt.Fprintln(os.Stderr, "Creating credential store:", path)
+	}
+	password, err := newMasterPassword("DCX_KEYRING_PASSWORD", "Create master password", "Confirm master password")
+	if err != nil {
+		return nil, err
+	}
+
+	store, recoveryKey, err := keystore.Create(path, password)
+	if err != nil {
+		return nil, err
+	}
+	showRecoveryKey(recoveryKey)
+	if err := store.Save(); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "[INFO] Credential storage initialized: %s\n", path)
+	return store, nil
+}
+
+// newMasterPassword returns the password in envVar, or asks for one twice
+func newMasterPassword(envVar, prompt, confirmPrompt string) (string, error) {
+	password := os.Getenv(envVar)
+	if password == "" {
+		var confirm string
+		var err error
+		if password, err = readPassword(prompt); err == nil {
+			confirm, err = readPassword(confirmPrompt)
+		}
+		if errors.Is(err, errNoTerminal) {
+			return "", fmt.Errorf("no terminal to ask for the master password (set %s)", envVar)
+		}
+		if err != nil {
+			return "", err
+		}
+		if password != confirm {
+			return "", errors.New("passwords do not match")
+		}
+	}
+	if len(password) < 8 {
+		return "", errors.New("password must be at least 8 characters")
+	}
+	return password, nil
+}
 
-	// Set DCX_HOME in environment
-	cmd.Env = append(os.Environ(), fmt.Sprintf("DCX_HOME=%s", getDCHome()))
+// showRecoveryKey prints the recovery key on stderr and, on a terminal,
+// waits until the user confirms it was saved
+func showRecoveryKey(recoveryKey string) {
+	fmt.Fprintf(os.Stderr, `
+RECOVERY KEY (shown once; use it to reset a forgotten master password):
 
-	// Inherit stdin for password prompts
-	cmd.Stdin = os.Stdin
+    %s
 
-	// Capture output
-	output, err := cmd.CombinedOutput()
+`, recoveryKey)
 
-	return string(output), err
+	tty, err := openTerminal()
+	if err != nil {
+		return
+	}
+	defer tty.Close()
+	reader := bufio.NewReader(tty)
+	for {
+		fmt.Fprint(os.Stderr, "Type 'saved' to confirm you have saved the recovery key: ")
+		line, err := reader.ReadString('\n')
+		if strings.TrimSpace(line) == "saved" || err != nil {
+			return
+		}
+	}
 }
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/datacosmos-br/dcx/internal/keystore"
+)
+
+// The credential agent, like ssh-agent, keeps the key of an unlocked
+// store in memory for a while so that "dcx cred get" and "dcx cred export"
+// need neither a prompt nor DCX_KEYRING_PASSWORD. "dcx cred unlock" starts
+// it as a detached "dcx cred agent" process, passing the key on its stdin;
+// it listens on a 0600 unix socket in a 0700 directory, serves only its
+// own user (checked with SO_PEERCRED on Linux), never hands out the key,
+// and wipes it on "dcx cred lock" or when the TTL runs out. The protocol
+// is one JSON request and one JSON response per line.
+
+const defaultAgentTTL = 15 * time.Minute
+
+// agentRequest is a request to the agent: ping, get or lock
+type agentRequest struct {
+	Op    string `json:"op"`
+	Store string `json:"store,omitempty"`
+	Key   string `json:"key,omitempty"`
+}
+
+// agentResponse is the agent's answer; Error is set on failure
+type agentResponse struct {
+	Value   string `json:"value,omitempty"`
+	Expires string `json:"expires,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// agentSocket returns the socket path: DCX_CRED_AGENT_SOCK, else
+// agent.sock in the runtime directory
+func agentSocket() string {
+	if path := os.Getenv("DCX_CRED_AGENT_SOCK"); path != "" {
+		return path
+	}
+	return filepath.Join(getRuntimeDir(), "agent.sock")
+}
+
+// credUnlock handles "dcx cred unlock [--ttl D]": it unlocks the store
+// and starts an agent holding its key for D
+func credUnlock(args []string) {
+	ttl := defaultAgentTTL
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if name != "--ttl" {
+			fmt.Fprintln(os.Stderr, "Usage: dcx cred unlock [--ttl 30m]")
+			os.Exit(1)
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: --ttl requires a value")
+				os.Exit(1)
+			}
+			value = args[i+1]
+			i++
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid --ttl: %s (e.g. 30m, 2h)\n", value)
+			os.Exit(1)
+		}
+		ttl = d
+	}
+
+	store, err := unlockForAgent()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	stopCredAgent()
+
+	socket := agentSocket()
+	if err := startCredAgent(store, socket, ttl); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("[INFO] Credential agent unlocked %s for %s (socket: %s)\n", store.Path(), ttl, socket)
+}
+
+// unlockForAgent unlocks the store and saves it first when it is version
+// 1.0 or lacks a verifier, which the agent checks its key against
+func unlockForAgent() (*keystore.Store, error) {
+	lock, err := lockFile(credFile())
+	if err != nil {
+		return nil, err
+	}
+	defer lock.unlock()
+
+	store, err := loadCredStore()
+	if err != nil {
+		return nil, err
+	}
+	upgrade := store.LoadedVersion() != keystore.Version || store.Header("VERIFIER") == ""
+	if err := unlockCredStore(store); err != nil {
+		return nil, err
+	}
+	if upgrade {
+		if err := store.Save(); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// startCredAgent runs "dcx cred agent" detached and waits until it listens
+func startCredAgent(store *keystore.Store, socket string, ttl time.Duration) error {
+	if err := securePrivateDir(filepath.Dir(socket)); err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	path, err := filepath.Abs(store.Path())
+	if err != nil {
+		return err
+	}
+
+	key := store.Key()
+	encoded := hex.EncodeToString(key)
+	clear(key)
+	cmd := exec.Command(exe, "cred", "agent", "--socket", socket, "--store", path, "--ttl", ttl.String())
+	cmd.Stdin = strings.NewReader(encoded + "\n")
+	// the agent outlives this call; it must not keep the password around
+	cmd.Env = os.Environ()
+	for _, name := range credExecHidden {
+		cmd.Env = unsetEnv(cmd.Env, name)
+	}
+	detachProcess(cmd)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// the agent prints "ok" once it listens, or why it could not
+	line, _ := bufio.NewReader(out).ReadString('\n')
+	if line = strings.TrimSpace(line); line != "ok" {
+		cmd.Wait()
+		if line == "" {
+			line = "exited"
+		}
+		return fmt.Errorf("credential agent: %s", line)
+	}
+	return cmd.Process.Release()
+}
+
+// credLock handles "dcx cred lock": the agent wipes the key and exits
+func credLock(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx cred lock")
+		os.Exit(1)
+	}
+	if stopCredAgent() {
+		fmt.Println("[INFO] Credential agent locked")
+		return
+	}
+	fmt.Println("[INFO] No credential agent running")
+}
+
+// stopCredAgent asks a running agent to lock; false when none answers
+func stopCredAgent() bool {
+	agent := dialCredAgent()
+	if agent == nil {
+		return false
+	}
+	defer agent.close()
+	_, err := agent.call(agentRequest{Op: "lock"})
+	return err == nil
+}
+
+// agentConn is a client connection to the agent
+type agentConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialCredAgent connects to a running agent, or returns nil
+func dialCredAgent() *agentConn {
+	conn, err := net.DialTimeout("unix", agentSocket(), time.Second)
+	if err != nil {
+		return nil
+	}
+	return &agentConn{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// call sends one request and reads its response
+func (c *agentConn) call(req agentRequest) (agentResponse, error) {
+	var resp agentResponse
+	c.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	data, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+	if _, err := c.conn.Write(append(data, '\n')); err != nil {
+		return resp, err
+	}
+	line, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		return resp, fmt.Errorf("credential agent: %v", err)
+	}
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return resp, fmt.Errorf("credential agent: %v", err)
+	}
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
+
+func (c *agentConn) close() {
+	c.conn.Close()
+}
+
+// credValues is what reading commands need from the store: an unlocked
+// keystore.Store, or an agentStore
+type credValues interface {
+	Keys() []string
+	Value(name string) (string, error)
+}
+
+// agentStore reads values through the agent; names come from the file
+type agentStore struct {
+	*keystore.Store
+	agent *agentConn
+	path  string // absolute store path
+}
+
+// Value asks the agent for the credential name
+func (s agentStore) Value(name string) (string, error) {
+	if !s.Has(name) {
+		return "", fmt.Errorf("%w: %s", keystore.ErrNotFound, name)
+	}
+	resp, err := s.agent.call(agentRequest{Op: "get", Store: s.path, Key: name})
+	return resp.Value, err
+}
+
+// openCredValues reads values through an agent holding the store, and
+// otherwise unlocks the store itself
+func openCredValues() (credValues, error) {
+	store, err := loadCredStore()
+	if err != nil {
+		return nil, err
+	}
+	if agent := dialCredAgent(); agent != nil {
+		path, _ := filepath.Abs(store.Path())
+		if _, err := agent.call(agentRequest{Op: "ping", Store: path}); err == nil {
+			return agentStore{store, agent, path}, nil
+		}
+		agent.close()
+	}
+	if err := unlockCredStore(store); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// credAgent is the agent process's state
+type credAgent struct {
+	mu       sync.Mutex
+	path     string // absolute store path
+	key      []byte
+	store    *keystore.Store
+	modTime  time.Time
+	size     int64
+	expires  time.Time
+	listener net.Listener
+	socket   string
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// credAgentCommand handles the internal "dcx cred agent --socket S
+// --store F --ttl D", reading the key from stdin
+func credAgentCommand(args []string) {
+	var socket, path string
+	var ttl time.Duration
+	for i := 0; i+1 < len(args); i += 2 {
+		switch args[i] {
+		case "--socket":
+			socket = args[i+1]
+		case "--store":
+			path = args[i+1]
+		case "--ttl":
+			ttl, _ = time.ParseDuration(args[i+1])
+		}
+	}
+	if socket == "" || path == "" || ttl <= 0 {
+		fmt.Println("usage: dcx cred agent --socket S --store F --ttl D")
+		os.Exit(1)
+	}
+
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	key, err := hex.DecodeString(strings.TrimSpace(line))
+	if err != nil {
+		fmt.Println("invalid key on stdin")
+		os.Exit(1)
+	}
+	agent := &credAgent{path: path, key: key, socket: socket, expires: time.Now().Add(ttl), done: make(chan struct{})}
+	if err := agent.reload(); err == nil {
+		err = agent.listen()
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("ok")
+	os.Stdout.Close()
+
+	go agent.serve()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-time.After(ttl):
+	case <-signals:
+	case <-agent.done:
+	}
+	agent.stop()
+}
+
+// listen creates the socket, replacing a stale one, readable by the user
+// only
+func (a *credAgent) listen() error {
+	os.Remove(a.socket)
+	listener, err := net.Listen("unix", a.socket)
+	if err != nil {
+		return err
+	}
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(a.socket, 0600); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	a.listener = listener
+	return nil
+}
+
+// serve accepts connections until the listener is closed
+func (a *credAgent) serve() {
+	for {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			return
+		}
+		go a.handle(conn)
+	}
+}
+
+// handle answers the requests of one client
+func (a *credAgent) handle(conn net.Conn) {
+	defer conn.Close()
+	enc := json.NewEncoder(conn)
+	if err := checkPeer(conn); err != nil {
+		enc.Encode(agentResponse{Error: err.Error()})
+		return
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for conn.SetDeadline(time.Now().Add(time.Minute)) == nil && scanner.Scan() {
+		var req agentRequest
+		var resp agentResponse
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = "invalid request"
+			enc.Encode(resp)
+			return
+		}
+		switch req.Op {
+		case "ping":
+			if req.Store != a.path {
+				resp.Error = "the agent holds another store: " + a.path
+			}
+			resp.Expires = a.expires.UTC().Format(time.RFC3339)
+		case "get":
+			value, err := a.value(req.Store, req.Key)
+			if err != nil {
+				resp.Error = err.Error()
+			}
+			resp.Value = value
+		case "lock":
+			enc.Encode(resp)
+			a.stopOnce.Do(func() { close(a.done) })
+			return
+		default:
+			resp.Error = "unknown request: " + req.Op
+		}
+		enc.Encode(resp)
+	}
+}
+
+// value decrypts a credential, reloading the store if the file changed
+func (a *credAgent) value(path, name string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.key == nil {
+		return "", keystore.ErrLocked
+	}
+	if path != a.path {
+		return "", fmt.Errorf("the agent holds another store: %s", a.path)
+	}
+	if err := a.reload(); err != nil {
+		return "", err
+	}
+	return a.store.Value(name)
+}
+
+// reload reads the store again when it changed on disk since last time
+func (a *credAgent) reload() error {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return err
+	}
+	if a.store != nil && info.ModTime().Equal(a.modTime) && info.Size() == a.size {
+		return nil
+	}
+	store, err := keystore.Load(a.path)
+	if err != nil {
+		return err
+	}
+	if err := store.UnlockKey(a.key); err != nil {
+		if errors.Is(err, keystore.ErrBadPassword) {
+			return errors.New("the master password has changed (run: dcx cred unlock)")
+		}
+		return err
+	}
+	if a.store != nil {
+		a.store.Lock()
+	}
+	a.store, a.modTime, a.size = store, info.ModTime(), info.Size()
+	return nil
+}
+
+// stop wipes the key and removes the socket
+func (a *credAgent) stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	clear(a.key)
+	a.key = nil
+	if a.store != nil {
+		a.store.Lock()
+	}
+	a.listener.Close()
+	os.Remove(a.socket)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// "dcx cred exec" hands secrets to one command without leaving them in the
+// calling shell: they are added to the command's environment only, or with
+// --files written to 0600 files in a memory-backed directory that is
+// removed when the command exits. Without --files the command replaces dcx
+// (on unix), so it keeps dcx's pid and gets its signals and exit code
+// first hand; with --files dcx waits for it to clean up, forwarding
+// signals, and then exits the same way it did.
+
+// credExecHidden are variables of dcx itself that the command (or the
+// credential agent) must not see
+var credExecHidden = []string{"DCX_KEYRING_PASSWORD", "DCX_KEYRING_NEW_PASSWORD", "DCX_RECOVERY_KEY"}
+
+// credExec handles "dcx cred exec [--prefix X] [--only K,...] [--map
+// key=VAR] [--files] -- command [args]"
+func credExec(args []string) {
+	var sel credSelection
+	var command []string
+	files := false
+	for i := 0; i < len(args) && command == nil; i++ {
+		next, ok, err := sel.parseFlag(args, i)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		switch {
+		case ok:
+			i = next
+		case args[i] == "--":
+			command = args[i+1:]
+		case args[i] == "--files":
+			files = true
+		case strings.HasPrefix(args[i], "-"):
+			fmt.Fprintf(os.Stderr, "Error: unknown option: %s\n", args[i])
+			os.Exit(1)
+		default:
+			command = args[i:]
+		}
+	}
+	if len(command) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx cred exec [--prefix X] [--only K,...] [--map key=VAR] [--files] -- <command> [args]")
+		os.Exit(1)
+	}
+
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(127)
+	}
+	store, err := openCredValues()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	vars, err := sel.resolve(store)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	env := os.Environ()
+	for _, name := range credExecHidden {
+		env = unsetEnv(env, name)
+	}
+	if !files {
+		err := execCommand(path, command, setEnv(env, vars))
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", command[0], err)
+		os.Exit(126)
+	}
+
+	dir, err := writeSecretFiles(vars)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fileVars := []envVar{{"DCX_CRED_DIR", dir}}
+	for _, v := range vars {
+		fileVars = append(fileVars, envVar{v.Name + "_FILE", filepath.Join(dir, v.Name)})
+	}
+	runCommand(path, command, setEnv(env, fileVars), func() { os.RemoveAll(dir) })
+}
+
+// runCommand runs a command, forwarding signals to it, calls cleanup once
+// it exits and exits with its status
+func runCommand(path string, command, env []string, cleanup func()) {
+	cmd := exec.Command(path, command[1:]...)
+	cmd.Args[0] = command[0]
+	cmd.Env = env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// terminal signals reach the command directly, being in our process
+	// group, so dcx only catches them (ignoring them would be inherited);
+	// the others are relayed
+	signals := make(chan os.Signal, 8)
+	signal.Notify(signals, append(terminalSignals, forwardedSignals...)...)
+	if err := cmd.Start(); err != nil {
+		cleanup()
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", command[0], err)
+		os.Exit(126)
+	}
+	go func() {
+		for sig := range signals {
+			if slices.Contains(forwardedSignals, sig) {
+				cmd.Process.Signal(sig)
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	signal.Stop(signals)
+	cleanup()
+	if cmd.ProcessState == nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", command[0], err)
+		os.Exit(1)
+	}
+	exitLike(cmd.ProcessState)
+}
+
+// secretFilesBase returns a memory-backed directory for secret files:
+// XDG_RUNTIME_DIR or /dev/shm, else the temp dir with a warning
+func secretFilesBase() string {
+	for _, dir := range []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"} {
+		if info, err := os.Stat(dir); dir != "" && err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Warning: no tmpfs found; secret files go to %s\n", os.TempDir())
+	return os.TempDir()
+}
+
+// writeSecretFiles writes each value to a 0600 file named after its
+// variable in a new 0700 directory
+func writeSecretFiles(vars []envVar) (string, error) {
+	dir, err := os.MkdirTemp(secretFilesBase(), "dcx-cred-")
+	if err != nil {
+		return "", err
+	}
+	for _, v := range vars {
+		if err := os.WriteFile(filepath.Join(dir, v.Name), []byte(v.Value), 0600); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// setEnv returns env with vars set, replacing earlier values
+func setEnv(env []string, vars []envVar) []string {
+	for _, v := range vars {
+		env = append(unsetEnv(env, v.Name), v.Name+"="+v.Value)
+	}
+	return env
+}
+
+// unsetEnv returns env without the variable name
+func unsetEnv(env []string, name string) []string {
+	out := env[:0:0]
+	for _, kv := range env {
+		if k, _, _ := strings.Cut(kv, "="); k != name {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Signals runCommand leaves to the terminal (catching them) and relays
+// to the command
+var (
+	terminalSignals  = []os.Signal{syscall.SIGINT, syscall.SIGQUIT}
+	forwardedSignals = []os.Signal{syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2}
+)
+
+// execCommand replaces dcx with the command; it returns only on failure
+func execCommand(path string, command, env []string) error {
+	return syscall.Exec(path, command, env)
+}
+
+// exitLike exits with the command's status, dying of the same signal if
+// a signal killed it
+func exitLike(state *os.ProcessState) {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		sig := ws.Signal()
+		signal.Reset(sig)
+		syscall.Kill(os.Getpid(), sig)
+		os.Exit(128 + int(sig))
+	}
+	os.Exit(state.ExitCode())
+}
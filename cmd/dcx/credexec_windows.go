@@ -0,0 +1,24 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// Signals runCommand leaves to the console (catching them) and relays to
+// the command; Ctrl-C already reaches every process attached to it
+var (
+	terminalSignals  = []os.Signal{os.Interrupt}
+	forwardedSignals []os.Signal
+)
+
+// execCommand runs the command and exits with its exit code; Windows
+// cannot replace a process
+func execCommand(path string, command, env []string) error {
+	runCommand(path, command, env, func() {})
+	return nil
+}
+
+// exitLike exits with the command's exit code
+func exitLike(state *os.ProcessState) {
+	os.Exit(state.ExitCode())
+}
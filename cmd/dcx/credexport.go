@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/datacosmos-br/dcx/internal/keystore"
+)
+
+// Output formats of "dcx cred export". shell is the only one meant for
+// eval; the others are data for plugins to parse (plugin contract, 3.4).
+var credExportFormats = []string{"shell", "env", "json", "dotenv", "nul"}
+
+// credSelection picks the credentials to export and names their variables
+type credSelection struct {
+	prefix string
+	only   []string          // credential keys or variable names
+	names  map[string]string // credential key -> variable name (--map)
+}
+
+// parseFlag consumes a --prefix, --only or --map flag at args[i] and
+// returns the index of its last argument; ok is false for other arguments
+func (sel *credSelection) parseFlag(args []string, i int) (next int, ok bool, err error) {
+	name, value, hasValue := strings.Cut(args[i], "=")
+	if name != "--prefix" && name != "--only" && name != "--map" {
+		return i, false, nil
+	}
+	if !hasValue {
+		if i+1 >= len(args) {
+			return i, true, fmt.Errorf("%s requires a value", name)
+		}
+		i++
+		value = args[i]
+	}
+
+	switch name {
+	case "--prefix":
+		sel.prefix = value
+	case "--only":
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				sel.only = append(sel.only, item)
+			}
+		}
+	case "--map":
+		key, envName, found := strings.Cut(value, "=")
+		if !found || !keystore.ValidKey(key) || !dotenvName.MatchString(envName) {
+			return i, true, fmt.Errorf("invalid --map %s (use service/env/name=VAR_NAME)", value)
+		}
+		if sel.names == nil {
+			sel.names = make(map[string]string)
+		}
+		sel.names[key] = envName
+	}
+	return i, true, nil
+}
+
+// resolve decrypts the selected credentials as variables: every key under
+// the prefix, named by --map or credEnvName, narrowed down by --only
+func (sel *credSelection) resolve(store credValues) ([]envVar, error) {
+	keys := store.Keys()
+	for key := range sel.names {
+		if !slices.Contains(keys, key) {
+			return nil, fmt.Errorf("--map: %w: %s", keystore.ErrNotFound, key)
+		}
+	}
+
+	var vars []envVar
+	matched := make(map[string]bool)
+	owner := make(map[string]string) // variable name -> key
+	for _, key := range keys {
+		if !strings.HasPrefix(key, sel.prefix) {
+			continue
+		}
+		name := sel.names[key]
+		if name == "" {
+			name = credEnvName(key)
+		}
+		if len(sel.only) > 0 {
+			if !slices.Contains(sel.only, key) && !slices.Contains(sel.only, name) {
+				continue
+			}
+			matched[key], matched[name] = true, true
+		}
+		if other, taken := owner[name]; taken {
+			return nil, fmt.Errorf("%s and %s both export %s (rename one with --map)", other, key, name)
+		}
+		owner[name] = key
+
+		value, err := store.Value(key)
+		if err != nil {
+			return nil, err
+		}
+		vars = append(vars, envVar{name, value})
+	}
+
+	for _, item := range sel.only {
+		if !matched[item] {
+			return nil, fmt.Errorf("--only %s: no credential under %q exports it", item, sel.prefix)
+		}
+	}
+	if len(vars) == 0 {
+		return nil, fmt.Errorf("no credentials found matching: %s*", sel.prefix)
+	}
+	return vars, nil
+}
+
+// credExport exports credentials as environment variables
+// (oracle/prod/password -> ORACLE_PROD_PASSWORD)
+func credExport(args []string) {
+	var sel credSelection
+	format := "shell"
+	for i := 0; i < len(args); i++ {
+		next, ok, err := sel.parseFlag(args, i)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if ok {
+			i = next
+			continue
+		}
+
+		switch name, value, hasValue := strings.Cut(args[i], "="); {
+		case name == "--format" && hasValue:
+			format = value
+		case name == "--format":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: --format requires a value")
+				os.Exit(1)
+			}
+			format = args[i+1]
+			i++
+		case args[i] == "--env":
+			format = "env"
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown option: %s\n", args[i])
+			fmt.Fprintln(os.Stderr, "Usage: dcx cred export [--prefix X] [--only K,...] [--map key=VAR] [--format shell|env|json|dotenv|nul]")
+			os.Exit(1)
+		}
+	}
+	if format == "null-delimited" {
+		format = "nul"
+	}
+	if !slices.Contains(credExportFormats, format) {
+		fmt.Fprintf(os.Stderr, "Error: unknown format: %s (use %s)\n", format, strings.Join(credExportFormats, ", "))
+		os.Exit(1)
+	}
+
+	store, err := openCredValues()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	vars, err := sel.resolve(store)
+	if err == nil {
+		switch format {
+		case "shell":
+			err = writeEnv(os.Stdout, "bash", vars)
+		case "nul":
+			err = writeEnvData(os.Stdout, "null-delimited", vars)
+		default:
+			err = writeEnvData(os.Stdout, format, vars)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// credEnvName turns a credential key into an environment variable name
+func credEnvName(key string) string {
+	return strings.ToUpper(strings.NewReplacer("/", "_", "-", "_").Replace(key))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/datacosmos-br/dcx/internal/keystore"
+)
+
+// Unlocking allows maxUnlockAttempts passwords per prompt, waiting longer
+// after each wrong one. With cred.lockout set, failures are also counted
+// in <store>.failures across processes: from the maxUnlockAttempts-th
+// failure on, the next try has to wait cred.lockout_delay seconds,
+// doubled for every further failure. A correct password resets the count.
+
+const (
+	maxUnlockAttempts = 3
+	unlockBackoff     = time.Second
+	maxLockoutDelay   = 24 * time.Hour
+)
+
+// errLockedOut is returned while failed unlocks delay further tries
+var errLockedOut = errors.New("too many failed unlock attempts")
+
+// unlockCredStore unlocks the store with DCX_KEYRING_PASSWORD, which is
+// tried once, or with up to maxUnlockAttempts prompted passwords
+func unlockCredStore(store *keystore.Store) error {
+	lockout := loadCredLockout(store.Path())
+	if err := lockout.check(); err != nil {
+		return err
+	}
+
+	if password := os.Getenv("DCX_KEYRING_PASSWORD"); password != "" {
+		return lockout.record(store.Unlock(password))
+	}
+	for attempt := 1; ; attempt++ {
+		password, err := readMasterPassword("Enter master password")
+		if err != nil {
+			return err
+		}
+		err = lockout.record(store.Unlock(password))
+		if !errors.Is(err, keystore.ErrBadPassword) {
+			return err
+		}
+		if attempt == maxUnlockAttempts {
+			return fmt.Errorf("authentication failed after %d attempts", maxUnlockAttempts)
+		}
+		fmt.Fprintln(os.Stderr, "[ERROR] Wrong master password")
+		time.Sleep(unlockBackoff << (attempt - 1))
+		if err := lockout.check(); err != nil {
+			return err
+		}
+	}
+}
+
+// credLockout is the persistent failed-unlock counter of a store
+type credLockout struct {
+	path     string // "" when cred.lockout is off
+	delay    time.Duration
+	failures int
+	last     time.Time
+}
+
+// loadCredLockout reads the counter of the store at path
+func loadCredLockout(path string) *credLockout {
+	l := &credLockout{}
+	ec, err := loadEffectiveConfig(configOptions{})
+	if err != nil {
+		return l
+	}
+	if node := ec.lookup("cred.lockout"); node == nil || node.Value != "true" {
+		return l
+	}
+	l.path = path + ".failures"
+	l.delay = 30 * time.Second
+	if node := ec.lookup("cred.lockout_delay"); node != nil {
+		if seconds, err := strconv.Atoi(node.Value); err == nil && seconds >= 0 {
+			l.delay = time.Duration(seconds) * time.Second
+		}
+	}
+
+	// "<failures> <unix time of the last one>"
+	if data, err := os.ReadFile(l.path); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) == 2 {
+			l.failures, _ = strconv.Atoi(fields[0])
+			if unix, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				l.last = time.Unix(unix, 0)
+			}
+		}
+	}
+	return l
+}
+
+// check fails while the counted failures still delay a try
+func (l *credLockout) check() error {
+	if l.path == "" || l.failures < maxUnlockAttempts {
+		return nil
+	}
+	wait := min(l.delay<<(l.failures-maxUnlockAttempts), maxLockoutDelay)
+	if remaining := time.Until(l.last.Add(wait)); remaining > 0 {
+		return fmt.Errorf("%w (%d); try again in %s", errLockedOut, l.failures, remaining.Round(time.Second))
+	}
+	return nil
+}
+
+// record counts a failed unlock or clears the count after a good one,
+// and returns err
+func (l *credLockout) record(err error) error {
+	switch {
+	case l.path == "":
+	case err == nil:
+		if l.failures > 0 {
+			os.Remove(l.path)
+			l.failures = 0
+		}
+	case errors.Is(err, keystore.ErrBadPassword):
+		l.failures++
+		l.last = time.Now()
+		data := fmt.Sprintf("%d %d\n", l.failures, l.last.Unix())
+		if werr := writeFileAtomicMode(l.path, []byte(data), false, 0600); werr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: cannot record failed unlock: %v\n", werr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/datacosmos-br/dcx/internal/keystore"
+)
+
+// credPasswd changes the master password. Every value is re-encrypted
+// under the new key and the file is replaced in one rename, so it is
+// readable with either the old password or the new one, never a mix.
+func credPasswd(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx cred passwd")
+		os.Exit(1)
+	}
+
+	store, lock, err := editCredStore(false, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer lock.unlock()
+
+	password, err := newMasterPassword("DCX_KEYRING_NEW_PASSWORD", "New master password", "Confirm new master password")
+	if err == nil {
+		err = store.Rekey(password)
+	}
+	if err == nil && !store.Recoverable() {
+		// the old recovery key cannot unlock the store; issue one that can
+		var recoveryKey string
+		if recoveryKey, err = store.ResetRecoveryKey(); err == nil {
+			showRecoveryKey(recoveryKey)
+		}
+	}
+	if err == nil {
+		err = store.Save()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("[INFO] Master password changed: %s (%d credentials re-encrypted)\n", store.Path(), len(store.Keys()))
+}
+
+// credRecover resets a forgotten master password: the recovery key
+// unlocks the store, the values are re-encrypted under a new password and
+// a new recovery key replaces the used one
+func credRecover(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx cred recover")
+		os.Exit(1)
+	}
+
+	lock, err := lockFile(credFile())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer lock.unlock()
+
+	store, err := loadCredStore()
+	if err == nil {
+		err = recoverCredStore(store)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	password, err := newMasterPassword("DCX_KEYRING_NEW_PASSWORD", "New master password", "Confirm new master password")
+	var recoveryKey string
+	if err == nil {
+		err = store.Rekey(password)
+	}
+	if err == nil {
+		recoveryKey, err = store.ResetRecoveryKey()
+	}
+	if err == nil {
+		showRecoveryKey(recoveryKey)
+		err = store.Save()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// the failed unlocks that led here no longer count
+	loadCredLockout(store.Path()).record(nil)
+	fmt.Printf("[INFO] Master password reset: %s (the old recovery key no longer works)\n", store.Path())
+}
+
+// recoverCredStore unlocks the store with DCX_RECOVERY_KEY or a prompted
+// recovery key
+func recoverCredStore(store *keystore.Store) error {
+	recoveryKey := os.Getenv("DCX_RECOVERY_KEY")
+	if recoveryKey == "" {
+		var err error
+		recoveryKey, err = readPassword("Recovery key")
+		if errors.Is(err, errNoTerminal) {
+			return errors.New("no terminal to ask for the recovery key (set DCX_RECOVERY_KEY)")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return store.Recover(recoveryKey)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Sources of the value "dcx cred set" stores. Values given on the command
+// line end up in shell history and /proc/<pid>/cmdline, so the others are
+// preferred: a prompt without echo (the default), stdin, a file, an
+// environment variable, or a secret generated in place.
+
+// Character sets for --generate --charset
+var secretCharsets = map[string]string{
+	"alnum":   "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"alpha":   "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+	"digits":  "0123456789",
+	"hex":     "0123456789abcdef",
+	"symbols": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!#%+,-./:=?@^_~",
+}
+
+const defaultSecretLength = 32
+
+// errCredSetUsage reports missing or extra arguments
+var errCredSetUsage = errors.New("usage")
+
+// credValueSource is where credSet reads the value from
+type credValueSource struct {
+	literal   *string // value given as an argument
+	stdin     bool
+	file      string
+	env       string
+	generate  bool
+	length    int
+	charset   string
+	generated bool // set by read for the summary line
+}
+
+// parseCredSetArgs splits "set <key> [value] [--stdin | --from-file F |
+// --from-env VAR | --generate [--length N] [--charset C]]"
+func parseCredSetArgs(args []string) (string, *credValueSource, error) {
+	src := &credValueSource{length: defaultSecretLength, charset: "alnum"}
+	var positional []string
+	lengthSet, charsetSet := false, false
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, value, hasValue := strings.Cut(arg, "=")
+		switch name {
+		case "--stdin":
+			src.stdin = true
+		case "--generate":
+			src.generate = true
+		case "--from-file", "--from-env", "--length", "--charset":
+			if !hasValue {
+				if i+1 >= len(args) {
+					return "", nil, fmt.Errorf("%s requires a value", name)
+				}
+				value = args[i+1]
+				i++
+			}
+			switch name {
+			case "--from-file":
+				src.file = value
+			case "--from-env":
+				src.env = value
+			case "--length":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 1 || n > 4096 {
+					return "", nil, fmt.Errorf("invalid --length: %s (1-4096)", value)
+				}
+				src.length, lengthSet = n, true
+			case "--charset":
+				src.charset, charsetSet = value, true
+			}
+		default:
+			if strings.HasPrefix(arg, "--") {
+				return "", nil, fmt.Errorf("unknown option: %s", arg)
+			}
+			positional = append(positional, arg)
+		}
+	}
+
+	if len(positional) == 0 || len(positional) > 2 {
+		return "", nil, errCredSetUsage
+	}
+	if len(positional) == 2 {
+		src.literal = &positional[1]
+	}
+
+	sources := 0
+	for _, set := range []bool{src.literal != nil, src.stdin, src.file != "", src.env != "", src.generate} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return "", nil, errors.New("give the value only one way: argument, --stdin, --from-file, --from-env or --generate")
+	}
+	if (lengthSet || charsetSet) && !src.generate {
+		return "", nil, errors.New("--length and --charset only apply to --generate")
+	}
+	return positional[0], src, nil
+}
+
+// read returns the value, which must not be empty whatever its source.
+// Stdin and files lose one trailing newline, so `echo secret | dcx cred
+// set KEY --stdin` stores "secret".
+func (src *credValueSource) read(key string) (string, error) {
+	value, err := src.readSource(key)
+	if err == nil && value == "" {
+		err = errors.New("empty value")
+	}
+	return value, err
+}
+
+// readSource reads the value from its source
+func (src *credValueSource) readSource(key string) (string, error) {
+	switch {
+	case src.literal != nil:
+		return *src.literal, nil
+	case src.stdin:
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		return trimNewline(string(data)), nil
+	case src.file != "":
+		data, err := os.ReadFile(src.file)
+		if err != nil {
+			return "", err
+		}
+		return trimNewline(string(data)), nil
+	case src.env != "":
+		value, ok := os.LookupEnv(src.env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", src.env)
+		}
+		return value, nil
+	case src.generate:
+		src.generated = true
+		return generateSecret(src.length, src.charset)
+	default:
+		value, err := readPassword("Value for " + key)
+		if errors.Is(err, errNoTerminal) {
+			return "", errors.New("no terminal to ask for the value (use --stdin, --from-file or --from-env)")
+		}
+		return value, err
+	}
+}
+
+// generateSecret returns length characters drawn uniformly from a named
+// charset, or from the characters of charset itself
+func generateSecret(length int, charset string) (string, error) {
+	chars := []rune(charset)
+	if named, ok := secretCharsets[charset]; ok {
+		chars = []rune(named)
+	}
+	if len(chars) < 2 {
+		return "", fmt.Errorf("charset %q needs at least 2 characters", charset)
+	}
+
+	size := big.NewInt(int64(len(chars)))
+	out := make([]rune, length)
+	for i := range out {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+		out[i] = chars[n.Int64()]
+	}
+	return string(out), nil
+}
+
+func trimNewline(s string) string {
+	s = strings.TrimSuffix(s, "\n")
+	return strings.TrimSuffix(s, "\r")
+}
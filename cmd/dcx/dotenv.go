@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// dotenv support for the config file commands. A .env file is a flat
+// mapping of variable names to strings. Writing keeps comments and the
+// lines of unchanged variables; nested maps are flattened with "_"
+// (database.host -> DATABASE_HOST), as are key paths, and lists are
+// written as JSON.
+
+// dotenvEntry is one assignment in a .env file
+type dotenvEntry struct {
+	key       string
+	value     string
+	export    bool
+	line      int // first line, 1-based
+	lastLine  int
+	keyColumn int
+}
+
+var (
+	dotenvName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	dotenvSafe = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+)
+
+// parseDotenv reads the assignments of a .env file in order
+func parseDotenv(data []byte) ([]dotenvEntry, error) {
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+	var entries []dotenvEntry
+
+	for n := 0; n < len(lines); n++ {
+		line := strings.TrimLeft(lines[n], " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entry := dotenvEntry{line: n + 1, lastLine: n + 1, keyColumn: len(lines[n]) - len(line) + 1}
+		if rest := strings.TrimPrefix(line, "export"); rest != line && (strings.HasPrefix(rest, " ") || strings.HasPrefix(rest, "\t")) {
+			entry.export = true
+			trimmed := strings.TrimLeft(rest, " \t")
+			entry.keyColumn += len(line) - len(trimmed)
+			line = trimmed
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: expected KEY=value", n+1)
+		}
+		entry.key = strings.TrimRight(line[:eq], " \t")
+		if !dotenvName.MatchString(entry.key) {
+			return nil, fmt.Errorf("line %d: invalid variable name %q", n+1, entry.key)
+		}
+		raw := strings.TrimLeft(line[eq+1:], " \t")
+
+		switch {
+		case strings.HasPrefix(raw, "'"):
+			end := strings.IndexByte(raw[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated quote", n+1)
+			}
+			entry.value = raw[1 : end+1]
+
+		case strings.HasPrefix(raw, `"`):
+			// double quotes may span lines and take escapes
+			var b strings.Builder
+			text := raw[1:]
+			for closed := false; !closed; {
+				for i := 0; i < len(text); i++ {
+					c := text[i]
+					if c == '"' {
+						closed = true
+						break
+					}
+					if c == '\\' && i+1 < len(text) {
+						i++
+						switch text[i] {
+						case 'n':
+							b.WriteByte('\n')
+						case 't':
+							b.WriteByte('\t')
+						case 'r':
+							b.WriteByte('\r')
+						case '"', '\\', '$', '`':
+							b.WriteByte(text[i])
+						default:
+							b.WriteByte('\\')
+							b.WriteByte(text[i])
+						}
+						continue
+					}
+					b.WriteByte(c)
+				}
+				if !closed {
+					if n+1 >= len(lines) {
+						return nil, fmt.Errorf("line %d: unterminated quote", entry.line)
+					}
+					n++
+					text = lines[n]
+					b.WriteByte('\n')
+					entry.lastLine = n + 1
+				}
+			}
+			entry.value = b.String()
+
+		default:
+			if i := strings.Index(raw, " #"); i >= 0 {
+				raw = raw[:i]
+			}
+			entry.value = strings.TrimRight(raw, " \t")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// decodeDotenv parses a .env file into a mapping of strings; a repeated
+// variable keeps its last value, as when the file is sourced
+func decodeDotenv(data []byte) (*yaml.Node, error) {
+	entries, err := parseDotenv(data)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: 1, Column: 1}
+	for _, e := range entries {
+		value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: e.value, Line: e.line, Column: e.keyColumn + len(e.key) + 1}
+		if idx := mappingIndex(root, e.key); idx >= 0 {
+			root.Content[idx+1] = value
+			continue
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: e.key, Line: e.line, Column: e.keyColumn}
+		root.Content = append(root.Content, key, value)
+	}
+	return root, nil
+}
+
+// encodeDotenv renders a mapping as a .env file. Lines of original are
+// kept for variables whose value did not change, rewritten for changed
+// ones and dropped for removed ones; new variables are appended.
+func encodeDotenv(root *yaml.Node, original []byte) ([]byte, error) {
+	root = resolveAlias(root)
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("dotenv files must be mappings")
+	}
+
+	var names []string
+	values := make(map[string]string)
+	if err := flattenDotenv("", root, &names, values); err != nil {
+		return nil, err
+	}
+
+	// an unparsable original is simply replaced
+	entries, err := parseDotenv(original)
+	if err != nil {
+		original = nil
+	}
+	byLine := make(map[int]dotenvEntry)
+	for _, e := range entries {
+		byLine[e.line] = e
+	}
+	var out strings.Builder
+	written := make(map[string]bool)
+
+	lines := strings.SplitAfter(string(original), "\n")
+	for n := 0; n < len(lines); n++ {
+		entry, ok := byLine[n+1]
+		if !ok {
+			if lines[n] != "" {
+				out.WriteString(lines[n])
+			}
+			continue
+		}
+
+		value, ok := values[entry.key]
+		switch {
+		case !ok:
+			// removed
+		case value == entry.value:
+			for _, line := range lines[n:entry.lastLine] {
+				out.WriteString(line)
+			}
+		default:
+			out.WriteString(lines[n][:len(lines[n])-len(strings.TrimLeft(lines[n], " \t"))])
+			if entry.export {
+				out.WriteString("export ")
+			}
+			out.WriteString(entry.key + "=" + quoteDotenv(value) + "\n")
+		}
+		written[entry.key] = ok
+		n = entry.lastLine - 1
+	}
+
+	if out.Len() > 0 && !strings.HasSuffix(out.String(), "\n") {
+		out.WriteString("\n")
+	}
+	for _, name := range names {
+		if _, seen := written[name]; !seen {
+			out.WriteString(name + "=" + quoteDotenv(values[name]) + "\n")
+		}
+	}
+	return []byte(out.String()), nil
+}
+
+// flattenDotenv collects the variables of a mapping in order, joining
+// nested keys with "_"
+func flattenDotenv(prefix string, mapping *yaml.Node, names *[]string, values map[string]string) error {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		name := mapping.Content[i].Value
+		if prefix != "" {
+			name = toolEnvVar(prefix + "_" + name)
+		}
+		value := resolveAlias(mapping.Content[i+1])
+
+		if value.Kind == yaml.MappingNode {
+			if err := flattenDotenv(name, value, names, values); err != nil {
+				return err
+			}
+			continue
+		}
+		if !dotenvName.MatchString(name) {
+			return fmt.Errorf("%s is not a valid variable name", name)
+		}
+
+		text := value.Value
+		switch {
+		case value.Kind == yaml.SequenceNode:
+			out, err := nodeToJSON(value, false)
+			if err != nil {
+				return err
+			}
+			text = string(out)
+		case value.ShortTag() == "!!null":
+			text = ""
+		}
+		if _, ok := values[name]; !ok {
+			*names = append(*names, name)
+		}
+		values[name] = text
+	}
+	return nil
+}
+
+// dotenvPath maps a nested key path to the variable it is written as
+// (database.host -> DATABASE_HOST), so lookups find what set wrote; other
+// paths are returned as they are
+func dotenvPath(segs []pathSegment) []pathSegment {
+	if len(segs) < 2 {
+		return segs
+	}
+	keys := make([]string, len(segs))
+	for i, seg := range segs {
+		if seg.kind != segmentKey {
+			return segs
+		}
+		keys[i] = seg.key
+	}
+	return []pathSegment{{kind: segmentKey, key: toolEnvVar(strings.Join(keys, "_"))}}
+}
+
+// quoteDotenv quotes a value only when it needs it
+func quoteDotenv(value string) string {
+	switch {
+	case dotenvSafe.MatchString(value):
+		return value
+	case !strings.ContainsAny(value, "'\n"):
+		return "'" + value + "'"
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`", "\n", `\n`)
+	return `"` + r.Replace(value) + `"`
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config layer names, lowest precedence first
+const (
+	layerProject  = "project"
+	layerDefaults = "defaults"
+	layerSystem   = "system"
+	layerGlobal   = "global"
+	layerLocal    = "local"
+	layerEnv      = "env"
+	layerFlags    = "flags"
+)
+
+// configLayer is one source of the effective configuration
+type configLayer struct {
+	Name string
+	File string     // empty for env and flags
+	Root *yaml.Node // mapping node; nil when the file is missing or empty
+}
+
+// configOrigin records where a value of the effective config came from
+type configOrigin struct {
+	Layer string
+	File  string
+	Line  int
+}
+
+// String formats the origin as "layer (file:line)"
+func (o configOrigin) String() string {
+	switch {
+	case o.File != "" && o.Line > 0:
+		return fmt.Sprintf("%s (%s:%d)", o.Layer, o.File, o.Line)
+	case o.File != "":
+		return fmt.Sprintf("%s (%s)", o.Layer, o.File)
+	default:
+		return o.Layer
+	}
+}
+
+// EffectiveConfig is the merge of every config layer, with provenance
+type EffectiveConfig struct {
+	Root    *yaml.Node
+	Layers  []configLayer
+	Profile configProfile
+	origins map[*yaml.Node]configOrigin
+}
+
+// configOptions holds the flags shared by the config subcommands
+type configOptions struct {
+	explain    bool
+	jsonOutput bool
+	raw        bool     // --no-interpolate
+	strict     bool     // --strict: undefined ${...} is an error
+	secrets    bool     // --resolve-secrets
+	profile    string   // --profile
+	overrides  []string // --set key=value
+}
+
+// parseConfigOptions extracts the shared config flags from args and
+// returns the remaining positional arguments
+func parseConfigOptions(args []string) (configOptions, []string, error) {
+	var opts configOptions
+	var rest []string
+
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--explain":
+			opts.explain = true
+		case arg == "--json":
+			opts.jsonOutput = true
+		case arg == "--no-interpolate":
+			opts.raw = true
+		case arg == "--strict":
+			opts.strict = true
+		case arg == "--resolve-secrets":
+			opts.secrets = true
+		case arg == "--set":
+			if i+1 >= len(args) {
+				return opts, nil, fmt.Errorf("--set requires key=value")
+			}
+			opts.overrides = append(opts.overrides, args[i+1])
+			i++
+		case strings.HasPrefix(arg, "--set="):
+			opts.overrides = append(opts.overrides, strings.TrimPrefix(arg, "--set="))
+		case arg == "--profile":
+			if i+1 >= len(args) {
+				return opts, nil, fmt.Errorf("--profile requires a name")
+			}
+			opts.profile = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--profile="):
+			opts.profile = strings.TrimPrefix(arg, "--profile=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return opts, rest, nil
+}
+
+// getSystemConfigDir returns the system-wide config directory
+// (DCX_SYSTEM_CONFIG_DIR, defaulting to /etc/dcx)
+func getSystemConfigDir() string {
+	if dir := os.Getenv("DCX_SYSTEM_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	return "/etc/dcx"
+}
+
+// findLocalConfig returns the nearest .dcx/config.yaml walking up from the
+// working directory, or "" if there is none
+func findLocalConfig() string {
+	return findNearest(filepath.Join(".dcx", "config.yaml"))
+}
+
+// findNearest returns the nearest rel (a path relative to a directory)
+// walking up from the working directory, or "" if there is none
+func findNearest(rel string) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		candidate := filepath.Join(dir, rel)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// configLayerFiles returns the file-backed layers in precedence order
+func configLayerFiles() []configLayer {
+	return []configLayer{
+		{Name: layerProject, File: filepath.Join(getEtcDir(), "project.yaml")},
+		{Name: layerDefaults, File: filepath.Join(getEtcDir(), "defaults.yaml")},
+		{Name: layerSystem, File: filepath.Join(getSystemConfigDir(), "config.yaml")},
+		{Name: layerGlobal, File: filepath.Join(getUserConfigDir(), "config.yaml")},
+		{Name: layerLocal, File: findLocalConfig()},
+	}
+}
+
+// loadYAMLMapping reads a YAML file and returns its top-level mapping.
+// Missing and empty files yield a nil node and no error.
+func loadYAMLMapping(path string) (*yaml.Node, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: top level must be a mapping", path)
+	}
+	return root, nil
+}
+
+// loadEffectiveConfig merges defaults, system, global, local, DCX_* env
+// vars and --set flags, later layers overriding earlier ones. The active
+// profile's overlays follow the file they belong to.
+// Mappings are merged key by key; scalars and lists are replaced.
+func loadEffectiveConfig(opts configOptions) (*EffectiveConfig, error) {
+	ec := &EffectiveConfig{
+		Root:    &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"},
+		origins: make(map[*yaml.Node]configOrigin),
+	}
+
+	profile, err := selectProfile(opts.profile)
+	if err != nil {
+		return nil, err
+	}
+	ec.Profile = profile
+
+	profileFound := false
+	for _, layer := range configLayerFiles() {
+		root, err := loadYAMLMapping(layer.File)
+		if err != nil {
+			return nil, err
+		}
+		layer.Root = root
+		ec.Layers = append(ec.Layers, layer)
+		if root != nil {
+			ec.merge(withoutProfiles(root), layer)
+		}
+		if profile.Name == "" || layer.File == "" {
+			continue
+		}
+
+		// profiles.<name> in the file, then the <file>.<name>.yaml sibling
+		overlay, err := profileOverlay(root, layer.File, profile.Name)
+		if err != nil {
+			return nil, err
+		}
+		name := layer.Name + ":" + profile.Name
+		if overlay != nil {
+			profileFound = true
+			l := configLayer{Name: name, File: layer.File, Root: overlay}
+			ec.Layers = append(ec.Layers, l)
+			ec.merge(overlay, l)
+		}
+		if sibling := profileFile(layer.File, profile.Name); isFile(sibling) {
+			siblingRoot, err := loadYAMLMapping(sibling)
+			if err != nil {
+				return nil, err
+			}
+			profileFound = true
+			l := configLayer{Name: name, File: sibling, Root: siblingRoot}
+			ec.Layers = append(ec.Layers, l)
+			if siblingRoot != nil {
+				ec.merge(withoutProfiles(siblingRoot), l)
+			}
+		}
+	}
+	if profile.Name != "" {
+		if !profileFound {
+			return nil, fmt.Errorf("profile %q (%s) is not defined: no %s.%s section or config.%s.yaml file found",
+				profile.Name, profile.Source, profilesKey, profile.Name, profile.Name)
+		}
+		// ${DCX_PROFILE} in values, and processes dcx starts, see it
+		os.Setenv("DCX_PROFILE", profile.Name)
+	}
+
+	if envRoot := ec.envLayer(); len(envRoot.Content) > 0 {
+		layer := configLayer{Name: layerEnv, Root: envRoot}
+		ec.Layers = append(ec.Layers, layer)
+		ec.merge(envRoot, layer)
+	}
+
+	if len(opts.overrides) > 0 {
+		flagsRoot := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, override := range opts.overrides {
+			key, value, ok := strings.Cut(override, "=")
+			if !ok || key == "" {
+				return nil, fmt.Errorf("invalid --set %q: expected key=value", override)
+			}
+			segs, err := parseKeyPath(key)
+			if err == nil {
+				err = setPath(flagsRoot, segs, scalarNode(value))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid --set %q: %w", override, err)
+			}
+		}
+		layer := configLayer{Name: layerFlags, Root: flagsRoot}
+		ec.Layers = append(ec.Layers, layer)
+		ec.merge(flagsRoot, layer)
+	}
+
+	return ec, nil
+}
+
+// envLayer maps DCX_* environment variables onto keys already defined by
+// the file layers: log.level <- DCX_LOG_LEVEL, parallel.max_jobs <-
+// DCX_PARALLEL_MAX_JOBS. Variables matching no key (DCX_HOME, ...) are
+// ignored so they cannot shadow config by accident.
+func (ec *EffectiveConfig) envLayer() *yaml.Node {
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	ec.walkLeaves(func(path string, node *yaml.Node) {
+		if value, ok := os.LookupEnv(configEnvName(path)); ok {
+			if segs, err := parseKeyPath(path); err == nil {
+				setPath(root, segs, scalarNode(value))
+			}
+		}
+	})
+	return root
+}
+
+// configEnvName returns the DCX_* variable that overrides a config key
+func configEnvName(key string) string {
+	return "DCX_" + toolEnvVar(key)
+}
+
+// merge overlays src (a mapping from layer) onto the effective root
+func (ec *EffectiveConfig) merge(src *yaml.Node, layer configLayer) {
+	ec.mergeMapping(ec.Root, src, layer)
+}
+
+func (ec *EffectiveConfig) mergeMapping(dst, src *yaml.Node, layer configLayer) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+
+		idx := mappingIndex(dst, key.Value)
+		if idx >= 0 && dst.Content[idx+1].Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+			ec.mergeMapping(dst.Content[idx+1], value, layer)
+			continue
+		}
+
+		copied := ec.copyWithOrigin(value, layer)
+		if idx >= 0 {
+			dst.Content[idx+1] = copied
+		} else {
+			dst.Content = append(dst.Content, ec.copyWithOrigin(key, layer), copied)
+		}
+	}
+}
+
+// copyWithOrigin deep-copies a node tree, recording layer as the origin of
+// every node so layer documents are never mutated by later merges.
+// Comments are dropped: they describe the layer file, not the merge.
+func (ec *EffectiveConfig) copyWithOrigin(node *yaml.Node, layer configLayer) *yaml.Node {
+	copied := *node
+	copied.Content = nil
+	copied.HeadComment, copied.LineComment, copied.FootComment = "", "", ""
+	for _, child := range node.Content {
+		copied.Content = append(copied.Content, ec.copyWithOrigin(child, layer))
+	}
+	ec.origins[&copied] = configOrigin{Layer: layer.Name, File: layer.File, Line: node.Line}
+	return &copied
+}
+
+// lookup returns the node at a key path, or nil
+func (ec *EffectiveConfig) lookup(key string) *yaml.Node {
+	segs, err := parseKeyPath(key)
+	if err != nil {
+		return nil
+	}
+	return findNode(ec.Root, segs)
+}
+
+// origin returns where node came from
+func (ec *EffectiveConfig) origin(node *yaml.Node) configOrigin {
+	return ec.origins[node]
+}
+
+// walkLeaves calls fn for every scalar or list in the effective config
+// with its key path, in document order
+func (ec *EffectiveConfig) walkLeaves(fn func(path string, node *yaml.Node)) {
+	walkMappingLeaves(ec.Root, "", fn)
+}
+
+func walkMappingLeaves(node *yaml.Node, prefix string, fn func(path string, node *yaml.Node)) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		path := joinKeyPath(prefix, node.Content[i].Value)
+		if value := node.Content[i+1]; value.Kind == yaml.MappingNode {
+			walkMappingLeaves(value, path, fn)
+		} else {
+			fn(path, value)
+		}
+	}
+}
+
+// mappingIndex returns the index of key's key node in a mapping, or -1
+func mappingIndex(mapping *yaml.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveAlias returns the anchored node an alias points to
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// scalarNode builds a plain scalar whose tag is resolved from its value
+func scalarNode(value string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	node.Tag = node.ShortTag()
+	return node
+}
+
+// renderValue formats a node for display: scalars raw, others as YAML
+func renderValue(node *yaml.Node) string {
+	if node.Kind == yaml.ScalarNode {
+		return node.Value
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	enc.Encode(node)
+	enc.Close()
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+// renderInline formats a node on a single line (flow style for lists/maps)
+func renderInline(node *yaml.Node) string {
+	if node.Kind == yaml.ScalarNode {
+		return node.Value
+	}
+	flow := *node
+	flow.Style = yaml.FlowStyle
+	return renderValue(&flow)
+}
+
+// configEffective prints the merged configuration
+func configEffective(opts configOptions) {
+	if opts.secrets {
+		fmt.Fprintln(os.Stderr, "Error: --resolve-secrets only applies to config get")
+		os.Exit(1)
+	}
+
+	ec, err := loadEffectiveConfig(opts)
+	if err == nil && !opts.raw {
+		err = newInterpolator(ec.Root, opts.strict).expandTree(ec.Root, nil)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if opts.explain {
+		var lines [][2]string
+		width := 0
+		ec.walkLeaves(func(path string, node *yaml.Node) {
+			line := fmt.Sprintf("%s = %s", path, renderInline(node))
+			if len(line) > width {
+				width = len(line)
+			}
+			lines = append(lines, [2]string{line, ec.origin(node).String()})
+		})
+		for _, l := range lines {
+			fmt.Printf("%-*s  # %s\n", width, l[0], l[1])
+		}
+		return
+	}
+
+	if opts.jsonOutput {
+		v, err := nodeToJSONValue(ec.Root)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		printJSON(v)
+		return
+	}
+
+	fmt.Println(renderValue(ec.Root))
+}
+
+// configLayersSummary lists each layer and whether it contributed
+func configLayersSummary(ec *EffectiveConfig) []string {
+	width := 9
+	for _, layer := range ec.Layers {
+		width = max(width, len(layer.Name))
+	}
+	var lines []string
+	for _, layer := range ec.Layers {
+		source := layer.File
+		if source == "" {
+			source = "-"
+		}
+		status := "loaded"
+		if layer.Root == nil {
+			status = "missing"
+		}
+		lines = append(lines, fmt.Sprintf("%-*s %-8s %s", width, layer.Name, status, source))
+	}
+	return lines
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dcxEnvironment collects everything a shell needs from DCX in one pass:
+// DCX_* paths, the platform, plugin bin dirs and one variable per known
+// binary (GUM, YQ, RG, ...). Missing binaries fall back to their bare name
+// so scripts can still rely on PATH lookup.
+func dcxEnvironment() []envVar {
+	vars := []envVar{
+		{"DCX_HOME", getDCHome()},
+		{"DCX_BIN_DIR", getBinDir()},
+		{"DCX_LIB_DIR", getLibDir()},
+		{"DCX_ETC_DIR", getEtcDir()},
+		{"DCX_CACHE_DIR", getCacheDir()},
+		{"DCX_CONFIG_DIR", getUserConfigDir()},
+		{"DCX_PLATFORM", detectPlatform()},
+	}
+
+	var pluginBins []string
+	for _, plugin := range discoverPlugins() {
+		binDir := filepath.Join(plugin.Dir, "bin")
+		if info, err := os.Stat(binDir); err == nil && info.IsDir() {
+			if abs, err := filepath.Abs(binDir); err == nil {
+				binDir = abs
+			}
+			pluginBins = append(pluginBins, binDir)
+		}
+	}
+	vars = append(vars, envVar{"DCX_PLUGIN_BIN_DIRS", strings.Join(pluginBins, ":")})
+
+	binaries, _ := knownBinaries()
+	for _, b := range binaries {
+		path, err := findBinary(b.Name)
+		if err != nil {
+			path = b.Name
+		}
+		vars = append(vars, envVar{toolEnvVar(b.Name), path})
+	}
+
+	return vars
+}
+
+// toolEnvVar returns the environment variable exported for a tool,
+// e.g. "yq" -> "YQ", "ast-grep" -> "AST_GREP"
+func toolEnvVar(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// defaultShell guesses the --shell format from $SHELL
+func defaultShell() string {
+	switch shell := filepath.Base(os.Getenv("SHELL")); shell {
+	case "zsh", "fish":
+		return shell
+	default:
+		return "bash"
+	}
+}
+
+// handleEnv handles the "dcx env" command
+func handleEnv(args []string) {
+	shell := defaultShell()
+	profileFlag := ""
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--shell", "-s":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: --shell requires a value")
+				os.Exit(1)
+			}
+			shell = args[i+1]
+			i++
+		case "--profile":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: --profile requires a name")
+				os.Exit(1)
+			}
+			profileFlag = args[i+1]
+			i++
+		case "help", "-h", "--help":
+			printEnvHelp()
+			return
+		default:
+			if value, ok := strings.CutPrefix(args[i], "--shell="); ok {
+				shell = value
+				continue
+			}
+			if value, ok := strings.CutPrefix(args[i], "--profile="); ok {
+				profileFlag = value
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Unknown option: %s\n", args[i])
+			os.Exit(1)
+		}
+	}
+
+	if !isShellFormat(shell) {
+		fmt.Fprintf(os.Stderr, "Error: unknown shell: %s (use %s)\n", shell, strings.Join(shellFormats, ", "))
+		os.Exit(1)
+	}
+
+	profile, err := selectProfile(profileFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	vars := dcxEnvironment()
+	if profile.Name != "" {
+		vars = append(vars, envVar{"DCX_PROFILE", profile.Name})
+	}
+
+	if err := writeEnv(os.Stdout, shell, vars); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func printEnvHelp() {
+	fmt.Println(`Usage: dcx env [--shell bash|zsh|fish|env] [--profile NAME]
+
+Prints the whole DCX environment in a single call: DCX_* paths, the
+platform, plugin bin dirs and one variable per known binary (GUM, YQ, ...).
+DCX_PROFILE is included when a config profile is selected (--profile,
+DCX_PROFILE or .dcx/profile).
+
+Formats:
+  bash, zsh, sh   export NAME='value'
+  fish            set -gx NAME 'value'
+  env             NAME=value (data only, parse without eval)
+
+The default format follows $SHELL.
+
+Examples:
+  eval "$(dcx env --shell bash)"
+  eval "$(dcx env --shell bash --profile prod)"
+  dcx env --shell fish | source
+  while IFS= read -r line; do export "${line%%=*}=${line#*=}"; done < <(dcx env --shell env)`)
+}
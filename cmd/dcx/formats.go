@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File formats understood by the config file commands. Every format is
+// read into yaml.Node trees, so key paths behave the same in all of them.
+const (
+	formatYAML   = "yaml"
+	formatJSON   = "json"
+	formatTOML   = "toml"
+	formatDotenv = "env"
+)
+
+// fileFormat is the --format given to the yaml-* commands; empty means
+// detect each file's format from its name
+var fileFormat string
+
+// formatForPath returns the format of a file: --format when given,
+// otherwise guessed from the extension (YAML when unknown)
+func formatForPath(path string) string {
+	if fileFormat != "" {
+		return fileFormat
+	}
+	return detectFormat(path)
+}
+
+// detectFormat guesses a file's format from its name
+func detectFormat(path string) string {
+	base := strings.ToLower(filepath.Base(path))
+	switch filepath.Ext(base) {
+	case ".json":
+		return formatJSON
+	case ".toml":
+		return formatTOML
+	case ".env":
+		return formatDotenv
+	}
+	if base == ".env" || strings.HasPrefix(base, ".env.") {
+		return formatDotenv
+	}
+	return formatYAML
+}
+
+// parseFormat validates a --format/--from/--to value
+func parseFormat(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "yaml", "yml":
+		return formatYAML, nil
+	case "json":
+		return formatJSON, nil
+	case "toml":
+		return formatTOML, nil
+	case "env", "dotenv":
+		return formatDotenv, nil
+	}
+	return "", fmt.Errorf("unknown format: %s (use yaml, json, toml, env)", name)
+}
+
+// extractFormatFlag removes --format F (or --format=F) from args
+func extractFormatFlag(args []string) (string, []string, error) {
+	format := ""
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--format":
+			if i+1 >= len(args) {
+				return "", nil, fmt.Errorf("--format requires a value")
+			}
+			format = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--format="):
+			format = strings.TrimPrefix(arg, "--format=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if format == "" {
+		return "", rest, nil
+	}
+	format, err := parseFormat(format)
+	return format, rest, err
+}
+
+// extractBoolFlag removes every occurrence of flag from args and reports
+// whether there was one
+func extractBoolFlag(args []string, flag string) (bool, []string) {
+	found := false
+	var rest []string
+	for _, arg := range args {
+		if arg == flag {
+			found = true
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	return found, rest
+}
+
+// decodeFormat parses a JSON, TOML or dotenv file into its top-level node;
+// empty input yields nil
+func decodeFormat(data []byte, format string) (*yaml.Node, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	switch format {
+	case formatJSON:
+		if !json.Valid(data) {
+			var v interface{}
+			err := json.Unmarshal(data, &v)
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+		// JSON is YAML, and the YAML decoder keeps line numbers
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, err
+		}
+		clearStyles(&node)
+		return node.Content[0], nil
+	case formatTOML:
+		return decodeTOML(data)
+	case formatDotenv:
+		return decodeDotenv(data)
+	}
+	return nil, fmt.Errorf("unknown format: %s", format)
+}
+
+// encodeFormat renders a top-level node as JSON, TOML or dotenv. original
+// is the file being replaced: dotenv output keeps its comments and layout.
+func encodeFormat(root *yaml.Node, format string, indent int, original []byte) ([]byte, error) {
+	if root == nil {
+		root = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	root = expandMerges(root)
+
+	switch format {
+	case formatJSON:
+		value, err := nodeToJSONValue(root)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", strings.Repeat(" ", indent))
+		if err := enc.Encode(value); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case formatTOML:
+		return encodeTOML(root)
+	case formatDotenv:
+		return encodeDotenv(root, original)
+	}
+	return nil, fmt.Errorf("unknown format: %s", format)
+}
+
+// expandMerges returns a copy of node with aliases resolved and "<<" merge
+// keys replaced by the keys they inherit, for formats that have neither
+func expandMerges(node *yaml.Node) *yaml.Node {
+	node = resolveAlias(node)
+	copied := *node
+	copied.Anchor = ""
+	copied.Content = nil
+
+	if node.Kind != yaml.MappingNode {
+		for _, child := range node.Content {
+			copied.Content = append(copied.Content, expandMerges(child))
+		}
+		return &copied
+	}
+
+	var merges []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if key := node.Content[i]; key.Value == "<<" && key.ShortTag() == "!!merge" {
+			merges = append(merges, resolveAlias(node.Content[i+1]))
+			continue
+		}
+		copied.Content = append(copied.Content, node.Content[i], expandMerges(node.Content[i+1]))
+	}
+
+	// inherited keys follow the mapping's own; earlier sources win
+	for _, merged := range merges {
+		sources := []*yaml.Node{merged}
+		if merged.Kind == yaml.SequenceNode {
+			sources = merged.Content
+		}
+		for _, source := range sources {
+			source = expandMerges(source)
+			for i := 0; i+1 < len(source.Content); i += 2 {
+				if mappingIndex(&copied, source.Content[i].Value) < 0 {
+					copied.Content = append(copied.Content, source.Content[i], source.Content[i+1])
+				}
+			}
+		}
+	}
+	return &copied
+}
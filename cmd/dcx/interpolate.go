@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Interpolation of config values, applied when config is read (config
+// get/effective, yaml-get) unless --no-interpolate is given:
+//
+//	${NAME}              config key, environment variable or DCX_* path
+//	${NAME:-default}     default when NAME is undefined ($VAR allowed)
+//	${paths.prefix}      key path; tried next to the value first, then
+//	                     from the top, so project.yaml can use ${prefix}
+//	$${text}             a literal ${text}
+//
+// A value that is a single reference keeps the referenced value's type.
+// An undefined reference without a default is left as written, or with
+// --strict is an error.
+
+// interpolator expands references in the string values of a config tree
+// in place, resolving referenced keys first and detecting cycles
+type interpolator struct {
+	root   *yaml.Node
+	strict bool // undefined references are errors
+	done   map[*yaml.Node]error
+	stack  []interpolation
+}
+
+// interpolationError names the value whose expansion failed
+type interpolationError struct {
+	path string
+	err  error
+}
+
+func (e *interpolationError) Error() string {
+	return e.path + ": " + e.err.Error()
+}
+
+// interpolation is a value being expanded, for cycle reports
+type interpolation struct {
+	node *yaml.Node
+	path string
+}
+
+func newInterpolator(root *yaml.Node, strict bool) *interpolator {
+	return &interpolator{root: root, strict: strict, done: make(map[*yaml.Node]error)}
+}
+
+// expandTree interpolates every string under node, found at segs
+func (in *interpolator) expandTree(node *yaml.Node, segs []pathSegment) error {
+	node = resolveAlias(node)
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return in.expandNode(node, segs)
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			child := appendSegment(segs, pathSegment{kind: segmentKey, key: node.Content[i].Value})
+			if err := in.expandTree(node.Content[i+1], child); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			if err := in.expandTree(item, appendSegment(segs, pathSegment{kind: segmentIndex, index: i})); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expandNode interpolates one string scalar
+func (in *interpolator) expandNode(node *yaml.Node, segs []pathSegment) error {
+	if node.ShortTag() != "!!str" || !strings.Contains(node.Value, "$") {
+		return nil
+	}
+	if err, ok := in.done[node]; ok {
+		return err
+	}
+
+	path := formatKeyPath(segs)
+	for i, active := range in.stack {
+		if active.node == node {
+			var cycle []string
+			for _, step := range in.stack[i:] {
+				cycle = append(cycle, step.path)
+			}
+			return fmt.Errorf("reference cycle: %s -> %s", strings.Join(cycle, " -> "), path)
+		}
+	}
+
+	in.stack = append(in.stack, interpolation{node, path})
+	value, tag, err := in.expand(node.Value, segs, false)
+	in.stack = in.stack[:len(in.stack)-1]
+
+	var located *interpolationError
+	if err != nil && !errors.As(err, &located) {
+		err = &interpolationError{path: path, err: err}
+	} else if err == nil {
+		node.Value, node.Tag, node.Style = value, tag, 0
+	}
+	in.done[node] = err
+	return err
+}
+
+// expand replaces the references in s, a value at segs. bare also expands
+// $VAR, which only defaults use (${XDG_CONFIG_HOME:-$HOME/.config}).
+func (in *interpolator) expand(s string, segs []pathSegment, bare bool) (string, string, error) {
+	var b strings.Builder
+	tag := "!!str"
+
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "$${"):
+			b.WriteString("${")
+			i += 3
+
+		case strings.HasPrefix(s[i:], "${"):
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				return "", "", fmt.Errorf("unterminated ${ in %q", s)
+			}
+			value, refTag, err := in.reference(s[i+2:end], segs)
+			if err != nil {
+				return "", "", err
+			}
+			if i == 0 && end == len(s)-1 {
+				tag = refTag
+			}
+			b.WriteString(value)
+			i = end + 1
+
+		case bare && s[i] == '$' && i+1 < len(s) && isVariableStart(s[i+1]):
+			j := i + 1
+			for j < len(s) && (isVariableStart(s[j]) || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			value, _ := lookupVariable(s[i+1 : j])
+			b.WriteString(value)
+			i = j
+
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String(), tag, nil
+}
+
+// reference resolves the inside of ${...}
+func (in *interpolator) reference(ref string, segs []pathSegment) (string, string, error) {
+	name, def, hasDefault := strings.Cut(ref, ":-")
+
+	value, tag, ok, err := in.lookup(name, segs)
+	switch {
+	case err != nil:
+		return "", "", err
+	case ok:
+		return value, tag, nil
+	case hasDefault:
+		value, _, err := in.expand(def, segs, true)
+		return value, "!!str", err
+	case !in.strict:
+		return "${" + ref + "}", "!!str", nil
+	}
+	return "", "", fmt.Errorf("undefined variable ${%s}", name)
+}
+
+// lookup finds name as a config key (next to the value, then in each
+// enclosing map up to the top), then as a variable
+func (in *interpolator) lookup(name string, segs []pathSegment) (string, string, bool, error) {
+	if refSegs, err := parseKeyPath(name); err == nil && len(refSegs) > 0 && !hasWildcard(refSegs) && len(segs) > 0 {
+		parent := segs[:len(segs)-1]
+		for i := len(parent); i >= 0; i-- {
+			path := append(append([]pathSegment(nil), parent[:i]...), refSegs...)
+			node := resolveAlias(findNode(in.root, path))
+			if node == nil {
+				continue
+			}
+			if node.Kind != yaml.ScalarNode {
+				return "", "", false, fmt.Errorf("${%s} refers to a map or list", name)
+			}
+			if err := in.expandNode(node, path); err != nil {
+				return "", "", false, err
+			}
+			if node.ShortTag() == "!!null" {
+				return "", "!!null", true, nil
+			}
+			return node.Value, node.ShortTag(), true, nil
+		}
+	}
+
+	if value, ok := lookupVariable(name); ok {
+		return value, "!!str", true, nil
+	}
+	return "", "", false, nil
+}
+
+// lookupVariable reads an environment variable, falling back to the DCX_*
+// paths dcx computes itself (the ones "dcx config paths" prints)
+func lookupVariable(name string) (string, bool) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true
+	}
+	switch name {
+	case "DCX_HOME":
+		return getDCHome(), true
+	case "DCX_BIN_DIR":
+		return getBinDir(), true
+	case "DCX_ETC_DIR":
+		return getEtcDir(), true
+	case "DCX_CACHE_DIR":
+		return getCacheDir(), true
+	case "DCX_PLATFORM":
+		return detectPlatform(), true
+	}
+	return "", false
+}
+
+// closingBrace finds the } closing a ${ whose content starts at start,
+// allowing nested ${...} in defaults
+func closingBrace(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "${"):
+			depth++
+			i++
+		case s[i] == '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isVariableStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Key path grammar shared by every config command:
+//
+//	log.level                 nested keys
+//	plugins.dirs[0]           list index ([-1] is the last item)
+//	urls."linux-amd64"        quoted key (may contain dots)
+//	versions["1.2.3"]         bracketed quoted key
+//	tools.*.version           wildcard over map keys or list items ([*] too)
+//	plugins.dirs[+]           append to a list (set only)
+//
+// An empty path or "." is the document root.
+
+type segmentKind int
+
+const (
+	segmentKey segmentKind = iota
+	segmentIndex
+	segmentWildcard
+	segmentAppend
+)
+
+// pathSegment is one step of a parsed key path
+type pathSegment struct {
+	kind  segmentKind
+	key   string
+	index int
+}
+
+// parseKeyPath parses a key path into segments
+func parseKeyPath(path string) ([]pathSegment, error) {
+	var segs []pathSegment
+	if path == "" || path == "." {
+		return segs, nil
+	}
+
+	i := 0
+	expectKey := true
+	for i < len(path) {
+		switch c := path[i]; {
+		case c == '[':
+			end := closingBracket(path, i)
+			if end < 0 {
+				return nil, fmt.Errorf("invalid key path %q: unterminated [", path)
+			}
+			seg, err := parseBracket(path[i+1 : end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid key path %q: %w", path, err)
+			}
+			segs = append(segs, seg)
+			i = end + 1
+			expectKey = false
+
+		case c == '.':
+			if expectKey && len(segs) > 0 {
+				return nil, fmt.Errorf("invalid key path %q: empty segment", path)
+			}
+			i++
+			expectKey = true
+			if i == len(path) {
+				return nil, fmt.Errorf("invalid key path %q: trailing .", path)
+			}
+
+		default:
+			if !expectKey {
+				return nil, fmt.Errorf("invalid key path %q: expected . or [ at offset %d", path, i)
+			}
+			if c == '"' || c == '\'' {
+				key, n, err := unquoteSegment(path[i:])
+				if err != nil {
+					return nil, fmt.Errorf("invalid key path %q: %w", path, err)
+				}
+				segs = append(segs, pathSegment{kind: segmentKey, key: key})
+				i += n
+			} else {
+				end := i
+				for end < len(path) && path[end] != '.' && path[end] != '[' {
+					end++
+				}
+				key := path[i:end]
+				if key == "*" {
+					segs = append(segs, pathSegment{kind: segmentWildcard})
+				} else {
+					segs = append(segs, pathSegment{kind: segmentKey, key: key})
+				}
+				i = end
+			}
+			expectKey = false
+		}
+	}
+	return segs, nil
+}
+
+// closingBracket finds the ] matching the [ at start, skipping quotes
+func closingBracket(path string, start int) int {
+	var quote byte
+	for i := start + 1; i < len(path); i++ {
+		switch c := path[i]; {
+		case quote != 0 && c == '\\' && quote == '"':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseBracket parses the inside of [...]
+func parseBracket(inner string) (pathSegment, error) {
+	switch {
+	case inner == "*":
+		return pathSegment{kind: segmentWildcard}, nil
+	case inner == "+":
+		return pathSegment{kind: segmentAppend}, nil
+	case strings.HasPrefix(inner, `"`) || strings.HasPrefix(inner, "'"):
+		key, n, err := unquoteSegment(inner)
+		if err != nil {
+			return pathSegment{}, err
+		}
+		if n != len(inner) {
+			return pathSegment{}, fmt.Errorf("unexpected text after quoted key in [%s]", inner)
+		}
+		return pathSegment{kind: segmentKey, key: key}, nil
+	default:
+		index, err := strconv.Atoi(inner)
+		if err != nil {
+			return pathSegment{}, fmt.Errorf("invalid index [%s]", inner)
+		}
+		return pathSegment{kind: segmentIndex, index: index}, nil
+	}
+}
+
+// unquoteSegment reads a leading "..." or '...' and returns the key and
+// the number of bytes consumed
+func unquoteSegment(s string) (string, int, error) {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case quote == '\'' && s[i] == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == quote:
+			if quote == '\'' {
+				return strings.ReplaceAll(s[1:i], "''", "'"), i + 1, nil
+			}
+			key, err := strconv.Unquote(s[:i+1])
+			return key, i + 1, err
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quote")
+}
+
+// formatKeyPath renders segments back into a key path, quoting keys that
+// would not parse as bare segments
+func formatKeyPath(segs []pathSegment) string {
+	var b strings.Builder
+	for _, seg := range segs {
+		switch seg.kind {
+		case segmentKey:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(formatKeySegment(seg.key))
+		case segmentIndex:
+			fmt.Fprintf(&b, "[%d]", seg.index)
+		case segmentWildcard:
+			b.WriteString("[*]")
+		case segmentAppend:
+			b.WriteString("[+]")
+		}
+	}
+	return b.String()
+}
+
+// formatKeySegment quotes a key when it contains path syntax
+func formatKeySegment(key string) string {
+	if key == "" || key == "*" || strings.ContainsAny(key, `.[]"' `) {
+		return strconv.Quote(key)
+	}
+	return key
+}
+
+// joinKeyPath appends a map key to a formatted path
+func joinKeyPath(prefix, key string) string {
+	if prefix == "" {
+		return formatKeySegment(key)
+	}
+	return prefix + "." + formatKeySegment(key)
+}
+
+// hasWildcard reports whether a path can match more than one node
+func hasWildcard(segs []pathSegment) bool {
+	for _, seg := range segs {
+		if seg.kind == segmentWildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeMatch is a node found by a key path, with its concrete path
+type nodeMatch struct {
+	path []pathSegment
+	node *yaml.Node
+}
+
+// findNodes returns every node matching segs, following aliases and
+// "<<" merge keys on the way. The matched nodes themselves may be aliases.
+func findNodes(root *yaml.Node, segs []pathSegment) []nodeMatch {
+	return matchPath(root, segs, true)
+}
+
+// findNode returns the single node at segs, or nil
+func findNode(root *yaml.Node, segs []pathSegment) *yaml.Node {
+	if hasWildcard(segs) {
+		return nil
+	}
+	if matches := findNodes(root, segs); len(matches) > 0 {
+		return matches[0].node
+	}
+	return nil
+}
+
+// findOwnNode is findNode without "<<" merge keys: it only returns nodes
+// the document defines at that path, which is what edits must touch
+func findOwnNode(root *yaml.Node, segs []pathSegment) *yaml.Node {
+	if hasWildcard(segs) {
+		return nil
+	}
+	if matches := matchPath(root, segs, false); len(matches) > 0 {
+		return matches[0].node
+	}
+	return nil
+}
+
+func matchPath(root *yaml.Node, segs []pathSegment, merges bool) []nodeMatch {
+	if root == nil {
+		return nil
+	}
+	if len(segs) == 0 {
+		return []nodeMatch{{node: root}}
+	}
+
+	node := resolveAlias(root)
+	seg := segs[0]
+	var matches []nodeMatch
+	descend := func(step pathSegment, child *yaml.Node) {
+		for _, m := range matchPath(child, segs[1:], merges) {
+			m.path = append([]pathSegment{step}, m.path...)
+			matches = append(matches, m)
+		}
+	}
+
+	switch seg.kind {
+	case segmentKey:
+		if !merges {
+			if node.Kind == yaml.MappingNode {
+				if idx := mappingIndex(node, seg.key); idx >= 0 {
+					descend(seg, node.Content[idx+1])
+				}
+			}
+		} else if child := mappingValue(node, seg.key); child != nil {
+			descend(seg, child)
+		}
+	case segmentIndex:
+		if node.Kind == yaml.SequenceNode {
+			if i, ok := sequenceIndex(node, seg.index); ok {
+				descend(pathSegment{kind: segmentIndex, index: i}, node.Content[i])
+			}
+		}
+	case segmentWildcard:
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value != "<<" {
+					descend(pathSegment{kind: segmentKey, key: node.Content[i].Value}, node.Content[i+1])
+				}
+			}
+		case yaml.SequenceNode:
+			for i, child := range node.Content {
+				descend(pathSegment{kind: segmentIndex, index: i}, child)
+			}
+		}
+	}
+	return matches
+}
+
+// mappingValue returns the value for key in a mapping, including values
+// inherited through "<<" merge keys
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	if idx := mappingIndex(mapping, key); idx >= 0 {
+		return mapping.Content[idx+1]
+	}
+	if idx := mappingIndex(mapping, "<<"); idx >= 0 {
+		merged := resolveAlias(mapping.Content[idx+1])
+		sources := []*yaml.Node{merged}
+		if merged.Kind == yaml.SequenceNode {
+			sources = merged.Content
+		}
+		for _, source := range sources {
+			if value := mappingValue(resolveAlias(source), key); value != nil {
+				return value
+			}
+		}
+	}
+	return nil
+}
+
+// sequenceIndex resolves a possibly negative index into a list
+func sequenceIndex(seq *yaml.Node, index int) (int, bool) {
+	if index < 0 {
+		index += len(seq.Content)
+	}
+	return index, index >= 0 && index < len(seq.Content)
+}
+
+// setPath stores value at segs under root, creating missing mappings (or
+// lists before an index/[+] step). Wildcards are not allowed.
+func setPath(root *yaml.Node, segs []pathSegment, value *yaml.Node) error {
+	if len(segs) == 0 {
+		return fmt.Errorf("cannot set the document root")
+	}
+	if hasWildcard(segs) {
+		return fmt.Errorf("wildcards cannot be used to set values")
+	}
+
+	node := root
+	for i, seg := range segs {
+		last := i == len(segs)-1
+		var next *yaml.Node
+		if !last {
+			next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			if k := segs[i+1].kind; k == segmentIndex || k == segmentAppend {
+				next = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			}
+		}
+
+		switch seg.kind {
+		case segmentKey:
+			if node.Kind != yaml.MappingNode {
+				return fmt.Errorf("%s is not a map", formatKeyPath(segs[:i]))
+			}
+			idx := mappingIndex(node, seg.key)
+			switch {
+			case last && idx >= 0:
+				node.Content[idx+1] = value
+			case last:
+				node.Content = append(node.Content, keyNode(seg.key), value)
+			case idx >= 0 && isContainer(resolveAlias(node.Content[idx+1])):
+				next = resolveAlias(node.Content[idx+1])
+			case idx >= 0:
+				node.Content[idx+1] = next
+			default:
+				node.Content = append(node.Content, keyNode(seg.key), next)
+			}
+
+		case segmentIndex:
+			if node.Kind != yaml.SequenceNode {
+				return fmt.Errorf("%s is not a list", formatKeyPath(segs[:i]))
+			}
+			idx, ok := sequenceIndex(node, seg.index)
+			if !ok {
+				return fmt.Errorf("index %d out of range for %s", seg.index, formatKeyPath(segs[:i]))
+			}
+			switch {
+			case last:
+				node.Content[idx] = value
+			case isContainer(resolveAlias(node.Content[idx])):
+				next = resolveAlias(node.Content[idx])
+			default:
+				node.Content[idx] = next
+			}
+
+		case segmentAppend:
+			if node.Kind != yaml.SequenceNode {
+				return fmt.Errorf("%s is not a list", formatKeyPath(segs[:i]))
+			}
+			if last {
+				next = value
+			}
+			node.Content = append(node.Content, next)
+		}
+		node = next
+	}
+	return nil
+}
+
+// isContainer reports whether node is a map or list
+func isContainer(node *yaml.Node) bool {
+	return node != nil && (node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode)
+}
+
+// keyNode builds a mapping key node
+func keyNode(key string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+}
@@ -0,0 +1,48 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const lockfileExclusiveLock = 0x2
+
+// lockHandle takes an exclusive LockFileEx lock, waiting for other holders
+func lockHandle(f *os.File) error {
+	var ol syscall.Overlapped
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+func unlockHandle(f *os.File) error {
+	var ol syscall.Overlapped
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// keepOwner is a no-op: a new file inherits the directory's ACL
+func keepOwner(f *os.File, info os.FileInfo) {}
+
+// syncDir is a no-op: directories cannot be synced on Windows
+func syncDir(dir string) {}
+
+// securePrivateDir creates a directory for the agent socket and lock
+// files; it is under the user's profile, which other users cannot read
+func securePrivateDir(dir string) error {
+	return os.MkdirAll(dir, 0700)
+}
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 )
@@ -27,8 +28,14 @@ func main() {
 		handleTools(os.Args[2:])
 	case "config":
 		handleConfig(os.Args[2:])
+	case "env":
+		handleEnv(os.Args[2:])
 	case "cred":
 		handleCred(os.Args[2:])
+	case "oracle":
+		handleOracle(os.Args[2:])
+	case "tns":
+		handleTNS(os.Args[2:])
 	case "validate":
 		handleValidate()
 	case "lint":
@@ -53,17 +60,20 @@ func printVersion() {
 
 	// List bundled tools
 	fmt.Println("Bundled tools:")
-	tools := []string{"gum", "yq", "rg", "fd", "sd", "sg"}
-	for _, tool := range tools {
-		path, err := findBinary(tool)
+	binaries, err := knownBinaries()
+	if err != nil {
+		fmt.Printf("  (tools registry unavailable: %v)\n", err)
+	}
+	for _, b := range binaries {
+		path, err := findBinary(b.Name)
 		if err != nil {
-			if tool == "gum" || tool == "yq" {
-				fmt.Printf("  %s: (not found - required)\n", tool)
+			if b.Required {
+				fmt.Printf("  %s: (not found - required)\n", b.Name)
 			} else {
-				fmt.Printf("  %s: (optional)\n", tool)
+				fmt.Printf("  %s: (optional)\n", b.Name)
 			}
 		} else {
-			fmt.Printf("  %s: %s\n", tool, path)
+			fmt.Printf("  %s: %s\n", b.Name, path)
 		}
 	}
 }
@@ -79,13 +89,28 @@ Commands:
   binary      Find bundled or system binary
   tools       Manage bundled tools (list, install, check)
   config      Manage configuration
+  env         Print the DCX environment for a shell (bash, zsh, fish, env)
+  oracle      Discover Oracle homes and SID environments
+  tns         Inspect tnsnames.ora and sqlnet.ora
   validate    Test all bundled tools work correctly
   lint        Lint shell scripts with ast-grep
   help        Show this help message
 
 Binary Commands:
   dcx binary find <name>    Find path to binary (bundled or system)
-  dcx binary list           List all known binaries
+  dcx binary find <name> --sid <SID>
+                            Find an Oracle tool in the home of a SID
+  dcx binary list           List all known binaries (tools.yaml + plugins)
+
+Oracle Commands:
+  dcx oracle homes          List Oracle homes (oratab and inventory)
+  dcx oracle env --sid <SID>
+                            Print ORACLE_HOME, ORACLE_SID, PATH, LD_LIBRARY_PATH
+
+TNS Commands:
+  dcx tns list              List aliases from tnsnames.ora
+  dcx tns resolve <alias>   Show host, port and service (--json)
+  dcx tns check <alias>     Probe TCP reachability of an alias
 
 Tools Commands:
   dcx tools list            List all configured tools
@@ -93,9 +118,23 @@ Tools Commands:
   dcx tools install --all   Install all configured tools
   dcx tools check           Check if required tools are available
 
+Environment Commands:
+  dcx env --shell bash      Print DCX_* paths and tool variables as exports
+  dcx env --shell env       Same as KEY=VALUE lines (no eval needed)
+
 Environment:
   DCX_HOME     Installation directory
 
 For more information: https://github.com/datacosmos-br/dcx
 `, Version)
 }
+
+// printJSON prints v as indented JSON, exiting on encoding errors
+func printJSON(v interface{}) {
+	jsonBytes, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(jsonBytes))
+}
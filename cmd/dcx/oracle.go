@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Default locations of the Oracle home registries
+const (
+	defaultOratab     = "/etc/oratab"
+	defaultOraInstLoc = "/etc/oraInst.loc"
+)
+
+// OracleHome is an Oracle home discovered from oratab or the central inventory
+type OracleHome struct {
+	SID       string `json:"sid,omitempty"`
+	Home      string `json:"home"`
+	Name      string `json:"name,omitempty"`
+	AutoStart bool   `json:"autostart"`
+	Source    string `json:"source"`
+}
+
+// oracleOptions holds the file overrides shared by the oracle subcommands
+type oracleOptions struct {
+	oratab    string
+	inventory string
+}
+
+// getOratabPath returns the oratab path
+// Priority: --oratab flag > DCX_ORATAB env var > /etc/oratab
+func (o oracleOptions) getOratabPath() string {
+	if o.oratab != "" {
+		return o.oratab
+	}
+	if path := os.Getenv("DCX_ORATAB"); path != "" {
+		return path
+	}
+	return defaultOratab
+}
+
+// getInventoryPath returns the path of the central inventory.xml
+// Priority: --inventory flag > DCX_ORACLE_INVENTORY env var > oraInst.loc
+func (o oracleOptions) getInventoryPath() string {
+	if o.inventory != "" {
+		return o.inventory
+	}
+	if path := os.Getenv("DCX_ORACLE_INVENTORY"); path != "" {
+		return path
+	}
+
+	locFile := os.Getenv("DCX_ORAINST_LOC")
+	if locFile == "" {
+		locFile = defaultOraInstLoc
+	}
+	invLoc := readOraInstLoc(locFile)
+	if invLoc == "" {
+		return ""
+	}
+	return filepath.Join(invLoc, "ContentsXML", "inventory.xml")
+}
+
+// parseOratab reads oratab entries in the format SID:ORACLE_HOME:Y|N
+// Comments and blank lines are skipped. Entries with SID "*" describe a
+// home without a database and are returned with an empty SID.
+func parseOratab(path string) ([]OracleHome, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var homes []OracleHome
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = strings.TrimSpace(line[:idx])
+		}
+		if line == "" {
+			continue
+		}
+
+		fields := strings.Split(line, ":")
+		if len(fields) < 2 || fields[1] == "" {
+			continue
+		}
+
+		home := OracleHome{
+			SID:    fields[0],
+			Home:   fields[1],
+			Source: "oratab",
+		}
+		if home.SID == "*" {
+			home.SID = ""
+		}
+		if len(fields) > 2 {
+			home.AutoStart = strings.EqualFold(fields[2], "Y")
+		}
+		homes = append(homes, home)
+	}
+
+	return homes, scanner.Err()
+}
+
+// readOraInstLoc returns inventory_loc from an oraInst.loc file
+func readOraInstLoc(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok && strings.TrimSpace(key) == "inventory_loc" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// oracleInventory mirrors the parts of ContentsXML/inventory.xml we use
+type oracleInventory struct {
+	Homes []struct {
+		Name    string `xml:"NAME,attr"`
+		Loc     string `xml:"LOC,attr"`
+		Removed string `xml:"REMOVED,attr"`
+	} `xml:"HOME_LIST>HOME"`
+}
+
+// parseInventory reads the homes registered in the central inventory,
+// skipping homes that were detached (REMOVED="T")
+func parseInventory(path string) ([]OracleHome, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var inv oracleInventory
+	if err := xml.Unmarshal(data, &inv); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	var homes []OracleHome
+	for _, h := range inv.Homes {
+		if h.Loc == "" || strings.EqualFold(h.Removed, "T") {
+			continue
+		}
+		homes = append(homes, OracleHome{
+			Home:   h.Loc,
+			Name:   h.Name,
+			Source: "inventory",
+		})
+	}
+	return homes, nil
+}
+
+// discoverOracleHomes merges oratab and inventory entries.
+// oratab entries come first; inventory homes already listed in oratab only
+// contribute their inventory name.
+func discoverOracleHomes(opts oracleOptions) ([]OracleHome, error) {
+	homes, err := parseOratab(opts.getOratabPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	invPath := opts.getInventoryPath()
+	if invPath == "" {
+		return homes, nil
+	}
+	invHomes, err := parseInventory(invPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return homes, nil
+		}
+		return nil, err
+	}
+
+	for _, ih := range invHomes {
+		known := false
+		for i := range homes {
+			if filepath.Clean(homes[i].Home) == filepath.Clean(ih.Home) {
+				homes[i].Name = ih.Name
+				known = true
+			}
+		}
+		if !known {
+			homes = append(homes, ih)
+		}
+	}
+	return homes, nil
+}
+
+// findOracleHome returns the home registered for sid in oratab
+func findOracleHome(sid string, opts oracleOptions) (string, error) {
+	homes, err := discoverOracleHomes(opts)
+	if err != nil {
+		return "", err
+	}
+	for _, h := range homes {
+		if h.SID == sid {
+			return h.Home, nil
+		}
+	}
+	return "", fmt.Errorf("SID not found in %s: %s", opts.getOratabPath(), sid)
+}
+
+// oracleEnv builds ORACLE_HOME, ORACLE_SID, PATH and LD_LIBRARY_PATH for sid.
+// Like oraenv, bin and lib dirs of the other known homes are dropped from
+// PATH and LD_LIBRARY_PATH so switching SIDs does not pile up entries.
+func oracleEnv(sid string, opts oracleOptions) ([]envVar, error) {
+	home, err := findOracleHome(sid, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	homes, _ := discoverOracleHomes(opts)
+	var otherBins, otherLibs []string
+	if current := os.Getenv("ORACLE_HOME"); current != "" {
+		homes = append(homes, OracleHome{Home: current})
+	}
+	for _, h := range homes {
+		otherBins = append(otherBins, filepath.Join(h.Home, "bin"))
+		otherLibs = append(otherLibs, filepath.Join(h.Home, "lib"))
+	}
+
+	return []envVar{
+		{"ORACLE_HOME", home},
+		{"ORACLE_SID", sid},
+		{"PATH", prependPath(os.Getenv("PATH"), filepath.Join(home, "bin"), otherBins...)},
+		{"LD_LIBRARY_PATH", prependPath(os.Getenv("LD_LIBRARY_PATH"), filepath.Join(home, "lib"), otherLibs...)},
+	}, nil
+}
+
+// handleOracle handles the "dcx oracle" subcommand
+func handleOracle(args []string) {
+	if len(args) == 0 {
+		printOracleHelp()
+		return
+	}
+
+	var opts oracleOptions
+	sid := os.Getenv("ORACLE_SID")
+	shell := "bash"
+	jsonOutput := false
+
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--sid", "--oratab", "--inventory", "--shell":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", args[i])
+				os.Exit(1)
+			}
+			switch args[i] {
+			case "--sid":
+				sid = args[i+1]
+			case "--oratab":
+				opts.oratab = args[i+1]
+			case "--inventory":
+				opts.inventory = args[i+1]
+			case "--shell":
+				shell = args[i+1]
+			}
+			i++
+		case "--json":
+			jsonOutput = true
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown option: %s\n", args[i])
+			os.Exit(1)
+		}
+	}
+
+	switch args[0] {
+	case "homes":
+		oracleHomes(opts, jsonOutput)
+
+	case "env":
+		if sid == "" {
+			fmt.Fprintln(os.Stderr, "Usage: dcx oracle env --sid <SID> [--shell bash|zsh|fish|env]")
+			os.Exit(1)
+		}
+		if !isShellFormat(shell) {
+			fmt.Fprintf(os.Stderr, "Error: unknown shell: %s\n", shell)
+			os.Exit(1)
+		}
+		vars, err := oracleEnv(sid, opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := writeEnv(os.Stdout, shell, vars); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "help", "-h", "--help":
+		printOracleHelp()
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown oracle command: %s\n", args[0])
+		fmt.Fprintln(os.Stderr, "Run 'dcx oracle help' for usage")
+		os.Exit(1)
+	}
+}
+
+func oracleHomes(opts oracleOptions, jsonOutput bool) {
+	homes, err := discoverOracleHomes(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		if homes == nil {
+			homes = []OracleHome{}
+		}
+		printJSON(homes)
+		return
+	}
+
+	if len(homes) == 0 {
+		fmt.Fprintf(os.Stderr, "No Oracle homes found (oratab: %s)\n", opts.getOratabPath())
+		return
+	}
+
+	fmt.Printf("%-12s %-10s %-20s %s\n", "SID", "Source", "Name", "Home")
+	fmt.Printf("%-12s %-10s %-20s %s\n", "---", "------", "----", "----")
+	for _, h := range homes {
+		sid := h.SID
+		if sid == "" {
+			sid = "-"
+		}
+		name := h.Name
+		if name == "" {
+			name = "-"
+		}
+		fmt.Printf("%-12s %-10s %-20s %s\n", sid, h.Source, name, h.Home)
+	}
+}
+
+func printOracleHelp() {
+	fmt.Println(`Usage: dcx oracle <command> [options]
+
+Commands:
+  homes [--json]               List Oracle homes from oratab and inventory
+  env --sid <SID> [--shell S]  Print environment for a SID (bash, zsh, fish, env)
+  help                         Show this help
+
+Options:
+  --oratab <file>      oratab location (default: /etc/oratab)
+  --inventory <file>   inventory.xml location (default: from /etc/oraInst.loc)
+
+Examples:
+  dcx oracle homes
+  dcx oracle env --sid ORCL
+  dcx oracle env --sid ORCL --shell fish | source
+  dcx binary find sqlplus --sid ORCL
+
+Environment:
+  DCX_ORATAB            Override oratab location
+  DCX_ORAINST_LOC       Override oraInst.loc location
+  DCX_ORACLE_INVENTORY  Override inventory.xml location
+  ORACLE_SID            Default SID for 'env'`)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "net"
+
+// checkPeer accepts every client: without SO_PEERCRED, the 0700 socket
+// directory and 0600 socket keep other users out
+func checkPeer(conn net.Conn) error {
+	return nil
+}
@@ -93,3 +93,26 @@ func getEtcDir() string {
 func getCacheDir() string {
 	return filepath.Join(getDCHome(), "cache")
 }
+
+// getRuntimeDir returns the per-user directory for sockets and locks
+// ($XDG_RUNTIME_DIR/dcx, defaulting to dcx-<uid> under the temp dir)
+func getRuntimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "dcx")
+	}
+	name := "dcx"
+	if uid := os.Getuid(); uid >= 0 {
+		name = fmt.Sprintf("dcx-%d", uid)
+	}
+	return filepath.Join(os.TempDir(), name)
+}
+
+// getUserConfigDir returns the per-user config directory
+// ($XDG_CONFIG_HOME/dcx, defaulting to ~/.config/dcx)
+func getUserConfigDir() string {
+	if configHome := os.Getenv("XDG_CONFIG_HOME"); configHome != "" {
+		return filepath.Join(configHome, "dcx")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "dcx")
+}
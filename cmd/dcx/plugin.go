@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PluginBinary is a binary a plugin needs or ships
+// In plugin.yaml it can be a plain name or a mapping with details.
+type PluginBinary struct {
+	Name        string `yaml:"name"`
+	Required    bool   `yaml:"required"`
+	Description string `yaml:"description"`
+}
+
+// UnmarshalYAML accepts both "- sqlplus" and "- name: sqlplus"
+func (b *PluginBinary) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		b.Name = node.Value
+		return nil
+	}
+	type plain PluginBinary
+	return node.Decode((*plain)(b))
+}
+
+// PluginEnvVar is an environment variable the plugin reads its config from.
+// In plugin.yaml it can be a bare key path or a mapping with details.
+type PluginEnvVar struct {
+	Name        string     `yaml:"-"`
+	Key         string     `yaml:"key"`
+	Required    bool       `yaml:"required"`
+	RequiredIf  stringList `yaml:"required_if"`
+	Secret      bool       `yaml:"secret"`
+	Description string     `yaml:"description"`
+}
+
+// UnmarshalYAML accepts both "DCX_X: oracle.x" and "DCX_X: {key: oracle.x}"
+func (v *PluginEnvVar) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		v.Key = node.Value
+		return nil
+	}
+	type plain PluginEnvVar
+	return node.Decode((*plain)(v))
+}
+
+// pluginEnvMap is the config_env mapping, in plugin.yaml order
+type pluginEnvMap []PluginEnvVar
+
+// UnmarshalYAML reads the mapping keeping its order
+func (m *pluginEnvMap) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: config_env must map env var names to config keys", node.Line)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		var v PluginEnvVar
+		if err := node.Content[i+1].Decode(&v); err != nil {
+			return err
+		}
+		v.Name = node.Content[i].Value
+		if v.Key == "" {
+			return fmt.Errorf("line %d: config_env.%s has no key", node.Content[i].Line, v.Name)
+		}
+		*m = append(*m, v)
+	}
+	return nil
+}
+
+// stringList is a single string or a list of strings
+type stringList []string
+
+// UnmarshalYAML accepts a scalar or a list
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = stringList{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// PluginManifest represents a plugin's plugin.yaml
+type PluginManifest struct {
+	Name        string         `yaml:"name"`
+	Version     string         `yaml:"version"`
+	Description string         `yaml:"description"`
+	Binaries    []PluginBinary `yaml:"binaries"`
+
+	// ConfigSchema documents the plugin's own config section
+	ConfigSchema *configSchema `yaml:"config_schema"`
+
+	// ConfigEnv maps config keys to the env vars of "dcx config bundle"
+	ConfigEnv pluginEnvMap `yaml:"config_env"`
+
+	// Dir is the plugin directory (not part of plugin.yaml)
+	Dir string `yaml:"-"`
+}
+
+// getPluginDirs returns plugin search directories in priority order
+// Mirrors dc_init_plugin_dirs in lib/plugin.sh.
+func getPluginDirs() []string {
+	candidates := []string{
+		filepath.Join(getDCHome(), "plugins"),
+		filepath.Join(getUserConfigDir(), "plugins"),
+		"/usr/local/share/dcx/plugins",
+		filepath.Join(".dcx", "plugins"),
+	}
+
+	var dirs []string
+	for _, dir := range candidates {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// pluginManifestFile returns the plugin.yaml (or plugin.yml) of a plugin directory
+func pluginManifestFile(dir string) (string, error) {
+	for _, name := range []string{"plugin.yaml", "plugin.yml"} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no plugin.yaml found in: %s", dir)
+}
+
+// loadPluginManifest reads plugin.yaml (or plugin.yml) from a plugin directory
+func loadPluginManifest(dir string) (*PluginManifest, error) {
+	path, err := pluginManifestFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest PluginManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse plugin.yaml in %s: %w", dir, err)
+	}
+	if manifest.Name == "" {
+		manifest.Name = filepath.Base(dir)
+	}
+	manifest.Dir = dir
+	return &manifest, nil
+}
+
+// discoverPlugins returns the manifests of all installed plugins.
+// A plugin name found in an earlier directory shadows later ones;
+// unreadable manifests are skipped like dc_discover_plugins does.
+func discoverPlugins() []*PluginManifest {
+	var plugins []*PluginManifest
+	seen := make(map[string]bool)
+
+	for _, dir := range getPluginDirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			manifest, err := loadPluginManifest(filepath.Join(dir, entry.Name()))
+			if err != nil || seen[manifest.Name] {
+				continue
+			}
+			seen[manifest.Name] = true
+			plugins = append(plugins, manifest)
+		}
+	}
+	return plugins
+}
+
+// findPlugin returns the manifest of an installed plugin by name. A
+// plugin directory of that name whose manifest fails to load reports why.
+func findPlugin(name string) (*PluginManifest, error) {
+	for _, plugin := range discoverPlugins() {
+		if plugin.Name == name {
+			return plugin, nil
+		}
+	}
+	for _, dir := range getPluginDirs() {
+		pluginDir := filepath.Join(dir, name)
+		if _, err := pluginManifestFile(pluginDir); err != nil {
+			continue
+		}
+		if _, err := loadPluginManifest(pluginDir); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("plugin not found: %s", name)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config profiles select environment-specific overrides. With the prod
+// profile active, every config file layer is followed by
+//
+//	profiles.prod          a section of the file itself, and
+//	config.prod.yaml       a sibling file (defaults.prod.yaml, ...)
+//
+// both merged over the file. The profile comes from --profile, then
+// DCX_PROFILE, then the nearest .dcx/profile file.
+
+// profilesKey is the top-level key holding the overlays of a config file;
+// it never appears in the effective config itself
+const profilesKey = "profiles"
+
+// profileName limits names to what can sit inside a file name
+var profileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// configProfile is the selected profile and what selected it
+type configProfile struct {
+	Name   string
+	Source string // --profile, DCX_PROFILE or the .dcx/profile path
+}
+
+// String formats the profile as "name (source)", or "(none)"
+func (p configProfile) String() string {
+	if p.Name == "" {
+		return "(none)"
+	}
+	return fmt.Sprintf("%s (%s)", p.Name, p.Source)
+}
+
+// selectProfile returns the active profile; flag is the --profile value
+func selectProfile(flag string) (configProfile, error) {
+	profile := configProfile{Name: flag, Source: "--profile"}
+	if profile.Name == "" {
+		profile = configProfile{Name: os.Getenv("DCX_PROFILE"), Source: "DCX_PROFILE"}
+	}
+	if profile.Name == "" {
+		if path := findNearest(filepath.Join(".dcx", "profile")); path != "" {
+			name, err := readProfileFile(path)
+			if err != nil {
+				return configProfile{}, err
+			}
+			profile = configProfile{Name: name, Source: path}
+		}
+	}
+	if profile.Name != "" && !profileName.MatchString(profile.Name) {
+		return configProfile{}, fmt.Errorf("invalid profile name %q from %s (use letters, digits, - and _)", profile.Name, profile.Source)
+	}
+	return profile, nil
+}
+
+// readProfileFile returns the first non-comment line of a .dcx/profile file
+func readProfileFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			return line, nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// profileFile returns the profile sibling of a config file:
+// config.yaml -> config.prod.yaml
+func profileFile(path, profile string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + profile + ext
+}
+
+// profileSiblings lists the existing profile files next to a config file
+func profileSiblings(path string) []string {
+	ext := filepath.Ext(path)
+	matches, _ := filepath.Glob(strings.TrimSuffix(path, ext) + ".*" + ext)
+	var files []string
+	for _, match := range matches {
+		name := strings.TrimSuffix(strings.TrimPrefix(match, strings.TrimSuffix(path, ext)+"."), ext)
+		if profileName.MatchString(name) {
+			files = append(files, match)
+		}
+	}
+	return files
+}
+
+// profileOverlay returns the profiles.<profile> section of a config file
+// root, or nil when the file has none
+func profileOverlay(root *yaml.Node, file, profile string) (*yaml.Node, error) {
+	if root == nil {
+		return nil, nil
+	}
+	i := mappingIndex(root, profilesKey)
+	if i < 0 {
+		return nil, nil
+	}
+	profiles := resolveAlias(root.Content[i+1])
+	if profiles.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s:%d: %s must be a mapping of profile names", file, profiles.Line, profilesKey)
+	}
+	j := mappingIndex(profiles, profile)
+	if j < 0 {
+		return nil, nil
+	}
+	overlay := resolveAlias(profiles.Content[j+1])
+	switch overlay.Kind {
+	case yaml.MappingNode:
+		return overlay, nil
+	case yaml.ScalarNode:
+		if overlay.ShortTag() == "!!null" {
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("%s:%d: %s.%s must be a mapping", file, overlay.Line, profilesKey, profile)
+}
+
+// withoutProfiles returns root without its profiles section
+func withoutProfiles(root *yaml.Node) *yaml.Node {
+	i := mappingIndex(root, profilesKey)
+	if i < 0 {
+		return root
+	}
+	copied := *root
+	copied.Content = append(append([]*yaml.Node(nil), root.Content[:i]...), root.Content[i+2:]...)
+	return &copied
+}
+
+// configProfileCommand prints the active profile name ("" when none), for
+// scripts and plugins: export DCX_PROFILE="$(dcx config profile)"
+func configProfileCommand(opts configOptions) {
+	profile, err := selectProfile(opts.profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if profile.Name != "" {
+		fmt.Println(profile.Name)
+	}
+}
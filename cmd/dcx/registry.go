@@ -0,0 +1,56 @@
+package main
+
+import "sort"
+
+// knownBinary is an entry of the merged binary registry
+type knownBinary struct {
+	Name        string
+	Required    bool
+	Description string
+	Source      string // "tools" or "plugin:<name>"
+}
+
+// knownBinaries returns every binary DCX knows about: the tools registry
+// (etc/tools.yaml merged with the user tools.yaml) followed by binaries
+// declared in plugin.yaml files. Required tools come first, then by name.
+// A registry failure is returned together with the plugin binaries.
+func knownBinaries() ([]knownBinary, error) {
+	var binaries []knownBinary
+	seen := make(map[string]bool)
+
+	config, err := loadToolsConfig()
+	if err == nil {
+		for name, tool := range config.Tools {
+			binaries = append(binaries, knownBinary{
+				Name:        name,
+				Required:    tool.Required,
+				Description: tool.Description,
+				Source:      "tools",
+			})
+			seen[name] = true
+		}
+		sort.Slice(binaries, func(i, j int) bool {
+			if binaries[i].Required != binaries[j].Required {
+				return binaries[i].Required
+			}
+			return binaries[i].Name < binaries[j].Name
+		})
+	}
+
+	for _, plugin := range discoverPlugins() {
+		for _, b := range plugin.Binaries {
+			if b.Name == "" || seen[b.Name] {
+				continue
+			}
+			seen[b.Name] = true
+			binaries = append(binaries, knownBinary{
+				Name:        b.Name,
+				Required:    b.Required,
+				Description: b.Description,
+				Source:      "plugin:" + plugin.Name,
+			})
+		}
+	}
+
+	return binaries, err
+}
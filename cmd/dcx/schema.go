@@ -0,0 +1,510 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configSchema is the JSON Schema subset used by etc/schemas/*.schema.yaml:
+// type, description, default, enum, properties, additionalProperties,
+// items and required
+type configSchema struct {
+	Type                 schemaTypes              `yaml:"type"`
+	Description          string                   `yaml:"description"`
+	Default              yaml.Node                `yaml:"default"`
+	Enum                 []string                 `yaml:"enum"`
+	Properties           map[string]*configSchema `yaml:"properties"`
+	AdditionalProperties *schemaAdditional        `yaml:"additionalProperties"`
+	Items                *configSchema            `yaml:"items"`
+	Required             []string                 `yaml:"required"`
+}
+
+// schemaTypes is "type: string" or "type: [string, object]"
+type schemaTypes []string
+
+// UnmarshalYAML accepts a single type or a list
+func (t *schemaTypes) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*t = schemaTypes{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// schemaAdditional is "additionalProperties: false" or a schema for the
+// values of keys not listed in properties
+type schemaAdditional struct {
+	Allowed bool
+	Schema  *configSchema
+}
+
+// UnmarshalYAML accepts a boolean or a schema
+func (a *schemaAdditional) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!bool" {
+		return node.Decode(&a.Allowed)
+	}
+	a.Allowed = true
+	a.Schema = &configSchema{}
+	return node.Decode(a.Schema)
+}
+
+// Schema names: the files under etc/schemas, plus "config", the combined
+// schema of the effective config (project + defaults + plugin sections)
+var schemaNames = []string{"config", "defaults", "project", "tools", "plugin"}
+
+// loadSchemaFile reads a schema from a file
+func loadSchemaFile(path string) (*configSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var schema configSchema
+	if err := yaml.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &schema, nil
+}
+
+// loadSchema returns a schema by name or file path
+func loadSchema(name string) (*configSchema, error) {
+	switch name {
+	case "config":
+		return loadConfigSchema()
+	case "defaults", "project", "tools", "plugin":
+		return loadSchemaFile(filepath.Join(getEtcDir(), "schemas", name+".schema.yaml"))
+	}
+	if _, err := os.Stat(name); err == nil {
+		return loadSchemaFile(name)
+	}
+	return nil, fmt.Errorf("unknown schema: %s (use %s or a file)", name, strings.Join(schemaNames, ", "))
+}
+
+// loadConfigSchema combines the project and defaults schemas with the
+// config_schema fragments of installed plugins. A plugin's fragment
+// describes its own top-level section, named after the plugin; it cannot
+// redefine a core section.
+func loadConfigSchema() (*configSchema, error) {
+	combined := &configSchema{
+		Type:                 schemaTypes{"object"},
+		Properties:           make(map[string]*configSchema),
+		AdditionalProperties: &schemaAdditional{},
+	}
+	for _, name := range []string{"project", "defaults"} {
+		schema, err := loadSchema(name)
+		if err != nil {
+			return nil, err
+		}
+		for key, prop := range schema.Properties {
+			combined.Properties[key] = prop
+		}
+	}
+
+	for _, plugin := range discoverPlugins() {
+		if plugin.ConfigSchema == nil || combined.Properties[plugin.Name] != nil {
+			continue
+		}
+		combined.Properties[plugin.Name] = plugin.ConfigSchema
+	}
+
+	// each profile overlays the same keys
+	overlay := *combined
+	overlay.Properties = maps.Clone(combined.Properties)
+	combined.Properties[profilesKey] = &configSchema{
+		Type:                 schemaTypes{"object"},
+		Description:          "Named overlays merged over this file when the profile is selected (--profile, DCX_PROFILE or .dcx/profile).",
+		AdditionalProperties: &schemaAdditional{Allowed: true, Schema: &overlay},
+	}
+	return combined, nil
+}
+
+// schemaForFile picks the schema a config file is validated against
+func schemaForFile(path string) string {
+	switch filepath.Base(path) {
+	case "tools.yaml":
+		return "tools"
+	case "project.yaml":
+		return "project"
+	case "defaults.yaml":
+		return "defaults"
+	case "plugin.yaml", "plugin.yml":
+		return "plugin"
+	}
+	return "config"
+}
+
+// schemaProblem is one validation failure
+type schemaProblem struct {
+	Line    int
+	Path    string
+	Message string
+}
+
+// validateNode checks node against schema and appends any problems
+func validateNode(schema *configSchema, node *yaml.Node, path string, problems []schemaProblem) []schemaProblem {
+	node = resolveAlias(node)
+	report := func(line int, format string, args ...interface{}) {
+		problems = append(problems, schemaProblem{Line: line, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(schema.Type) > 0 && !schema.Type.allows(node) {
+		report(node.Line, "expected %s, got %s", strings.Join(schema.Type, " or "), nodeTypeName(node))
+		return problems
+	}
+
+	if len(schema.Enum) > 0 && node.Kind == yaml.ScalarNode && !isInterpolated(node) {
+		found := false
+		for _, allowed := range schema.Enum {
+			found = found || node.Value == allowed
+		}
+		if !found {
+			report(node.Line, "%q is not one of %s", node.Value, strings.Join(schema.Enum, ", "))
+		}
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for _, key := range schema.Required {
+			if mappingIndex(node, key) < 0 {
+				report(node.Line, "missing required key %s", key)
+			}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			child := joinKeyPath(path, key.Value)
+			if prop := schema.Properties[key.Value]; prop != nil {
+				problems = validateNode(prop, value, child, problems)
+				continue
+			}
+			switch extra := schema.AdditionalProperties; {
+			case extra == nil || extra.Allowed && extra.Schema == nil:
+			case extra.Schema != nil:
+				problems = validateNode(extra.Schema, value, child, problems)
+			default:
+				msg := "unknown key"
+				if near := closestKey(key.Value, schema.Properties); near != "" {
+					msg += fmt.Sprintf(" (did you mean %s?)", near)
+				}
+				problems = append(problems, schemaProblem{Line: key.Line, Path: child, Message: msg})
+			}
+		}
+
+	case yaml.SequenceNode:
+		if schema.Items != nil {
+			for i, item := range node.Content {
+				problems = validateNode(schema.Items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	}
+	return problems
+}
+
+// allows reports whether node has one of the schema types. Strings with
+// ${...} references pass for any scalar type.
+func (t schemaTypes) allows(node *yaml.Node) bool {
+	got := nodeTypeName(node)
+	for _, want := range t {
+		switch {
+		case want == got:
+			return true
+		case want == "number" && got == "integer":
+			return true
+		case node.Kind == yaml.ScalarNode && want != "object" && want != "array" && isInterpolated(node):
+			return true
+		}
+	}
+	return false
+}
+
+// nodeTypeName names a node's JSON Schema type
+func nodeTypeName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+	switch node.ShortTag() {
+	case "!!int":
+		return "integer"
+	case "!!float":
+		return "number"
+	case "!!bool":
+		return "boolean"
+	case "!!null":
+		return "null"
+	}
+	return "string"
+}
+
+// isInterpolated reports whether a string value refers to ${...}
+func isInterpolated(node *yaml.Node) bool {
+	return node.ShortTag() == "!!str" && strings.Contains(node.Value, "${")
+}
+
+// closestKey suggests a known key for a misspelled one
+func closestKey(key string, properties map[string]*configSchema) string {
+	best, bestDist := "", 3
+	for name := range properties {
+		if d := editDistance(key, name); d < bestDist || d == bestDist && best != "" && name < best {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// schemaAt returns the schema describing the value at segs, or nil
+func schemaAt(schema *configSchema, segs []pathSegment) *configSchema {
+	for _, seg := range segs {
+		if schema == nil {
+			return nil
+		}
+		switch seg.kind {
+		case segmentKey:
+			if prop := schema.Properties[seg.key]; prop != nil {
+				schema = prop
+			} else if schema.AdditionalProperties != nil {
+				schema = schema.AdditionalProperties.Schema
+			} else {
+				return nil
+			}
+		case segmentWildcard:
+			if schema.Items != nil {
+				schema = schema.Items
+			} else if schema.AdditionalProperties != nil {
+				schema = schema.AdditionalProperties.Schema
+			} else {
+				return nil
+			}
+		default:
+			schema = schema.Items
+		}
+	}
+	return schema
+}
+
+// sortedProperties returns the property names of a schema in order
+func (s *configSchema) sortedProperties() []string {
+	var keys []string
+	for key := range s.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configValidate checks config files against their schemas and prints one
+// "file:line: key: problem" line per failure. Without files it checks the
+// config layers, etc/tools.yaml and every installed plugin.yaml.
+func configValidate(args []string) {
+	schemaName := ""
+	var files []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--schema":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: --schema requires a value")
+				os.Exit(1)
+			}
+			schemaName = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--schema="):
+			schemaName = strings.TrimPrefix(arg, "--schema=")
+		default:
+			files = append(files, arg)
+		}
+	}
+	if len(files) == 0 {
+		files = defaultValidateFiles()
+	}
+
+	schemas := make(map[string]*configSchema)
+	problems := 0
+	for _, file := range files {
+		name := schemaName
+		if name == "" {
+			name = schemaForFile(file)
+		}
+		schema := schemas[name]
+		if schema == nil {
+			var err error
+			if schema, err = loadSchema(name); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(2)
+			}
+			schemas[name] = schema
+		}
+
+		if _, err := os.Stat(file); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+		doc, err := loadYAMLDocument(file)
+		if err != nil {
+			fmt.Printf("%s: %v\n", file, err)
+			problems++
+			continue
+		}
+		root := doc.root()
+		if root == nil {
+			fmt.Printf("%s: OK\n", file)
+			continue
+		}
+
+		found := validateNode(schema, expandMerges(root), "", nil)
+		for _, p := range found {
+			path := p.Path
+			if path == "" {
+				path = "(top level)"
+			}
+			fmt.Printf("%s:%d: %s: %s\n", file, p.Line, path, p.Message)
+		}
+		if len(found) == 0 {
+			fmt.Printf("%s: OK\n", file)
+		}
+		problems += len(found)
+	}
+
+	if problems > 0 {
+		fmt.Fprintf(os.Stderr, "%d problem(s) found\n", problems)
+		os.Exit(1)
+	}
+}
+
+// defaultValidateFiles lists the files "config validate" checks by default
+func defaultValidateFiles() []string {
+	var files []string
+	for _, layer := range configLayerFiles() {
+		if layer.File != "" && isFile(layer.File) {
+			files = append(files, layer.File)
+		}
+		if layer.File != "" {
+			files = append(files, profileSiblings(layer.File)...)
+		}
+	}
+	if tools := filepath.Join(getEtcDir(), "tools.yaml"); isFile(tools) {
+		files = append(files, tools)
+	}
+
+	// read the directories directly: a manifest that fails to load is
+	// skipped by discoverPlugins, and is exactly what should be reported
+	for _, dir := range getPluginDirs() {
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			if manifest, err := pluginManifestFile(filepath.Join(dir, entry.Name())); err == nil {
+				files = append(files, manifest)
+			}
+		}
+	}
+	return files
+}
+
+// configDescribe prints the schema documentation of a key and, for the
+// effective config, its current value and origin
+func configDescribe(args []string) {
+	schemaName := "config"
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--schema":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: --schema requires a value")
+				os.Exit(1)
+			}
+			schemaName = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--schema="):
+			schemaName = strings.TrimPrefix(arg, "--schema=")
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx config describe <key> [--schema NAME]")
+		os.Exit(1)
+	}
+	key := positional[0]
+
+	schema, err := loadSchema(schemaName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	prop := schemaAt(schema, keyPathOrExit(key))
+	if prop == nil {
+		fmt.Fprintf(os.Stderr, "Error: no schema for key: %s\n", key)
+		os.Exit(1)
+	}
+
+	header := key
+	if len(prop.Type) > 0 {
+		header += " (" + strings.Join(prop.Type, " or ") + ")"
+	}
+	fmt.Println(header)
+	if prop.Description != "" {
+		fmt.Println("  " + prop.Description)
+		fmt.Println()
+	}
+
+	if prop.Default.Kind != 0 {
+		fmt.Printf("  Default:  %s\n", renderInline(&prop.Default))
+	}
+	if len(prop.Enum) > 0 {
+		fmt.Printf("  Allowed:  %s\n", strings.Join(prop.Enum, ", "))
+	}
+	if len(prop.Required) > 0 {
+		fmt.Printf("  Required: %s\n", strings.Join(prop.Required, ", "))
+	}
+	if keys := prop.sortedProperties(); len(keys) > 0 {
+		fmt.Printf("  Keys:     %s\n", strings.Join(keys, ", "))
+	}
+
+	if schemaName == "config" {
+		if ec, err := loadEffectiveConfig(configOptions{}); err == nil {
+			if node := ec.lookup(key); node != nil {
+				newInterpolator(ec.Root, false).expandTree(node, keyPathOrExit(key))
+				fmt.Printf("  Current:  %s  # %s\n", renderInline(resolveAlias(node)), ec.origin(node))
+			}
+		}
+	}
+}
+
+// isFile reports whether path exists and is not a directory
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Secret references in config values, resolved only when asked for with
+// --resolve-secrets (config get, yaml-get):
+//
+//	cred://oracle/prod/password   a key of the encrypted credential store
+//	env://ORACLE_PASSWORD         an environment variable
+//
+// Anything else that prints config (config show, effective, --explain)
+// shows the reference itself and never the secret.
+
+const (
+	credScheme = "cred://"
+	envScheme  = "env://"
+
+	redacted = "********"
+)
+
+// isSecretRef reports whether a config value is a cred:// or env:// reference
+func isSecretRef(value string) bool {
+	return strings.HasPrefix(value, credScheme) || strings.HasPrefix(value, envScheme)
+}
+
+// isSensitiveKey reports whether a key name looks like it holds a secret
+func isSensitiveKey(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range []string{"password", "passwd", "secret", "token", "api_key", "private_key"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretValue is a reference found in a config tree
+type secretValue struct {
+	node *yaml.Node
+	path string
+}
+
+// resolveSecrets replaces every secret reference under node (found at
+// segs) with the secret it names, adding the replaced nodes to sensitive.
+// The credential store is opened once, and only if a cred:// value is found.
+func resolveSecrets(node *yaml.Node, segs []pathSegment, sensitive map[*yaml.Node]bool) error {
+	var refs []secretValue
+	collectSecretRefs(node, segs, &refs)
+	return resolveSecretRefs(refs, sensitive)
+}
+
+// resolveSecretRefs replaces the collected references with their secrets
+func resolveSecretRefs(refs []secretValue, sensitive map[*yaml.Node]bool) error {
+	if len(refs) == 0 {
+		return nil
+	}
+
+	var keys []string
+	for _, ref := range refs {
+		if key, ok := strings.CutPrefix(ref.node.Value, credScheme); ok {
+			if strings.Count(key, "/") < 2 {
+				return fmt.Errorf("%s: invalid credential reference %s (use cred://service/environment/name)", ref.path, ref.node.Value)
+			}
+			keys = append(keys, key)
+		}
+	}
+	creds, err := readCredentials(keys)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		var value string
+		if key, ok := strings.CutPrefix(ref.node.Value, credScheme); ok {
+			value = creds[key]
+		} else {
+			name := strings.TrimPrefix(ref.node.Value, envScheme)
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				return fmt.Errorf("%s: environment variable %s is not set", ref.path, name)
+			}
+			value = v
+		}
+		ref.node.Value, ref.node.Tag, ref.node.Style = value, "!!str", 0
+		sensitive[ref.node] = true
+	}
+	return nil
+}
+
+// collectSecretRefs finds the string scalars under node that are references
+func collectSecretRefs(node *yaml.Node, segs []pathSegment, refs *[]secretValue) {
+	node = resolveAlias(node)
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.ShortTag() == "!!str" && isSecretRef(node.Value) {
+			*refs = append(*refs, secretValue{node, formatKeyPath(segs)})
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			child := appendSegment(segs, pathSegment{kind: segmentKey, key: node.Content[i].Value})
+			collectSecretRefs(node.Content[i+1], child, refs)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			collectSecretRefs(item, appendSegment(segs, pathSegment{kind: segmentIndex, index: i}), refs)
+		}
+	}
+}
+
+// readCredentials decrypts keys from the credential store, which is
+// opened once, so the master password is asked for at most once (and not
+// at all while the agent holds the store)
+func readCredentials(keys []string) (map[string]string, error) {
+	creds := make(map[string]string)
+	if len(keys) == 0 {
+		return creds, nil
+	}
+
+	store, err := openCredValues()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if creds[key], err = store.Value(key); err != nil {
+			return nil, err
+		}
+	}
+	return creds, nil
+}
+
+// displayValue renders a node inline for humans, hiding resolved secrets
+func displayValue(node *yaml.Node, sensitive map[*yaml.Node]bool) string {
+	if sensitive[node] {
+		return redacted
+	}
+	return renderInline(node)
+}
+
+// configSecrets lists the effective config values that are, or look like,
+// secrets for config show: references as written, plain text redacted
+func configSecrets(ec *EffectiveConfig) []string {
+	var lines []string
+	ec.walkLeaves(func(path string, node *yaml.Node) {
+		if node.Kind != yaml.ScalarNode || node.ShortTag() == "!!null" || node.Value == "" {
+			return
+		}
+		segs, _ := parseKeyPath(path)
+		switch {
+		case isSecretRef(node.Value):
+			lines = append(lines, fmt.Sprintf("%s = %s  # %s", path, node.Value, ec.origin(node)))
+		case len(segs) > 0 && isSensitiveKey(segs[len(segs)-1].key) && !isInterpolated(node):
+			lines = append(lines, fmt.Sprintf("%s = %s  # %s (plain text, use cred://)", path, redacted, ec.origin(node)))
+		}
+	})
+	return lines
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// envVar is a single environment variable emitted for a shell
+type envVar struct {
+	Name  string
+	Value string
+}
+
+// shellFormats lists the output formats accepted by --shell
+var shellFormats = []string{"bash", "zsh", "sh", "fish", "env"}
+
+// isShellFormat reports whether format is a known --shell value
+func isShellFormat(format string) bool {
+	for _, f := range shellFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// writeEnv prints vars in the syntax of the given shell.
+// All formats are data-only: values are always quoted, never interpolated,
+// so the output is safe to eval and the "env" format can be parsed line by
+// line, splitting at the first '=' (`${line%%=*}` and `${line#*=}`).
+func writeEnv(w io.Writer, shell string, vars []envVar) error {
+	for _, v := range vars {
+		switch shell {
+		case "bash", "zsh", "sh":
+			fmt.Fprintf(w, "export %s=%s\n", v.Name, shellQuote(v.Value))
+		case "fish":
+			fmt.Fprintf(w, "set -gx %s %s\n", v.Name, fishValue(v.Name, v.Value))
+		case "env":
+			if strings.ContainsAny(v.Value, "\n\x00") {
+				return fmt.Errorf("value of %s contains a newline and cannot be written in env format", v.Name)
+			}
+			fmt.Fprintf(w, "%s=%s\n", v.Name, v.Value)
+		default:
+			return fmt.Errorf("unknown shell: %s (use %s)", shell, strings.Join(shellFormats, ", "))
+		}
+	}
+	return nil
+}
+
+// writeEnvData prints vars in a format meant to be parsed, never
+// evaluated: env is NAME=value lines, dotenv quotes values that need it,
+// null-delimited is NAME=value\0 records (values may contain newlines),
+// json is an object.
+func writeEnvData(w io.Writer, format string, vars []envVar) error {
+	switch format {
+	case "json":
+		object := make(orderedMap, 0, len(vars))
+		for _, v := range vars {
+			object = append(object, orderedEntry{v.Name, v.Value})
+		}
+		out, err := json.MarshalIndent(object, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(out))
+	case "null-delimited":
+		for _, v := range vars {
+			if strings.ContainsRune(v.Value, 0) {
+				return fmt.Errorf("value of %s contains a NUL byte", v.Name)
+			}
+			fmt.Fprintf(w, "%s=%s\x00", v.Name, v.Value)
+		}
+	case "dotenv":
+		for _, v := range vars {
+			fmt.Fprintf(w, "%s=%s\n", v.Name, quoteDotenv(v.Value))
+		}
+	default:
+		return writeEnv(w, "env", vars)
+	}
+	return nil
+}
+
+// shellQuote wraps s in single quotes for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fishQuote wraps s in single quotes for fish
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "'", `\'`)
+	return "'" + s + "'"
+}
+
+// fishValue quotes a value for fish, splitting *PATH variables into lists
+func fishValue(name, value string) string {
+	if !strings.HasSuffix(name, "PATH") || value == "" {
+		return fishQuote(value)
+	}
+	parts := strings.Split(value, ":")
+	for i, p := range parts {
+		parts[i] = fishQuote(p)
+	}
+	return strings.Join(parts, " ")
+}
+
+// prependPath puts dir in front of a colon-separated list, dropping any
+// existing occurrence of dir and of the entries in remove
+func prependPath(list, dir string, remove ...string) string {
+	drop := map[string]bool{dir: true}
+	for _, r := range remove {
+		drop[r] = true
+	}
+
+	result := []string{dir}
+	for _, p := range strings.Split(list, ":") {
+		if p == "" || drop[p] {
+			continue
+		}
+		result = append(result, p)
+	}
+	return strings.Join(result, ":")
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// openTerminal opens the controlling terminal for prompts
+func openTerminal() (*os.File, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
+
+// disableEcho turns off echo on tty and returns a function restoring it
+func disableEcho(tty *os.File) func() {
+	stty := func(arg string) {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = tty
+		cmd.Run()
+	}
+	stty("-echo")
+	return func() { stty("echo") }
+}
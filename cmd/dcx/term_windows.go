@@ -0,0 +1,31 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"unsafe"
+)
+
+var (
+	procGetConsoleMode = kernel32.NewProc("GetConsoleMode")
+	procSetConsoleMode = kernel32.NewProc("SetConsoleMode")
+)
+
+const enableEchoInput = 0x4
+
+// openTerminal opens the console input for prompts
+func openTerminal() (*os.File, error) {
+	return os.OpenFile("CONIN$", os.O_RDWR, 0)
+}
+
+// disableEcho turns off echo on the console and returns a function
+// restoring it
+func disableEcho(tty *os.File) func() {
+	var mode uint32
+	if r, _, _ := procGetConsoleMode.Call(tty.Fd(), uintptr(unsafe.Pointer(&mode))); r == 0 {
+		return func() {}
+	}
+	procSetConsoleMode.Call(tty.Fd(), uintptr(mode&^enableEchoInput))
+	return func() { procSetConsoleMode.Call(tty.Fd(), uintptr(mode)) }
+}
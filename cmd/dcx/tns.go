@@ -0,0 +1,569 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tnsNode is a KEY = value pair from a .ora file.
+// Value holds scalar values; Children holds nested (KEY = ...) groups.
+type tnsNode struct {
+	Key      string
+	Value    string
+	Children []*tnsNode
+}
+
+// find returns the first descendant (depth-first) with the given key
+func (n *tnsNode) find(key string) *tnsNode {
+	for _, c := range n.Children {
+		if strings.EqualFold(c.Key, key) {
+			return c
+		}
+		if found := c.find(key); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findAll returns every descendant with the given key
+func (n *tnsNode) findAll(key string) []*tnsNode {
+	var result []*tnsNode
+	for _, c := range n.Children {
+		if strings.EqualFold(c.Key, key) {
+			result = append(result, c)
+		}
+		result = append(result, c.findAll(key)...)
+	}
+	return result
+}
+
+// value returns the scalar value of the first descendant with key
+func (n *tnsNode) value(key string) string {
+	if c := n.find(key); c != nil {
+		return c.Value
+	}
+	return ""
+}
+
+// tnsParser parses the parenthesized KEY = VALUE syntax shared by
+// tnsnames.ora, sqlnet.ora and listener.ora
+type tnsParser struct {
+	tokens []string
+	pos    int
+	file   string
+}
+
+// tokenizeOra splits .ora content into "(", ")", "=", "," and words.
+// Comments start with # and run to the end of the line.
+func tokenizeOra(data string) []string {
+	var tokens []string
+	var word strings.Builder
+
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '#':
+			flush()
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			flush()
+			end := strings.IndexByte(data[i+1:], c)
+			if end < 0 {
+				end = len(data) - i - 1
+			}
+			tokens = append(tokens, data[i+1:i+1+end])
+			i += end + 1
+		case c == '(' || c == ')' || c == '=' || c == ',':
+			flush()
+			tokens = append(tokens, string(c))
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+		default:
+			word.WriteByte(c)
+		}
+	}
+	flush()
+	return tokens
+}
+
+func (p *tnsParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *tnsParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *tnsParser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		if got == "" {
+			got = "end of file"
+		}
+		return fmt.Errorf("%s: expected %q, got %q", p.file, tok, got)
+	}
+	return nil
+}
+
+// parseEntries parses top-level "name[, name] = value" entries.
+// Aliases sharing one definition each get their own node.
+func (p *tnsParser) parseEntries() ([]*tnsNode, error) {
+	var entries []*tnsNode
+	for p.peek() != "" {
+		names := []string{p.next()}
+		for p.peek() == "," {
+			p.next()
+			names = append(names, p.next())
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			entries = append(entries, &tnsNode{Key: name, Value: value.Value, Children: value.Children})
+		}
+	}
+	return entries, nil
+}
+
+// parseValue parses a scalar, a sequence of (KEY = value) groups or a
+// parenthesized list of bare values such as (TNSNAMES, EZCONNECT), which
+// is kept as the comma-joined Value
+func (p *tnsParser) parseValue() (*tnsNode, error) {
+	node := &tnsNode{}
+	if p.peek() != "(" {
+		// Scalars may span several words, e.g. unquoted paths with spaces
+		var words []string
+		for tok := p.peek(); tok != "" && tok != "(" && tok != ")"; tok = p.peek() {
+			if len(words) > 0 && p.pos+1 < len(p.tokens) && (p.tokens[p.pos+1] == "=" || p.tokens[p.pos+1] == ",") {
+				break // next top-level entry
+			}
+			words = append(words, p.next())
+		}
+		node.Value = strings.Join(words, " ")
+		return node, nil
+	}
+
+	if p.pos+2 < len(p.tokens) && p.tokens[p.pos+2] != "=" {
+		return p.parseList()
+	}
+	for p.peek() == "(" {
+		p.next()
+		key := p.next()
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		child, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		child.Key = key
+		node.Children = append(node.Children, child)
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+// parseList parses "(value, value, ...)"
+func (p *tnsParser) parseList() (*tnsNode, error) {
+	p.next()
+	var items []string
+	for {
+		item := p.next()
+		if item == "" || item == "(" || item == ")" || item == "," || item == "=" {
+			return nil, fmt.Errorf("%s: expected a value in list, got %q", p.file, item)
+		}
+		items = append(items, item)
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return &tnsNode{Value: strings.Join(items, ",")}, nil
+}
+
+// parseOraFile parses a .ora file, following IFILE includes.
+// Relative includes are resolved against the including file's directory.
+func parseOraFile(path string, seen map[string]bool) ([]*tnsNode, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if seen[abs] {
+		return nil, fmt.Errorf("IFILE cycle detected at %s", path)
+	}
+	seen[abs] = true
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &tnsParser{tokens: tokenizeOra(string(data)), file: path}
+	entries, err := p.parseEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*tnsNode
+	for _, e := range entries {
+		if !strings.EqualFold(e.Key, "IFILE") {
+			result = append(result, e)
+			continue
+		}
+		include := e.Value
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		included, err := parseOraFile(include, seen)
+		if err != nil {
+			return nil, fmt.Errorf("IFILE %s: %w", e.Value, err)
+		}
+		result = append(result, included...)
+	}
+	return result, nil
+}
+
+// tnsOptions holds the location overrides shared by the tns subcommands
+type tnsOptions struct {
+	tnsAdmin string
+	sid      string
+}
+
+// getTNSAdmin returns the directory holding tnsnames.ora and sqlnet.ora
+// Priority: --tns-admin flag > TNS_ADMIN > <oracle home>/network/admin
+func (o tnsOptions) getTNSAdmin() (string, error) {
+	if o.tnsAdmin != "" {
+		return o.tnsAdmin, nil
+	}
+	if dir := os.Getenv("TNS_ADMIN"); dir != "" && o.sid == "" {
+		return dir, nil
+	}
+	home, err := resolveOracleHome(o.sid)
+	if err != nil {
+		return "", err
+	}
+	if home != "" {
+		return filepath.Join(home, "network", "admin"), nil
+	}
+	return "", fmt.Errorf("cannot locate tnsnames.ora: set TNS_ADMIN or ORACLE_HOME, or pass --tns-admin")
+}
+
+// TNSAddress is one protocol address of a connect descriptor
+type TNSAddress struct {
+	Protocol string `json:"protocol"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+}
+
+// TNSEntry is a resolved tnsnames.ora alias
+type TNSEntry struct {
+	Alias       string       `json:"alias"`
+	Host        string       `json:"host"`
+	Port        int          `json:"port"`
+	ServiceName string       `json:"service_name,omitempty"`
+	SID         string       `json:"sid,omitempty"`
+	Addresses   []TNSAddress `json:"addresses"`
+}
+
+// service returns SERVICE_NAME, falling back to SID for old descriptors
+func (e TNSEntry) service() string {
+	if e.ServiceName != "" {
+		return e.ServiceName
+	}
+	return e.SID
+}
+
+// newTNSEntry extracts addresses and connect data from a descriptor node
+func newTNSEntry(node *tnsNode) TNSEntry {
+	entry := TNSEntry{Alias: node.Key, Addresses: []TNSAddress{}}
+	for _, addr := range node.findAll("ADDRESS") {
+		port, _ := strconv.Atoi(addr.value("PORT"))
+		entry.Addresses = append(entry.Addresses, TNSAddress{
+			Protocol: strings.ToUpper(addr.value("PROTOCOL")),
+			Host:     addr.value("HOST"),
+			Port:     port,
+		})
+	}
+	if len(entry.Addresses) > 0 {
+		entry.Host = entry.Addresses[0].Host
+		entry.Port = entry.Addresses[0].Port
+	}
+	if cd := node.find("CONNECT_DATA"); cd != nil {
+		entry.ServiceName = cd.value("SERVICE_NAME")
+		entry.SID = cd.value("SID")
+	}
+	return entry
+}
+
+// loadTNSEntries parses tnsnames.ora from the resolved TNS_ADMIN
+func loadTNSEntries(opts tnsOptions) ([]TNSEntry, error) {
+	dir, err := opts.getTNSAdmin()
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := parseOraFile(filepath.Join(dir, "tnsnames.ora"), map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []TNSEntry
+	for _, n := range nodes {
+		entries = append(entries, newTNSEntry(n))
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return strings.ToLower(entries[i].Alias) < strings.ToLower(entries[j].Alias)
+	})
+	return entries, nil
+}
+
+// resolveTNSAlias finds alias (case-insensitive). An alias without a domain
+// also matches "alias.<domain>" entries, as NAMES.DEFAULT_DOMAIN would.
+func resolveTNSAlias(alias string, opts tnsOptions) (TNSEntry, error) {
+	entries, err := loadTNSEntries(opts)
+	if err != nil {
+		return TNSEntry{}, err
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.Alias, alias) {
+			return e, nil
+		}
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(strings.ToLower(e.Alias), strings.ToLower(alias)+".") {
+			return e, nil
+		}
+	}
+	return TNSEntry{}, fmt.Errorf("TNS alias not found: %s", alias)
+}
+
+// walletLocation returns the wallet directory configured in sqlnet.ora
+// (WALLET_LOCATION or ENCRYPTION_WALLET_LOCATION METHOD_DATA DIRECTORY)
+func walletLocation(opts tnsOptions) (string, error) {
+	dir, err := opts.getTNSAdmin()
+	if err != nil {
+		return "", err
+	}
+	nodes, err := parseOraFile(filepath.Join(dir, "sqlnet.ora"), map[string]bool{})
+	if err != nil {
+		return "", err
+	}
+	for _, key := range []string{"WALLET_LOCATION", "ENCRYPTION_WALLET_LOCATION"} {
+		for _, n := range nodes {
+			if !strings.EqualFold(n.Key, key) {
+				continue
+			}
+			if wallet := n.value("DIRECTORY"); wallet != "" {
+				return wallet, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no WALLET_LOCATION in %s", filepath.Join(dir, "sqlnet.ora"))
+}
+
+// checkTNSAddress opens a TCP connection to addr to test reachability
+func checkTNSAddress(addr TNSAddress, timeout time.Duration) error {
+	if addr.Protocol != "" && addr.Protocol != "TCP" && addr.Protocol != "TCPS" {
+		return fmt.Errorf("protocol %s cannot be probed", addr.Protocol)
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(addr.Host, strconv.Itoa(addr.Port)), timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// handleTNS handles the "dcx tns" subcommand
+func handleTNS(args []string) {
+	if len(args) == 0 {
+		printTNSHelp()
+		return
+	}
+
+	var opts tnsOptions
+	var positional []string
+	jsonOutput := false
+	timeout := 5 * time.Second
+
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--tns-admin", "--sid", "--timeout":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", args[i])
+				os.Exit(1)
+			}
+			switch args[i] {
+			case "--tns-admin":
+				opts.tnsAdmin = args[i+1]
+			case "--sid":
+				opts.sid = args[i+1]
+			case "--timeout":
+				d, err := time.ParseDuration(args[i+1])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: invalid timeout: %s\n", args[i+1])
+					os.Exit(1)
+				}
+				timeout = d
+			}
+			i++
+		case "--json":
+			jsonOutput = true
+		default:
+			positional = append(positional, args[i])
+		}
+	}
+
+	switch args[0] {
+	case "list", "ls":
+		tnsList(opts, jsonOutput)
+
+	case "resolve":
+		if len(positional) < 1 {
+			fmt.Fprintln(os.Stderr, "Usage: dcx tns resolve <alias> [--json]")
+			os.Exit(1)
+		}
+		tnsResolve(positional[0], opts, jsonOutput)
+
+	case "check":
+		if len(positional) < 1 {
+			fmt.Fprintln(os.Stderr, "Usage: dcx tns check <alias> [--timeout 5s]")
+			os.Exit(1)
+		}
+		tnsCheck(positional[0], opts, timeout)
+
+	case "wallet":
+		wallet, err := walletLocation(opts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(wallet)
+
+	case "help", "-h", "--help":
+		printTNSHelp()
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown tns command: %s\n", args[0])
+		fmt.Fprintln(os.Stderr, "Run 'dcx tns help' for usage")
+		os.Exit(1)
+	}
+}
+
+func tnsList(opts tnsOptions, jsonOutput bool) {
+	entries, err := loadTNSEntries(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		if entries == nil {
+			entries = []TNSEntry{}
+		}
+		printJSON(entries)
+		return
+	}
+
+	fmt.Printf("%-24s %-30s %-6s %s\n", "Alias", "Host", "Port", "Service")
+	fmt.Printf("%-24s %-30s %-6s %s\n", "-----", "----", "----", "-------")
+	for _, e := range entries {
+		fmt.Printf("%-24s %-30s %-6d %s\n", e.Alias, e.Host, e.Port, e.service())
+	}
+}
+
+func tnsResolve(alias string, opts tnsOptions, jsonOutput bool) {
+	entry, err := resolveTNSAlias(alias, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput {
+		printJSON(entry)
+		return
+	}
+	fmt.Printf("alias: %s\n", entry.Alias)
+	fmt.Printf("host: %s\n", entry.Host)
+	fmt.Printf("port: %d\n", entry.Port)
+	fmt.Printf("service: %s\n", entry.service())
+}
+
+func tnsCheck(alias string, opts tnsOptions, timeout time.Duration) {
+	entry, err := resolveTNSAlias(alias, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(entry.Addresses) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: %s has no ADDRESS entries\n", entry.Alias)
+		os.Exit(1)
+	}
+
+	reachable := 0
+	for _, addr := range entry.Addresses {
+		target := net.JoinHostPort(addr.Host, strconv.Itoa(addr.Port))
+		if err := checkTNSAddress(addr, timeout); err != nil {
+			fmt.Printf("%-30s FAIL (%v)\n", target, err)
+			continue
+		}
+		fmt.Printf("%-30s OK\n", target)
+		reachable++
+	}
+
+	if reachable == 0 {
+		os.Exit(1)
+	}
+}
+
+func printTNSHelp() {
+	fmt.Println(`Usage: dcx tns <command> [options]
+
+Commands:
+  list [--json]              List aliases from tnsnames.ora
+  resolve <alias> [--json]   Show host, port and service of an alias
+  check <alias>              Probe TCP reachability of an alias's addresses
+  wallet                     Print the wallet directory from sqlnet.ora
+  help                       Show this help
+
+Options:
+  --tns-admin <dir>   Directory with tnsnames.ora/sqlnet.ora
+  --sid <SID>         Use <home>/network/admin of a SID from oratab
+  --timeout <dur>     Timeout for 'check' (default: 5s)
+
+Lookup Order:
+  --tns-admin > TNS_ADMIN > ORACLE_HOME/network/admin
+
+Examples:
+  dcx tns list
+  dcx tns resolve PRODDB --json
+  dcx tns check PRODDB --timeout 2s`)
+}
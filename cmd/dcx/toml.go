@@ -0,0 +1,698 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TOML support for the config file commands. Documents are read into the
+// same yaml.Node trees as YAML files so key paths work unchanged: tables
+// become mappings, arrays of tables become lists of mappings, and
+// datetimes keep their text with a !!timestamp tag.
+
+// tomlParser reads a TOML document
+type tomlParser struct {
+	data string
+	pos  int
+	line int
+	bol  int // offset of the current line start
+}
+
+// decodeTOML parses TOML into a mapping node
+func decodeTOML(data []byte) (*yaml.Node, error) {
+	p := &tomlParser{data: string(data), line: 1}
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: 1, Column: 1}
+	current := root
+
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return root, nil
+		}
+
+		if p.peek() == '[' {
+			array := strings.HasPrefix(p.data[p.pos:], "[[")
+			if array {
+				p.pos += 2
+			} else {
+				p.pos++
+			}
+			line := p.line
+			keys, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			closing := "]"
+			if array {
+				closing = "]]"
+			}
+			p.skipBlank(false)
+			if !strings.HasPrefix(p.data[p.pos:], closing) {
+				return nil, p.errorf("expected %s", closing)
+			}
+			p.pos += len(closing)
+
+			if array {
+				current, err = tomlArrayTable(root, keys, line)
+			} else {
+				current, err = tomlTable(root, keys, line)
+			}
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+		} else if err := p.parseKeyValue(current); err != nil {
+			return nil, err
+		}
+
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *tomlParser) eof() bool  { return p.pos >= len(p.data) }
+func (p *tomlParser) peek() byte { return p.data[p.pos] }
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// skipBlank skips spaces, tabs and comments, and newlines when asked
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		case c == '\n' && newlines:
+			p.newline()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) newline() {
+	p.pos++
+	p.line++
+	p.bol = p.pos
+}
+
+func (p *tomlParser) column() int {
+	return utf8.RuneCountInString(p.data[p.bol:p.pos]) + 1
+}
+
+// endOfLine requires only a comment between here and the next line
+func (p *tomlParser) endOfLine() error {
+	p.skipBlank(false)
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != '\n' {
+		return p.errorf("unexpected %q", p.peek())
+	}
+	p.newline()
+	return nil
+}
+
+// parseKey reads a dotted key: a.b, "quoted.key", 'literal'
+func (p *tomlParser) parseKey() ([]*yaml.Node, error) {
+	var keys []*yaml.Node
+	for {
+		p.skipBlank(false)
+		if p.eof() {
+			return nil, p.errorf("expected key")
+		}
+		node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Line: p.line, Column: p.column()}
+		switch p.peek() {
+		case '"':
+			s, err := p.basicString()
+			if err != nil {
+				return nil, err
+			}
+			node.Value = s
+		case '\'':
+			s, err := p.literalString()
+			if err != nil {
+				return nil, err
+			}
+			node.Value = s
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, p.errorf("invalid key character %q", p.peek())
+			}
+			node.Value = p.data[start:p.pos]
+		}
+		keys = append(keys, node)
+
+		p.skipBlank(false)
+		if p.eof() || p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// parseKeyValue reads "key = value" into table
+func (p *tomlParser) parseKeyValue(table *yaml.Node) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	if p.eof() || p.peek() != '=' {
+		return p.errorf("expected = after key")
+	}
+	p.pos++
+	p.skipBlank(false)
+
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys[:len(keys)-1] {
+		idx := mappingIndex(table, key.Value)
+		if idx < 0 {
+			child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: key.Line, Column: key.Column}
+			table.Content = append(table.Content, key, child)
+			table = child
+			continue
+		}
+		if table = table.Content[idx+1]; table.Kind != yaml.MappingNode {
+			return p.errorf("key %s is not a table", key.Value)
+		}
+	}
+
+	last := keys[len(keys)-1]
+	if mappingIndex(table, last.Value) >= 0 {
+		return p.errorf("duplicate key %s", last.Value)
+	}
+	table.Content = append(table.Content, last, value)
+	return nil
+}
+
+// parseValue reads any TOML value
+func (p *tomlParser) parseValue() (*yaml.Node, error) {
+	if p.eof() {
+		return nil, p.errorf("expected value")
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Line: p.line, Column: p.column()}
+
+	switch c := p.peek(); {
+	case c == '"':
+		s, err := p.basicString()
+		node.Tag, node.Value = "!!str", s
+		return node, err
+
+	case c == '\'':
+		s, err := p.literalString()
+		node.Tag, node.Value = "!!str", s
+		return node, err
+
+	case c == '[':
+		p.pos++
+		node.Kind, node.Tag = yaml.SequenceNode, "!!seq"
+		for {
+			p.skipBlank(true)
+			if p.eof() {
+				return nil, p.errorf("unterminated array")
+			}
+			if p.peek() == ']' {
+				p.pos++
+				return node, nil
+			}
+			item, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, item)
+			p.skipBlank(true)
+			if !p.eof() && p.peek() == ',' {
+				p.pos++
+			} else if p.eof() || p.peek() != ']' {
+				return nil, p.errorf("expected , or ] in array")
+			}
+		}
+
+	case c == '{':
+		p.pos++
+		node.Kind, node.Tag = yaml.MappingNode, "!!map"
+		p.skipBlank(false)
+		if !p.eof() && p.peek() == '}' {
+			p.pos++
+			return node, nil
+		}
+		for {
+			if err := p.parseKeyValue(node); err != nil {
+				return nil, err
+			}
+			p.skipBlank(false)
+			if p.eof() {
+				return nil, p.errorf("unterminated inline table")
+			}
+			if p.peek() == '}' {
+				p.pos++
+				return node, nil
+			}
+			if p.peek() != ',' {
+				return nil, p.errorf("expected , or } in inline table")
+			}
+			p.pos++
+		}
+
+	default:
+		start := p.pos
+		for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+			p.pos++
+		}
+		// "1979-05-27 07:32:00" is a datetime with a space
+		if tomlDate.MatchString(p.data[start:p.pos]) && strings.HasPrefix(p.data[p.pos:], " ") &&
+			len(p.data) > p.pos+3 && p.data[p.pos+3] == ':' {
+			p.pos++
+			for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+				p.pos++
+			}
+		}
+		token := p.data[start:p.pos]
+		tag, value, ok := tomlScalar(token)
+		if !ok {
+			return nil, p.errorf("invalid value %q", token)
+		}
+		node.Tag, node.Value = tag, value
+		return node, nil
+	}
+}
+
+var (
+	tomlDate     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	tomlDateTime = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}([Tt ]\d{2}:\d{2}:\d{2}(\.\d+)?([Zz]|[+-]\d{2}:\d{2})?)?$`)
+	tomlTime     = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(\.\d+)?$`)
+	tomlInt      = regexp.MustCompile(`^([+-]?(0|[1-9]\d*)|0x[0-9A-Fa-f]+|0o[0-7]+|0b[01]+)$`)
+)
+
+// tomlScalar classifies a bare TOML value and returns its YAML tag and text
+func tomlScalar(token string) (string, string, bool) {
+	switch token {
+	case "true", "false":
+		return "!!bool", token, true
+	case "inf", "+inf":
+		return "!!float", ".inf", true
+	case "-inf":
+		return "!!float", "-.inf", true
+	case "nan", "+nan", "-nan":
+		return "!!float", ".nan", true
+	}
+	switch {
+	case tomlDateTime.MatchString(token):
+		return "!!timestamp", token, true
+	case tomlTime.MatchString(token):
+		return "!!str", token, true
+	}
+
+	digits := strings.ReplaceAll(token, "_", "")
+	if tomlInt.MatchString(digits) {
+		if i, err := strconv.ParseInt(digits, 0, 64); err == nil {
+			return "!!int", strconv.FormatInt(i, 10), true
+		}
+	}
+	if _, err := strconv.ParseFloat(digits, 64); err == nil && strings.ContainsAny(digits, ".eE") {
+		return "!!float", digits, true
+	}
+	return "", "", false
+}
+
+// basicString reads "..." or """...""" with escapes
+func (p *tomlParser) basicString() (string, error) {
+	multi := strings.HasPrefix(p.data[p.pos:], `"""`)
+	if multi {
+		p.pos += 3
+		if strings.HasPrefix(p.data[p.pos:], "\n") {
+			p.newline()
+		} else if strings.HasPrefix(p.data[p.pos:], "\r\n") {
+			p.pos++
+			p.newline()
+		}
+	} else {
+		p.pos++
+	}
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		switch {
+		case multi && strings.HasPrefix(p.data[p.pos:], `"""`):
+			p.pos += 3
+			// up to two quotes may directly precede the closing delimiter
+			for i := 0; i < 2 && !p.eof() && p.peek() == '"'; i++ {
+				b.WriteByte('"')
+				p.pos++
+			}
+			return b.String(), nil
+		case !multi && c == '"':
+			p.pos++
+			return b.String(), nil
+		case c == '\n':
+			if !multi {
+				return "", p.errorf("newline in string")
+			}
+			b.WriteByte('\n')
+			p.newline()
+		case c == '\\':
+			p.pos++
+			if p.eof() {
+				return "", p.errorf("unterminated escape")
+			}
+			esc := p.peek()
+			p.pos++
+			switch esc {
+			case 'b':
+				b.WriteByte('\b')
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'f':
+				b.WriteByte('\f')
+			case 'r':
+				b.WriteByte('\r')
+			case 'e':
+				b.WriteByte(0x1b)
+			case '"', '\\':
+				b.WriteByte(esc)
+			case 'u', 'U':
+				n := 4
+				if esc == 'U' {
+					n = 8
+				}
+				if p.pos+n > len(p.data) {
+					return "", p.errorf("invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(p.data[p.pos:p.pos+n], 16, 32)
+				if err != nil {
+					return "", p.errorf("invalid unicode escape")
+				}
+				b.WriteRune(rune(r))
+				p.pos += n
+			case ' ', '\t', '\r', '\n':
+				if !multi {
+					return "", p.errorf("invalid escape")
+				}
+				// line-ending backslash trims the following whitespace
+				p.pos--
+				for !p.eof() && strings.ContainsRune(" \t\r\n", rune(p.peek())) {
+					if p.peek() == '\n' {
+						p.newline()
+					} else {
+						p.pos++
+					}
+				}
+			default:
+				return "", p.errorf("invalid escape \\%c", esc)
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// literalString reads a literal string, single or multi-line, without escapes
+func (p *tomlParser) literalString() (string, error) {
+	if strings.HasPrefix(p.data[p.pos:], "'''") {
+		p.pos += 3
+		if strings.HasPrefix(p.data[p.pos:], "\n") {
+			p.newline()
+		}
+		end := strings.Index(p.data[p.pos:], "'''")
+		if end < 0 {
+			return "", p.errorf("unterminated string")
+		}
+		for end+3 < len(p.data[p.pos:]) && p.data[p.pos+end+3] == '\'' {
+			end++
+		}
+		s := p.data[p.pos : p.pos+end]
+		for _, c := range s {
+			if c == '\n' {
+				p.line++
+			}
+		}
+		p.pos += end + 3
+		if i := strings.LastIndexByte(p.data[:p.pos], '\n'); i >= 0 {
+			p.bol = i + 1
+		}
+		return s, nil
+	}
+
+	p.pos++
+	end := strings.IndexAny(p.data[p.pos:], "'\n")
+	if end < 0 || p.data[p.pos+end] != '\'' {
+		return "", p.errorf("unterminated string")
+	}
+	s := p.data[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+// tomlTable returns the table for a [a.b] header, creating it as needed
+func tomlTable(root *yaml.Node, keys []*yaml.Node, line int) (*yaml.Node, error) {
+	table := root
+	for _, key := range keys {
+		idx := mappingIndex(table, key.Value)
+		if idx < 0 {
+			child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: line, Column: 1}
+			table.Content = append(table.Content, key, child)
+			table = child
+			continue
+		}
+		switch next := table.Content[idx+1]; next.Kind {
+		case yaml.MappingNode:
+			table = next
+		case yaml.SequenceNode:
+			// [a.b] after [[a]] refers to the last element of a
+			if len(next.Content) == 0 || next.Content[len(next.Content)-1].Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("%s is not a table", key.Value)
+			}
+			table = next.Content[len(next.Content)-1]
+		default:
+			return nil, fmt.Errorf("%s is not a table", key.Value)
+		}
+	}
+	return table, nil
+}
+
+// tomlArrayTable appends a new table for a [[a.b]] header
+func tomlArrayTable(root *yaml.Node, keys []*yaml.Node, line int) (*yaml.Node, error) {
+	parent, err := tomlTable(root, keys[:len(keys)-1], line)
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	item := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: line, Column: 1}
+
+	idx := mappingIndex(parent, last.Value)
+	if idx < 0 {
+		list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: line, Column: 1}
+		parent.Content = append(parent.Content, last, list)
+		idx = len(parent.Content) - 2
+	}
+	list := parent.Content[idx+1]
+	if list.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("%s is not an array of tables", last.Value)
+	}
+	list.Content = append(list.Content, item)
+	return item, nil
+}
+
+// encodeTOML writes a mapping node as TOML
+func encodeTOML(root *yaml.Node) ([]byte, error) {
+	root = resolveAlias(root)
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("TOML documents must be tables")
+	}
+	var buf bytes.Buffer
+	if err := writeTOMLTable(&buf, nil, root, false); err != nil {
+		return nil, err
+	}
+	return bytes.TrimLeft(buf.Bytes(), "\n"), nil
+}
+
+// writeTOMLTable writes the key/values of a table, then its sub-tables
+func writeTOMLTable(buf *bytes.Buffer, path []string, table *yaml.Node, arrayItem bool) error {
+	var tables, arrays []int
+	var body bytes.Buffer
+
+	for i := 0; i+1 < len(table.Content); i += 2 {
+		value := resolveAlias(table.Content[i+1])
+		switch {
+		case value.Kind == yaml.MappingNode:
+			tables = append(tables, i)
+		case isTableArray(value):
+			arrays = append(arrays, i)
+		default:
+			text, err := tomlValue(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", strings.Join(append(path, table.Content[i].Value), "."), err)
+			}
+			fmt.Fprintf(&body, "%s = %s\n", tomlKey(table.Content[i].Value), text)
+		}
+	}
+
+	if len(path) > 0 && (arrayItem || body.Len() > 0 || len(tables)+len(arrays) == 0) {
+		header := tomlKeyPath(path)
+		if arrayItem {
+			fmt.Fprintf(buf, "\n[[%s]]\n", header)
+		} else {
+			fmt.Fprintf(buf, "\n[%s]\n", header)
+		}
+	}
+	buf.Write(body.Bytes())
+
+	for _, i := range tables {
+		child := append(append([]string(nil), path...), table.Content[i].Value)
+		if err := writeTOMLTable(buf, child, resolveAlias(table.Content[i+1]), false); err != nil {
+			return err
+		}
+	}
+	for _, i := range arrays {
+		child := append(append([]string(nil), path...), table.Content[i].Value)
+		for _, item := range resolveAlias(table.Content[i+1]).Content {
+			if err := writeTOMLTable(buf, child, resolveAlias(item), true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isTableArray reports whether a list is written as [[array]] tables
+func isTableArray(node *yaml.Node) bool {
+	if node.Kind != yaml.SequenceNode || len(node.Content) == 0 {
+		return false
+	}
+	for _, item := range node.Content {
+		if resolveAlias(item).Kind != yaml.MappingNode {
+			return false
+		}
+	}
+	return true
+}
+
+// tomlValue renders an inline TOML value
+func tomlValue(node *yaml.Node) (string, error) {
+	node = resolveAlias(node)
+	switch node.Kind {
+	case yaml.SequenceNode:
+		var items []string
+		for _, item := range node.Content {
+			text, err := tomlValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, text)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+
+	case yaml.MappingNode:
+		var items []string
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			text, err := tomlValue(node.Content[i+1])
+			if err != nil {
+				return "", err
+			}
+			items = append(items, tomlKey(node.Content[i].Value)+" = "+text)
+		}
+		if len(items) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(items, ", ") + " }", nil
+	}
+
+	switch node.ShortTag() {
+	case "!!null":
+		return "", fmt.Errorf("null has no TOML representation")
+	case "!!bool":
+		b, err := parseYAMLBool(node.Value)
+		return strconv.FormatBool(b), err
+	case "!!int":
+		var i int64
+		if err := node.Decode(&i); err != nil {
+			return "", err
+		}
+		return strconv.FormatInt(i, 10), nil
+	case "!!float":
+		switch strings.ToLower(node.Value) {
+		case ".inf", "+.inf":
+			return "inf", nil
+		case "-.inf":
+			return "-inf", nil
+		case ".nan":
+			return "nan", nil
+		}
+		var f float64
+		if err := node.Decode(&f); err != nil {
+			return "", err
+		}
+		text := strconv.FormatFloat(f, 'g', -1, 64)
+		if !strings.ContainsAny(text, ".e") {
+			text += ".0"
+		}
+		return text, nil
+	case "!!timestamp":
+		if tomlDateTime.MatchString(node.Value) {
+			return node.Value, nil
+		}
+	}
+	return tomlString(node.Value), nil
+}
+
+// tomlString quotes a basic string (JSON escapes are valid TOML escapes)
+func tomlString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// tomlKey returns a bare key when possible, a quoted one otherwise
+func tomlKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for i := 0; i < len(key); i++ {
+		if !isBareKeyChar(key[i]) {
+			return tomlString(key)
+		}
+	}
+	return key
+}
+
+func tomlKeyPath(path []string) string {
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = tomlKey(key)
+	}
+	return strings.Join(keys, ".")
+}
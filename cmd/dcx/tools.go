@@ -21,10 +21,34 @@ type ToolConfig struct {
 	Description   string            `yaml:"description"`
 	URLs          map[string]string `yaml:"urls"`
 	Binary        string            `yaml:"binary"`
-	ArchiveBinary string            `yaml:"archive_binary"` // Name of binary inside archive (if different from Binary)
+	ArchiveBinary platformString    `yaml:"archive_binary"` // Name of binary inside archive (if different from Binary)
 	Extract       string            `yaml:"extract"`
 }
 
+// platformString is a value that is either the same for every platform
+// or given per platform (e.g. archive_binary: {linux-amd64: yq_linux_amd64})
+type platformString struct {
+	Value      string
+	ByPlatform map[string]string
+}
+
+// UnmarshalYAML accepts a scalar or a platform -> value mapping
+func (p *platformString) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		p.Value = node.Value
+		return nil
+	}
+	return node.Decode(&p.ByPlatform)
+}
+
+// forPlatform returns the value for platform, or "" if none is defined
+func (p platformString) forPlatform(platform string) string {
+	if v, ok := p.ByPlatform[platform]; ok {
+		return v
+	}
+	return p.Value
+}
+
 // ToolsConfig represents the full tools.yaml configuration
 type ToolsConfig struct {
 	Settings struct {
@@ -35,7 +59,9 @@ type ToolsConfig struct {
 	Tools map[string]ToolConfig `yaml:"tools"`
 }
 
-// loadToolsConfig reads and parses etc/tools.yaml
+// loadToolsConfig reads etc/tools.yaml and merges the user registry
+// ($XDG_CONFIG_HOME/dcx/tools.yaml) on top of it. User entries replace
+// bundled tools of the same name and may add new ones.
 func loadToolsConfig() (*ToolsConfig, error) {
 	configPath := filepath.Join(getEtcDir(), "tools.yaml")
 
@@ -48,6 +74,20 @@ func loadToolsConfig() (*ToolsConfig, error) {
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse tools.yaml: %w", err)
 	}
+	if config.Tools == nil {
+		config.Tools = make(map[string]ToolConfig)
+	}
+
+	userPath := filepath.Join(getUserConfigDir(), "tools.yaml")
+	if data, err := os.ReadFile(userPath); err == nil {
+		var user ToolsConfig
+		if err := yaml.Unmarshal(data, &user); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", userPath, err)
+		}
+		for name, tool := range user.Tools {
+			config.Tools[name] = tool
+		}
+	}
 
 	return &config, nil
 }
@@ -219,8 +259,8 @@ func toolsInstall(name string, force bool) error {
 	// Extract - use ArchiveBinary if defined (for tools with different names in archive)
 	fmt.Println("  Extracting...")
 	binaryToFind := name
-	if tool.ArchiveBinary != "" {
-		binaryToFind = tool.ArchiveBinary
+	if archiveBinary := tool.ArchiveBinary.forPlatform(platform); archiveBinary != "" {
+		binaryToFind = archiveBinary
 	}
 	if ext == ".zip" {
 		if err := extractFromZip(archivePath, binaryToFind, destPath); err != nil {
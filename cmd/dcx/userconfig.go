@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Git-style config commands: get and list read the effective config unless
+// a scope flag names one layer file; set, unset and edit write to a layer
+// file, the global one (~/.config/dcx/config.yaml) by default.
+
+// configScopes maps the scope flags to their layers
+var configScopes = map[string]string{
+	"--system": layerSystem,
+	"--global": layerGlobal,
+	"--local":  layerLocal,
+}
+
+// extractScopeFlag removes a --system, --global or --local flag from args
+// and returns its layer name ("" without one)
+func extractScopeFlag(args []string) (string, []string, error) {
+	scope := ""
+	var rest []string
+	for _, arg := range args {
+		layer, ok := configScopes[arg]
+		switch {
+		case !ok:
+			rest = append(rest, arg)
+		case scope != "" && scope != layer:
+			return "", nil, fmt.Errorf("only one of --system, --global and --local may be given")
+		default:
+			scope = layer
+		}
+	}
+	return scope, rest, nil
+}
+
+// scopeFile returns the config file of a layer. The local file is the
+// nearest .dcx/config.yaml, or a new one in the nearest .dcx directory
+// (the working directory's when there is none). With a profile it is the
+// profile's sibling (config.<p>.yaml).
+func scopeFile(scope, profile string) (string, error) {
+	var path string
+	switch scope {
+	case layerSystem:
+		path = filepath.Join(getSystemConfigDir(), "config.yaml")
+	case layerLocal:
+		if path = findLocalConfig(); path == "" {
+			dir := findNearest(".dcx")
+			if dir == "" {
+				dir = ".dcx"
+			}
+			path = filepath.Join(dir, "config.yaml")
+		}
+	default:
+		path = filepath.Join(getUserConfigDir(), "config.yaml")
+	}
+	if profile == "" {
+		return path, nil
+	}
+	if !profileName.MatchString(profile) {
+		return "", fmt.Errorf("invalid profile name: %s", profile)
+	}
+	return profileFile(path, profile), nil
+}
+
+// parseScopedArgs splits the scope flag and the shared config flags off
+// args and returns the scope (defaultScope without a flag; "" stands for
+// the effective config), its file and the remaining arguments
+func parseScopedArgs(args []string, defaultScope string) (string, string, configOptions, []string) {
+	scope, rest, err := extractScopeFlag(args)
+	if scope == "" {
+		scope = defaultScope
+	}
+	if err == nil {
+		var opts configOptions
+		if opts, rest, err = parseConfigOptions(rest); err == nil {
+			file := ""
+			if scope != "" {
+				file, err = scopeFile(scope, opts.profile)
+			}
+			if err == nil {
+				return scope, file, opts, rest
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(1)
+	return "", "", configOptions{}, nil
+}
+
+// configGetCommand handles "dcx config get <key> [default]": the effective
+// value, or with a scope flag the value in that layer's file
+func configGetCommand(args []string) {
+	scope, file, opts, rest := parseScopedArgs(args, "")
+	if len(rest) < 1 || len(rest) > 2 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx config get <key> [default] [--system|--global|--local] [--explain] [--set key=value]")
+		os.Exit(1)
+	}
+	var defaultVal *string
+	if len(rest) == 2 {
+		defaultVal = &rest[1]
+	}
+
+	if scope == "" {
+		configGet(rest[0], defaultVal, opts)
+		return
+	}
+	format := ""
+	if opts.jsonOutput {
+		format = "json"
+	}
+	if _, err := os.Stat(file); os.IsNotExist(err) && defaultVal == nil {
+		// a missing layer file has no keys
+		os.Exit(1)
+	}
+	os.Exit(yamlGet(file, rest[0], defaultVal, format, !opts.raw, opts.strict, opts.secrets))
+}
+
+// configSetCommand handles "dcx config set <key> <value> [--type T]
+// [--value-file F|-]" on a layer file (global by default)
+func configSetCommand(args []string) {
+	_, file, _, rest := parseScopedArgs(args, layerGlobal)
+	if len(rest) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx config set <key> <value> [--system|--global|--local] [--type T] [--value-file F|-]")
+		os.Exit(1)
+	}
+	yamlSetCommand(append([]string{file}, rest...))
+}
+
+// configUnsetCommand handles "dcx config unset <key>" on a layer file
+func configUnsetCommand(args []string) {
+	_, file, _, rest := parseScopedArgs(args, layerGlobal)
+	if len(rest) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx config unset <key> [--system|--global|--local]")
+		os.Exit(1)
+	}
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error: key not found: %s\n", rest[0])
+		os.Exit(1)
+	}
+	yamlDelete(file, rest[0])
+}
+
+// configList handles "dcx config list": key=value for every leaf of the
+// effective config (with --explain, and its origin) or of a layer file
+func configList(args []string) {
+	scope, file, opts, rest := parseScopedArgs(args, "")
+	if len(rest) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx config list [--system|--global|--local] [--explain] [--no-interpolate] [--strict]")
+		os.Exit(1)
+	}
+
+	var root *yaml.Node
+	var ec *EffectiveConfig
+	var err error
+	if scope == "" {
+		if ec, err = loadEffectiveConfig(opts); err == nil {
+			root = ec.Root
+		}
+	} else {
+		root, err = loadYAMLMapping(file)
+	}
+	if err == nil && root != nil && !opts.raw {
+		err = newInterpolator(root, opts.strict).expandTree(root, nil)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if root == nil {
+		return
+	}
+
+	walkMappingLeaves(root, "", func(path string, node *yaml.Node) {
+		line := path + "=" + renderInline(node)
+		if opts.explain && ec != nil {
+			line += "  # " + ec.origin(node).String()
+		}
+		fmt.Println(line)
+	})
+}
+
+// configEdit handles "dcx config edit": opens a layer file (global by
+// default) in $VISUAL or $EDITOR under the config lock, then checks that
+// it still parses
+func configEdit(args []string) {
+	scope, file, _, rest := parseScopedArgs(args, layerGlobal)
+	if len(rest) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx config edit [--system|--global|--local] [--backup]")
+		os.Exit(1)
+	}
+
+	lock, err := lockFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer lock.unlock()
+
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		err = writeFileAtomic(file, nil, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	} else if backupWrites {
+		if err := backupFile(lock.path); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	editor := strings.Fields(firstNonEmpty(os.Getenv("VISUAL"), os.Getenv("EDITOR"), defaultEditor()))
+	cmd := exec.Command(editor[0], append(editor[1:], file)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", editor[0], err)
+		os.Exit(1)
+	}
+
+	if _, err := loadYAMLMapping(file); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Fix it with: dcx config edit --%s\n", scope)
+		os.Exit(1)
+	}
+}
+
+// configPathCommand handles "dcx config path": the file a scope writes to
+func configPathCommand(args []string) {
+	_, file, _, rest := parseScopedArgs(args, layerGlobal)
+	if len(rest) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: dcx config path [--system|--global|--local]")
+		os.Exit(1)
+	}
+	fmt.Println(file)
+}
+
+func defaultEditor() string {
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
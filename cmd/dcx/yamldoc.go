@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlDocument is a YAML file loaded as nodes so it can be edited without
+// losing comments, key order, quoting, anchors or document separators.
+// Edits apply to the first document; the others are written back untouched.
+// JSON, TOML and dotenv files load into the same nodes and are re-encoded
+// in their own format when saved.
+type yamlDocument struct {
+	path   string
+	format string
+	data   []byte
+	docs   []*yaml.Node
+	indent int
+
+	// splices are in-place scalar replacements; reencode is set when an
+	// edit cannot be spliced and the whole file must be re-encoded
+	splices  []yamlSplice
+	reencode bool
+
+	// lock is held from editYAMLDocument until close
+	lock *fileLock
+}
+
+// yamlSplice replaces one scalar token in the original bytes
+type yamlSplice struct {
+	offset int
+	length int
+	text   string
+}
+
+// loadYAMLDocument reads a config file in the format of formatForPath; a
+// missing file yields an empty document
+func loadYAMLDocument(path string) (*yamlDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return parseYAMLDocument(path, data, formatForPath(path))
+}
+
+// editYAMLDocument loads a file for a read-modify-write, holding its lock
+// until close (or exit) so concurrent writers cannot lose updates
+func editYAMLDocument(path string) (*yamlDocument, error) {
+	lock, err := lockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := loadYAMLDocument(path)
+	if err != nil {
+		lock.unlock()
+		return nil, err
+	}
+	doc.lock = lock
+	return doc, nil
+}
+
+// close releases the lock taken by editYAMLDocument
+func (d *yamlDocument) close() {
+	d.lock.unlock()
+	d.lock = nil
+}
+
+// parseYAMLDocument parses the contents of a config file in format
+func parseYAMLDocument(path string, data []byte, format string) (*yamlDocument, error) {
+	doc := &yamlDocument{path: path, format: format, data: data, indent: detectYAMLIndent(data)}
+
+	if doc.format != formatYAML {
+		root, err := decodeFormat(data, doc.format)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if root != nil {
+			doc.docs = []*yaml.Node{{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}}
+		}
+		// there is no YAML source to splice into
+		doc.reencode = true
+		return doc, nil
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var node yaml.Node
+		if err := dec.Decode(&node); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		doc.docs = append(doc.docs, &node)
+	}
+	return doc, nil
+}
+
+// root returns the first document's top-level node, or nil
+func (d *yamlDocument) root() *yaml.Node {
+	if len(d.docs) == 0 || len(d.docs[0].Content) == 0 {
+		return nil
+	}
+	return d.docs[0].Content[0]
+}
+
+// ensureRoot returns the top-level mapping, creating it in an empty file
+func (d *yamlDocument) ensureRoot() (*yaml.Node, error) {
+	if root := d.root(); root != nil {
+		if root.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s: top level is not a mapping", d.path)
+		}
+		return root, nil
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(d.docs) == 0 {
+		d.docs = append(d.docs, &yaml.Node{Kind: yaml.DocumentNode})
+	}
+	d.docs[0].Content = []*yaml.Node{root}
+	d.reencode = true
+	return root, nil
+}
+
+// find returns every node matching a key path in the first document
+func (d *yamlDocument) find(segs []pathSegment) []nodeMatch {
+	return findNodes(d.root(), d.keyPath(segs))
+}
+
+// keyPath returns the path under which a key is stored: in a dotenv file
+// nested keys are flat variables
+func (d *yamlDocument) keyPath(segs []pathSegment) []pathSegment {
+	if d.format == formatDotenv {
+		return dotenvPath(segs)
+	}
+	return segs
+}
+
+// set stores value at a key path. Replacing a scalar with a scalar keeps
+// the quoting style (for strings) and new keys or list items are appended
+// to their block collection, both spliced into the original bytes; anything
+// else (replacing maps or lists, flow collections) re-encodes the document.
+func (d *yamlDocument) set(segs []pathSegment, value *yaml.Node) error {
+	segs = d.keyPath(segs)
+	root, err := d.ensureRoot()
+	if err != nil {
+		return err
+	}
+
+	old := findOwnNode(root, segs)
+	if old == nil || segs[len(segs)-1].kind == segmentAppend {
+		inserted := !d.reencode && d.insert(root, segs, value)
+		if err := setPath(root, segs, value); err != nil {
+			return err
+		}
+		if !inserted {
+			d.reencode = true
+		}
+		return nil
+	}
+
+	if old.Kind == yaml.ScalarNode && value.Kind == yaml.ScalarNode {
+		if value.Tag == "!!str" && value.Style == 0 {
+			value.Style = old.Style &^ (yaml.LiteralStyle | yaml.FoldedStyle | yaml.TaggedStyle)
+		}
+		if d.reencode || !d.splice(old, value) {
+			d.reencode = true
+		}
+		old.Value, old.Tag, old.Style = value.Value, value.Tag, value.Style
+		return nil
+	}
+
+	if d.reencode || !d.replaceBlock(old, value) {
+		d.reencode = true
+	}
+	// keep the comments attached to the replaced node
+	value.HeadComment, value.LineComment, value.FootComment = old.HeadComment, old.LineComment, old.FootComment
+	*old = *value
+	return nil
+}
+
+// replaceBlock records a splice that swaps the lines of a block map or list
+// for value rendered at the same indentation
+func (d *yamlDocument) replaceBlock(old, value *yaml.Node) bool {
+	if old.Kind == yaml.ScalarNode || old.Style&yaml.FlowStyle != 0 || old.Anchor != "" || value.Kind == yaml.ScalarNode {
+		return false
+	}
+	last := lastLine(old)
+	if last <= 0 {
+		return false
+	}
+
+	start := lineColumnOffset(d.data, old.Line, 1)
+	first := lineColumnOffset(d.data, old.Line, old.Column)
+	if start < 0 || first < 0 || strings.TrimLeft(string(d.data[start:first]), " ") != "" {
+		return false
+	}
+	end := lineColumnOffset(d.data, last+1, 1)
+	suffix := ""
+	if end < 0 {
+		end = len(d.data)
+		suffix = "\n"
+	}
+
+	text, ok := d.renderBlock(value, old.Column-1)
+	if !ok {
+		return false
+	}
+	if suffix != "" {
+		text = strings.TrimSuffix(text, "\n")
+	}
+
+	return d.addSplice(yamlSplice{offset: start, length: end - start, text: text})
+}
+
+// renderBlock encodes node with the file's indentation, every line
+// shifted right by column spaces
+func (d *yamlDocument) renderBlock(node *yaml.Node, column int) (string, bool) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(d.indent)
+	if err := enc.Encode(node); err != nil {
+		return "", false
+	}
+	enc.Close()
+
+	indent := strings.Repeat(" ", column)
+	var text strings.Builder
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line != "" {
+			text.WriteString(indent + line)
+		}
+	}
+	return text.String(), true
+}
+
+// insert records a splice that appends a new key or list item (and any
+// missing parents) at the end of the deepest existing block collection
+// on its path
+func (d *yamlDocument) insert(root *yaml.Node, segs []pathSegment, value *yaml.Node) bool {
+	if len(segs) == 0 || hasWildcard(segs) {
+		return false
+	}
+
+	parent, depth := root, 0
+	for ; depth < len(segs)-1; depth++ {
+		child := findOwnNode(parent, segs[depth:depth+1])
+		if child == nil {
+			break
+		}
+		if !isContainer(child) {
+			return false
+		}
+		parent = child
+	}
+
+	var subtree *yaml.Node
+	switch {
+	case parent.Kind == yaml.MappingNode && segs[depth].kind == segmentKey:
+		subtree = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	case parent.Kind == yaml.SequenceNode && segs[depth].kind == segmentAppend:
+		subtree = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	default:
+		return false
+	}
+	if len(parent.Content) == 0 || parent.Style&yaml.FlowStyle != 0 {
+		return false
+	}
+
+	last := lastLine(parent)
+	if last <= 0 {
+		return false
+	}
+	offset := lineColumnOffset(d.data, last+1, 1)
+	prefix := ""
+	if offset < 0 {
+		// last line of the file without a trailing newline
+		offset = len(d.data)
+		prefix = "\n"
+	}
+
+	if err := setPath(subtree, segs[depth:], value); err != nil {
+		return false
+	}
+	text, ok := d.renderBlock(subtree, parent.Column-1)
+	if !ok {
+		return false
+	}
+
+	return d.addSplice(yamlSplice{offset: offset, text: prefix + text})
+}
+
+// lastLine returns the last source line used by a node tree: 0 for nodes
+// added by earlier edits, -1 when it cannot be known (block scalars span
+// more lines than their start)
+func lastLine(node *yaml.Node) int {
+	if node.Line == 0 {
+		return 0
+	}
+	if node.Kind == yaml.ScalarNode && (node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 || strings.Contains(node.Value, "\n")) {
+		return -1
+	}
+	line := node.Line
+	for _, child := range node.Content {
+		l := lastLine(child)
+		if l < 0 {
+			return -1
+		}
+		if l > line {
+			line = l
+		}
+	}
+	return line
+}
+
+// splice records an in-place replacement of old with node when the old
+// token can be located exactly in the original bytes
+func (d *yamlDocument) splice(old, node *yaml.Node) bool {
+	if old.Anchor != "" || old.Line == 0 || old.Style&(yaml.LiteralStyle|yaml.FoldedStyle|yaml.TaggedStyle) != 0 {
+		return false
+	}
+
+	source, err := renderScalarToken(old)
+	if err != nil {
+		return false
+	}
+	text, err := renderScalarToken(node)
+	if err != nil || strings.Contains(text, "\n") {
+		return false
+	}
+
+	offset := lineColumnOffset(d.data, old.Line, old.Column)
+	if offset < 0 || !bytes.HasPrefix(d.data[offset:], []byte(source)) {
+		return false
+	}
+
+	// keep an aligned trailing comment in its column
+	length := len(source)
+	rest := d.data[offset+length:]
+	if pad := len(rest) - len(bytes.TrimLeft(rest, " ")); pad > 0 && pad < len(rest) && rest[pad] == '#' {
+		length += pad
+		text += strings.Repeat(" ", max(1, pad+len(source)-len(text)))
+	}
+	return d.addSplice(yamlSplice{offset: offset, length: length, text: text})
+}
+
+// addSplice records s unless it overlaps an earlier splice
+func (d *yamlDocument) addSplice(s yamlSplice) bool {
+	for _, other := range d.splices {
+		if s.offset < other.offset+other.length && other.offset < s.offset+s.length {
+			return false
+		}
+		if s.length > 0 && other.length == 0 && other.offset > s.offset && other.offset < s.offset+s.length {
+			return false
+		}
+	}
+	d.splices = append(d.splices, s)
+	return true
+}
+
+// renderScalarToken returns the source text of a single scalar node
+func renderScalarToken(node *yaml.Node) (string, error) {
+	scalar := *node
+	scalar.HeadComment, scalar.LineComment, scalar.FootComment = "", "", ""
+	out, err := yaml.Marshal(&scalar)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// lineColumnOffset converts a 1-based line and rune column to a byte offset
+func lineColumnOffset(data []byte, line, column int) int {
+	offset := 0
+	for l := 1; l < line; l++ {
+		i := bytes.IndexByte(data[offset:], '\n')
+		if i < 0 {
+			return -1
+		}
+		offset += i + 1
+	}
+	for c := 1; c < column; c++ {
+		if offset >= len(data) || data[offset] == '\n' {
+			return -1
+		}
+		_, size := utf8.DecodeRune(data[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// detectYAMLIndent returns the smallest indentation used by the file
+func detectYAMLIndent(data []byte) int {
+	indent := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		n := len(line) - len(trimmed)
+		if n == 0 || trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if indent == 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent < 2 || indent > 9 {
+		return 2
+	}
+	return indent
+}
+
+// bytes returns the updated file contents
+func (d *yamlDocument) bytes() ([]byte, error) {
+	if d.format != formatYAML {
+		if len(d.docs) > 1 {
+			return nil, fmt.Errorf("%s files hold a single document", d.format)
+		}
+		return encodeFormat(d.root(), d.format, d.indent, d.data)
+	}
+
+	if !d.reencode {
+		out := append([]byte(nil), d.data...)
+		// apply from the end so earlier offsets stay valid
+		sort.SliceStable(d.splices, func(i, j int) bool { return d.splices[i].offset < d.splices[j].offset })
+		for i := len(d.splices) - 1; i >= 0; i-- {
+			s := d.splices[i]
+			out = append(out[:s.offset], append([]byte(s.text), out[s.offset+s.length:]...)...)
+		}
+		return out, nil
+	}
+
+	var buf bytes.Buffer
+	if bytes.HasPrefix(bytes.TrimLeft(d.data, "\n"), []byte("---")) {
+		buf.WriteString("---\n")
+	}
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(d.indent)
+	for _, doc := range d.docs {
+		clearMergeTags(doc)
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// clearMergeTags drops the explicit !!merge tag the decoder puts on "<<"
+// keys, which the encoder would otherwise write out literally
+func clearMergeTags(node *yaml.Node) {
+	if node.Tag == "!!merge" {
+		node.Tag = ""
+	}
+	for _, child := range node.Content {
+		clearMergeTags(child)
+	}
+}
+
+// save atomically writes the document to its file, creating parent
+// directories, under the file's lock (taking it unless already held)
+func (d *yamlDocument) save() error {
+	out, err := d.bytes()
+	if err != nil {
+		return err
+	}
+
+	if !d.lock.holds(d.path) {
+		lock, err := lockFile(d.path)
+		if err != nil {
+			return err
+		}
+		defer lock.unlock()
+	}
+	return writeFileAtomic(d.path, out, backupWrites)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// orderedMap is a JSON object that keeps the key order of its YAML mapping
+type orderedMap []orderedEntry
+
+type orderedEntry struct {
+	Key   string
+	Value interface{}
+}
+
+// MarshalJSON writes the entries in order
+func (m orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, entry := range m {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(entry.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// nodeToJSONValue converts a node into a value encoding/json can marshal,
+// keeping mapping order and expanding aliases and "<<" merge keys
+func nodeToJSONValue(node *yaml.Node) (interface{}, error) {
+	node = resolveAlias(node)
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return nodeToJSONValue(node.Content[0])
+
+	case yaml.MappingNode:
+		var m orderedMap
+		index := make(map[string]int)
+		put := func(key string, value interface{}, override bool) {
+			if i, ok := index[key]; ok {
+				if override {
+					m[i].Value = value
+				}
+				return
+			}
+			index[key] = len(m)
+			m = append(m, orderedEntry{key, value})
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == "<<" && key.ShortTag() == "!!merge" {
+				merged, err := nodeToJSONValue(value)
+				if err != nil {
+					return nil, err
+				}
+				sources := []interface{}{merged}
+				if list, ok := merged.([]interface{}); ok {
+					sources = list
+				}
+				for _, source := range sources {
+					if sm, ok := source.(orderedMap); ok {
+						for _, entry := range sm {
+							put(entry.Key, entry.Value, false)
+						}
+					}
+				}
+				continue
+			}
+			v, err := nodeToJSONValue(value)
+			if err != nil {
+				return nil, err
+			}
+			put(key.Value, v, true)
+		}
+		if m == nil {
+			m = orderedMap{}
+		}
+		return m, nil
+
+	case yaml.SequenceNode:
+		list := make([]interface{}, 0, len(node.Content))
+		for _, item := range node.Content {
+			v, err := nodeToJSONValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+
+	case yaml.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			return nil, nil
+		case "!!bool":
+			var b bool
+			if err := node.Decode(&b); err != nil {
+				return nil, err
+			}
+			return b, nil
+		case "!!int":
+			var i int64
+			if err := node.Decode(&i); err != nil {
+				// out of int64 range: keep the digits
+				return json.Number(node.Value), nil
+			}
+			return i, nil
+		case "!!float":
+			var f float64
+			if err := node.Decode(&f); err != nil {
+				return nil, err
+			}
+			if math.IsInf(f, 0) || math.IsNaN(f) {
+				return nil, fmt.Errorf("line %d: %s has no JSON representation", node.Line, node.Value)
+			}
+			return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+		default:
+			return node.Value, nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported YAML node at line %d", node.Line)
+}
+
+// nodeToJSON renders a node as JSON, indented when pretty is set
+func nodeToJSON(node *yaml.Node, pretty bool) ([]byte, error) {
+	value, err := nodeToJSONValue(node)
+	if err != nil {
+		return nil, err
+	}
+	if pretty {
+		return json.MarshalIndent(value, "", "  ")
+	}
+	return json.Marshal(value)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// errKeyNotFound reports a key path that matches nothing
+var errKeyNotFound = errors.New("key not found")
+
+// delete removes the node at a key path. Block map entries and list items
+// are cut out of the original bytes together with their head comment;
+// anything else re-encodes the document.
+func (d *yamlDocument) delete(segs []pathSegment) error {
+	segs = d.keyPath(segs)
+	if len(segs) == 0 {
+		return fmt.Errorf("cannot delete the document root")
+	}
+	if hasWildcard(segs) {
+		return fmt.Errorf("wildcards cannot be used to delete values")
+	}
+
+	parent := resolveAlias(findOwnNode(d.root(), segs[:len(segs)-1]))
+	if parent == nil {
+		return errKeyNotFound
+	}
+
+	var first, value *yaml.Node
+	var from, to int
+	switch seg := segs[len(segs)-1]; {
+	case seg.kind == segmentKey && parent.Kind == yaml.MappingNode:
+		idx := mappingIndex(parent, seg.key)
+		if idx < 0 {
+			return errKeyNotFound
+		}
+		first, value, from, to = parent.Content[idx], parent.Content[idx+1], idx, idx+2
+	case seg.kind == segmentIndex && parent.Kind == yaml.SequenceNode:
+		idx, ok := sequenceIndex(parent, seg.index)
+		if !ok {
+			return errKeyNotFound
+		}
+		first, value, from, to = parent.Content[idx], parent.Content[idx], idx, idx+1
+	default:
+		return errKeyNotFound
+	}
+
+	// an emptied collection must become {} or [], which only re-encoding does
+	if d.reencode || len(parent.Content) == to-from || !d.cutLines(parent, first, value) {
+		d.reencode = true
+	}
+	parent.Content = append(parent.Content[:from], parent.Content[to:]...)
+	return nil
+}
+
+// cutLines records a splice removing the lines from first (plus its head
+// comment) through the end of value, when they hold nothing else
+func (d *yamlDocument) cutLines(parent, first, value *yaml.Node) bool {
+	if parent.Style&yaml.FlowStyle != 0 || first.Line == 0 {
+		return false
+	}
+	last := lastLine(value)
+	if last <= 0 {
+		return false
+	}
+
+	start := lineColumnOffset(d.data, first.Line, 1)
+	column := lineColumnOffset(d.data, first.Line, first.Column)
+	if start < 0 || column < 0 {
+		return false
+	}
+	// only indentation (and the "-" of a list item) may precede the entry
+	lead := strings.TrimSpace(string(d.data[start:column]))
+	if lead != "" && !(parent.Kind == yaml.SequenceNode && lead == "-") {
+		return false
+	}
+
+	if first.HeadComment != "" {
+		lines := strings.Count(first.HeadComment, "\n") + 1
+		if above := lineColumnOffset(d.data, first.Line-lines, 1); first.Line > lines && above >= 0 {
+			block := strings.Split(strings.TrimSuffix(string(d.data[above:start]), "\n"), "\n")
+			comments := true
+			for _, line := range block {
+				comments = comments && strings.HasPrefix(strings.TrimSpace(line), "#")
+			}
+			if comments {
+				start = above
+			}
+		}
+	}
+
+	end := lineColumnOffset(d.data, last+1, 1)
+	if end < 0 {
+		end = len(d.data)
+	}
+	return d.addSplice(yamlSplice{offset: start, length: end - start})
+}
+
+// List merge strategies for yaml-merge
+const (
+	listReplace    = "replace"
+	listAppend     = "append"
+	listMergeByKey = "merge-by-key"
+)
+
+// yamlMergeOptions controls how overlay lists are combined with base lists
+type yamlMergeOptions struct {
+	lists   string // listReplace, listAppend or listMergeByKey
+	listKey string // item field matched by listMergeByKey
+}
+
+// merge overlays a node onto the document at segs. Maps merge key by key,
+// lists follow opts.lists and everything else is replaced. Every change
+// goes through set, so untouched parts of the file keep their formatting.
+func (d *yamlDocument) merge(segs []pathSegment, overlay *yaml.Node, opts yamlMergeOptions) error {
+	overlay = resolveAlias(overlay)
+	if len(segs) == 0 {
+		if overlay.Kind != yaml.MappingNode {
+			return fmt.Errorf("overlay top level must be a mapping")
+		}
+		if _, err := d.ensureRoot(); err != nil {
+			return err
+		}
+	}
+	base := resolveAlias(findOwnNode(d.root(), segs))
+
+	switch {
+	case base != nil && base.Kind == yaml.MappingNode && overlay.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(overlay.Content); i += 2 {
+			child := appendSegment(segs, pathSegment{kind: segmentKey, key: overlay.Content[i].Value})
+			if err := d.merge(child, overlay.Content[i+1], opts); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case base != nil && base.Kind == yaml.SequenceNode && overlay.Kind == yaml.SequenceNode && opts.lists != listReplace:
+		for _, item := range overlay.Content {
+			if opts.lists == listMergeByKey {
+				if idx := matchingListItem(base, resolveAlias(item), opts.listKey); idx >= 0 {
+					if err := d.merge(appendSegment(segs, pathSegment{kind: segmentIndex, index: idx}), item, opts); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			if err := d.set(appendSegment(segs, pathSegment{kind: segmentAppend}), cloneNode(item)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return d.set(segs, cloneNode(overlay))
+	}
+}
+
+// matchingListItem returns the index of the base list item whose key field
+// equals the overlay item's, or -1
+func matchingListItem(base, item *yaml.Node, key string) int {
+	want := resolveAlias(mappingValue(item, key))
+	if want == nil || want.Kind != yaml.ScalarNode {
+		return -1
+	}
+	for i, candidate := range base.Content {
+		if got := resolveAlias(mappingValue(resolveAlias(candidate), key)); got != nil && got.Kind == yaml.ScalarNode && got.Value == want.Value {
+			return i
+		}
+	}
+	return -1
+}
+
+// appendSegment returns a new path with seg added
+func appendSegment(segs []pathSegment, seg pathSegment) []pathSegment {
+	return append(append([]pathSegment(nil), segs...), seg)
+}
+
+// cloneNode deep-copies a node from another document: positions are
+// cleared and aliases replaced by copies of their target, since the
+// anchors do not exist in the destination
+func cloneNode(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		copied := cloneNode(resolveAlias(node))
+		copied.Anchor = ""
+		return copied
+	}
+	copied := *node
+	copied.Line, copied.Column = 0, 0
+	copied.Content = nil
+	for _, child := range node.Content {
+		copied.Content = append(copied.Content, cloneNode(child))
+	}
+	return &copied
+}
+
+// yamlChange is one difference reported by yaml-diff
+type yamlChange struct {
+	Op   string // added, removed or changed
+	Path string
+	Old  *yaml.Node
+	New  *yaml.Node
+}
+
+// diffNodes appends the differences between a and b under path. Maps are
+// compared key by key and lists item by item; anything else by value.
+func diffNodes(path string, a, b *yaml.Node, changes []yamlChange) []yamlChange {
+	a, b = resolveAlias(a), resolveAlias(b)
+
+	switch {
+	case a.Kind == yaml.MappingNode && b.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(a.Content); i += 2 {
+			key := a.Content[i].Value
+			child := joinKeyPath(path, key)
+			if other := mappingValue(b, key); other != nil {
+				changes = diffNodes(child, a.Content[i+1], other, changes)
+			} else {
+				changes = append(changes, yamlChange{Op: "removed", Path: child, Old: a.Content[i+1]})
+			}
+		}
+		for i := 0; i+1 < len(b.Content); i += 2 {
+			if key := b.Content[i].Value; mappingValue(a, key) == nil {
+				changes = append(changes, yamlChange{Op: "added", Path: joinKeyPath(path, key), New: b.Content[i+1]})
+			}
+		}
+
+	case a.Kind == yaml.SequenceNode && b.Kind == yaml.SequenceNode:
+		for i := 0; i < len(a.Content) || i < len(b.Content); i++ {
+			child := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(b.Content):
+				changes = append(changes, yamlChange{Op: "removed", Path: child, Old: a.Content[i]})
+			case i >= len(a.Content):
+				changes = append(changes, yamlChange{Op: "added", Path: child, New: b.Content[i]})
+			default:
+				changes = diffNodes(child, a.Content[i], b.Content[i], changes)
+			}
+		}
+
+	case a.Kind == yaml.ScalarNode && b.Kind == yaml.ScalarNode:
+		if a.ShortTag() != b.ShortTag() || a.Value != b.Value {
+			changes = append(changes, yamlChange{Op: "changed", Path: path, Old: a, New: b})
+		}
+
+	default:
+		changes = append(changes, yamlChange{Op: "changed", Path: path, Old: a, New: b})
+	}
+	return changes
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlValueTypes are the accepted values of yaml-set --type
+var yamlValueTypes = []string{"string", "int", "float", "bool", "null", "json", "yaml"}
+
+// yamlValueNode converts a command-line value into a node of the given type.
+// With no type the existing node's scalar type is kept when the value fits
+// it; new keys (and values that don't fit) resolve like plain YAML scalars,
+// so "8" becomes an int and "true" a bool.
+func yamlValueNode(value, valueType string, existing *yaml.Node) (*yaml.Node, error) {
+	if valueType == "" {
+		existing = resolveAlias(existing)
+		if existing != nil && existing.Kind == yaml.ScalarNode {
+			switch tag := existing.ShortTag(); tag {
+			case "!!str":
+				return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}, nil
+			case "!!int", "!!float", "!!bool":
+				if node, err := yamlValueNode(value, strings.TrimPrefix(tag, "!!"), nil); err == nil {
+					return node, nil
+				}
+			}
+		}
+		return scalarNode(value), nil
+	}
+
+	switch valueType {
+	case "string":
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}, nil
+
+	case "int":
+		text := strings.ReplaceAll(value, "_", "")
+		if _, err := strconv.ParseInt(text, 0, 64); err != nil {
+			return nil, fmt.Errorf("not an int: %q", value)
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: text}, nil
+
+	case "float":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("not a float: %q", value)
+		}
+		text := strconv.FormatFloat(f, 'g', -1, 64)
+		switch {
+		case math.IsInf(f, 1):
+			text = ".inf"
+		case math.IsInf(f, -1):
+			text = "-.inf"
+		case math.IsNaN(f):
+			text = ".nan"
+		case !strings.ContainsAny(text, ".e"):
+			text += ".0"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: text}, nil
+
+	case "bool":
+		b, err := parseYAMLBool(value)
+		if err != nil {
+			return nil, err
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(b)}, nil
+
+	case "null":
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+
+	case "json":
+		if !json.Valid([]byte(value)) {
+			return nil, fmt.Errorf("invalid JSON value")
+		}
+		node, err := parseYAMLValue(value)
+		if err != nil {
+			return nil, err
+		}
+		clearStyles(node)
+		return node, nil
+
+	case "yaml":
+		return parseYAMLValue(value)
+
+	default:
+		return nil, fmt.Errorf("unknown type: %s (use %s)", valueType, strings.Join(yamlValueTypes, ", "))
+	}
+}
+
+// parseYAMLBool accepts true/false plus the YAML 1.1 spellings
+func parseYAMLBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "y", "1":
+		return true, nil
+	case "false", "no", "off", "n", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("not a bool: %q", value)
+}
+
+// parseYAMLValue parses a YAML (or JSON) snippet into a single node
+func parseYAMLValue(value string) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &doc); err != nil {
+		return nil, fmt.Errorf("invalid YAML value: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+	node := doc.Content[0]
+	clearPositions(node)
+	return node, nil
+}
+
+// clearStyles drops flow and quoting styles so JSON input is written in
+// the block style of the surrounding file
+func clearStyles(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearStyles(child)
+	}
+}
+
+// clearPositions resets line/column info of a parsed snippet so it is not
+// mistaken for part of the file being edited
+func clearPositions(node *yaml.Node) {
+	node.Line, node.Column = 0, 0
+	for _, child := range node.Content {
+		clearPositions(child)
+	}
+}
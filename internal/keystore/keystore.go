@@ -0,0 +1,495 @@
+// Package keystore implements the encrypted credential store behind
+// "dcx cred": a text file with a header and one sealed entry per line.
+//
+// Version 2 file format:
+//
+//	VERSION:2
+//	CREATED:2025-01-01T00:00:00Z
+//	KDF:pbkdf2-sha256
+//	ITERATIONS:600000
+//	SALT:<hex>
+//	VERIFIER:<base64 HMAC-SHA256 of a fixed message under the key>
+//	RECOVERY_HASH:<base64 SHA-256 of the recovery key>
+//	RECOVERY_PUBLIC:<base64 X25519 public key of the recovery key>
+//	RECOVERY_WRAP:<base64 of the key sealed to RECOVERY_PUBLIC>
+//	RECOVERY_SHOWN:1
+//	---
+//	service/env/name:<base64 of nonce || AES-256-GCM ciphertext>
+//
+// The key is derived from the master password with PBKDF2-SHA256 and each
+// entry is sealed with its name as additional data, so a value cannot be
+// moved to another name. The verifier lets Unlock reject a wrong password
+// before anything is decrypted, and the recovery key can unlock the store
+// in its place (see recovery.go). Version 1.0 files, written by the old cred.sh,
+// are read too; unlocking one upgrades it in memory and the next Save
+// writes it as version 2.
+package keystore
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Version is the format Save writes
+	Version = "2"
+	// LegacyVersion is the format of the bash/openssl store
+	LegacyVersion = "1.0"
+
+	// DefaultIterations is the PBKDF2 work factor of new stores
+	DefaultIterations = 600000
+
+	kdfName         = "pbkdf2-sha256"
+	saltSize        = 16
+	keySize         = 32
+	verifierMessage = "dcx credential store verifier"
+)
+
+var (
+	// ErrNotFound is returned for a key that is not in the store
+	ErrNotFound = errors.New("credential not found")
+	// ErrLocked is returned when a value is read or written before Unlock
+	ErrLocked = errors.New("credential store is locked")
+	// ErrBadPassword is returned when the master password is wrong
+	ErrBadPassword = errors.New("wrong master password")
+)
+
+// keyPattern is the service/environment/name form of credential keys
+var keyPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+/[a-zA-Z0-9_-]+/[a-zA-Z0-9_-]+$`)
+
+// ValidKey reports whether name has the service/environment/name form
+func ValidKey(name string) bool {
+	return keyPattern.MatchString(name)
+}
+
+// field is a NAME:value header line
+type field struct {
+	name, value string
+}
+
+// entry is a credential as stored: its name and sealed value
+type entry struct {
+	name, sealed string
+}
+
+// Store is a credential file loaded in memory. Names and the header are
+// readable as loaded; values need Unlock.
+type Store struct {
+	path    string
+	version string // as loaded
+	header  []field
+	entries []entry
+	key     []byte
+}
+
+// Load reads the store at path. A missing file yields an error that
+// satisfies errors.Is(err, fs.ErrNotExist).
+func Load(path string) (*Store, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{path: path}
+	inHeader := true
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case inHeader && line == "---":
+			inHeader = false
+		case inHeader:
+			name, value, _ := strings.Cut(line, ":")
+			s.header = append(s.header, field{name, value})
+		case line == "":
+		case !strings.Contains(line, ":") && len(s.entries) > 0:
+			// version 1.0 wrapped long base64 values over several lines
+			s.entries[len(s.entries)-1].sealed += "\n" + line
+		default:
+			name, sealed, _ := strings.Cut(line, ":")
+			s.entries = append(s.entries, entry{name, sealed})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	s.version = s.Header("VERSION")
+	if s.version != Version && s.version != LegacyVersion {
+		return nil, fmt.Errorf("%s: unsupported credential store version %q", path, s.version)
+	}
+	if _, err := s.salt(); err != nil {
+		return nil, fmt.Errorf("corrupted credentials file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Create returns a new, unlocked store for path (written by Save) and its
+// recovery key, which is shown to the user once and only kept as a hash
+func Create(path, password string) (*Store, string, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, "", err
+	}
+
+	s := &Store{path: path, version: Version}
+	s.SetHeader("VERSION", Version)
+	s.SetHeader("CREATED", time.Now().UTC().Format(time.RFC3339))
+	s.SetHeader("KDF", kdfName)
+	s.SetHeader("ITERATIONS", strconv.Itoa(DefaultIterations))
+	s.SetHeader("SALT", hex.EncodeToString(salt))
+
+	key, err := deriveKey(password, salt, DefaultIterations)
+	if err != nil {
+		return nil, "", err
+	}
+	s.key = key
+	s.SetHeader("VERIFIER", verifier(key))
+	recoveryKey, err := s.ResetRecoveryKey()
+	if err != nil {
+		return nil, "", err
+	}
+	return s, recoveryKey, nil
+}
+
+// RecoveryHash is the stored form of a recovery key
+func RecoveryHash(recoveryKey string) string {
+	sum := sha256.Sum256([]byte(recoveryKey))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Path returns the file the store was loaded from
+func (s *Store) Path() string {
+	return s.path
+}
+
+// LoadedVersion returns the format version of the file as it was read
+func (s *Store) LoadedVersion() string {
+	return s.version
+}
+
+// Header returns a header field ("" when absent)
+func (s *Store) Header(name string) string {
+	for _, f := range s.header {
+		if f.name == name {
+			return f.value
+		}
+	}
+	return ""
+}
+
+// SetHeader sets a header field, keeping the position of an existing one
+func (s *Store) SetHeader(name, value string) {
+	for i := range s.header {
+		if s.header[i].name == name {
+			s.header[i].value = value
+			return
+		}
+	}
+	s.header = append(s.header, field{name, value})
+}
+
+// Unlocked reports whether values can be read and written
+func (s *Store) Unlocked() bool {
+	return s.key != nil
+}
+
+// Unlock derives the key from the master password and checks it against
+// the verifier; ErrBadPassword means the password is wrong. A store
+// without a verifier is checked by decrypting its first value and gets
+// one on the next Save. A version 1.0 store, which has nothing to check
+// against, is upgraded in memory: its values are re-sealed under a key
+// from password and a new salt.
+func (s *Store) Unlock(password string) error {
+	if s.Header("VERSION") == LegacyVersion {
+		return s.upgrade(password)
+	}
+	salt, err := s.salt()
+	if err != nil {
+		return err
+	}
+	key, err := deriveKey(password, salt, s.iterations())
+	if err != nil {
+		return err
+	}
+
+	if stored := s.Header("VERIFIER"); stored != "" {
+		if !hmac.Equal([]byte(stored), []byte(verifier(key))) {
+			return ErrBadPassword
+		}
+	} else {
+		if len(s.entries) > 0 {
+			if _, err := openWith(key, s.entries[0].name, s.entries[0].sealed); err != nil {
+				return ErrBadPassword
+			}
+		}
+		s.SetHeader("VERIFIER", verifier(key))
+	}
+	s.key = key
+	return nil
+}
+
+// Key returns a copy of the key of an unlocked store, for the credential
+// agent to hand to UnlockKey
+func (s *Store) Key() []byte {
+	return bytes.Clone(s.key)
+}
+
+// UnlockKey unlocks the store with a key from Key, checked against the
+// verifier; ErrBadPassword means the password has changed since
+func (s *Store) UnlockKey(key []byte) error {
+	stored := s.Header("VERIFIER")
+	if s.Header("VERSION") != Version || stored == "" {
+		return errors.New("credential store has no verifier to check the key against")
+	}
+	if !hmac.Equal([]byte(stored), []byte(verifier(key))) {
+		return ErrBadPassword
+	}
+	s.key = bytes.Clone(key)
+	return nil
+}
+
+// Lock wipes the key from memory
+func (s *Store) Lock() {
+	clear(s.key)
+	s.key = nil
+}
+
+// Keys returns the credential names, sorted
+func (s *Store) Keys() []string {
+	keys := make([]string, 0, len(s.entries))
+	for _, e := range s.entries {
+		keys = append(keys, e.name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Has reports whether name is in the store
+func (s *Store) Has(name string) bool {
+	return s.find(name) >= 0
+}
+
+// Value decrypts the credential name
+func (s *Store) Value(name string) (string, error) {
+	i := s.find(name)
+	if i < 0 {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if !s.Unlocked() {
+		return "", ErrLocked
+	}
+	plain, err := s.open(name, s.entries[i].sealed)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt %s: value is corrupted or was tampered with", name)
+	}
+	return string(plain), nil
+}
+
+// SetValue encrypts value as the credential name, replacing any old one
+func (s *Store) SetValue(name, value string) error {
+	if !ValidKey(name) {
+		return fmt.Errorf("invalid key format: %s (use service/environment/name)", name)
+	}
+	if !s.Unlocked() {
+		return ErrLocked
+	}
+	sealed, err := s.seal(name, []byte(value))
+	if err != nil {
+		return err
+	}
+	if i := s.find(name); i >= 0 {
+		s.entries[i].sealed = sealed
+	} else {
+		s.entries = append(s.entries, entry{name, sealed})
+	}
+	return nil
+}
+
+// Delete removes the credential name; it needs no key
+func (s *Store) Delete(name string) error {
+	i := s.find(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	s.entries = append(s.entries[:i], s.entries[i+1:]...)
+	return nil
+}
+
+// Save writes the store to its path with mode 0600, atomically: a crash
+// leaves either the old or the new file
+func (s *Store) Save() error {
+	var buf bytes.Buffer
+	for _, f := range s.header {
+		fmt.Fprintf(&buf, "%s:%s\n", f.name, f.value)
+	}
+	buf.WriteString("---\n")
+	for _, e := range s.entries {
+		fmt.Fprintf(&buf, "%s:%s\n", e.name, e.sealed)
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	s.version = s.Header("VERSION")
+	return nil
+}
+
+func (s *Store) find(name string) int {
+	for i, e := range s.entries {
+		if e.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Store) salt() ([]byte, error) {
+	value := s.Header("SALT")
+	if value == "" {
+		return nil, errors.New("missing salt")
+	}
+	salt, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %v", err)
+	}
+	return salt, nil
+}
+
+func (s *Store) iterations() int {
+	if n, err := strconv.Atoi(s.Header("ITERATIONS")); err == nil && n > 0 {
+		return n
+	}
+	return DefaultIterations
+}
+
+// upgrade turns a loaded version 1.0 store into an unlocked version 2 one
+func (s *Store) upgrade(password string) error {
+	values := make([][]byte, len(s.entries))
+	for i, e := range s.entries {
+		plain, err := openLegacy(e.sealed)
+		if err != nil {
+			return fmt.Errorf("cannot decrypt %s: %v", e.name, err)
+		}
+		values[i] = plain
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	key, err := deriveKey(password, salt, DefaultIterations)
+	if err != nil {
+		return err
+	}
+
+	s.key = key
+	s.SetHeader("VERSION", Version)
+	s.SetHeader("KDF", kdfName)
+	s.SetHeader("ITERATIONS", strconv.Itoa(DefaultIterations))
+	s.SetHeader("SALT", hex.EncodeToString(salt))
+	s.SetHeader("VERIFIER", verifier(key))
+	for i := range s.entries {
+		if s.entries[i].sealed, err = s.seal(s.entries[i].name, values[i]); err != nil {
+			return err
+		}
+		clear(values[i])
+	}
+	return nil
+}
+
+func deriveKey(password string, salt []byte, iterations int) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, password, salt, iterations, keySize)
+}
+
+// verifier is the VERIFIER header for key
+func verifier(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(verifierMessage))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func aead(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *Store) seal(name string, plain []byte) (string, error) {
+	return sealWith(s.key, name, plain)
+}
+
+func sealWith(key []byte, name string, plain []byte) (string, error) {
+	gcm, err := aead(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, []byte(name))), nil
+}
+
+func (s *Store) open(name, sealed string) ([]byte, error) {
+	return openWith(s.key, name, sealed)
+}
+
+func openWith(key []byte, name, sealed string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := aead(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("sealed value too short")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(name))
+}
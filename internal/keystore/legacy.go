@@ -0,0 +1,60 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// Version 1.0 values are the output of
+//
+//	openssl enc -aes-256-cbc -pbkdf2 -iter 100000 -salt -base64 -pass pass:$KEY
+//
+// where $KEY was meant to be derived from the master password. The
+// derivation ran "openssl enc -P" without a cipher, which prints nothing,
+// so every version 1.0 value was encrypted under an empty passphrase and
+// the master password never protected anything. They are decrypted the
+// same way here, and upgrading re-encrypts them under the password.
+
+const (
+	legacyPassphrase = ""
+	legacyIterations = 100000
+	legacyMagic      = "Salted__"
+)
+
+// openLegacy decrypts an openssl "Salted__" AES-256-CBC value
+func openLegacy(sealed string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(sealed, "\n", ""))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 16 || string(data[:8]) != legacyMagic {
+		return nil, errors.New("not an openssl salted value")
+	}
+	salt, body := data[8:16], data[16:]
+	if len(body) == 0 || len(body)%aes.BlockSize != 0 {
+		return nil, errors.New("truncated value")
+	}
+
+	keyIV, err := pbkdf2.Key(sha256.New, legacyPassphrase, salt, legacyIterations, 32+aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(keyIV[:32])
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(body))
+	cipher.NewCBCDecrypter(block, keyIV[32:]).CryptBlocks(plain, body)
+
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(plain[len(plain)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, errors.New("bad padding")
+	}
+	return plain[:len(plain)-pad], nil
+}
@@ -0,0 +1,199 @@
+package keystore
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The recovery key is an X25519 private key. The store keeps its public
+// key (RECOVERY_PUBLIC) and the store key sealed to it (RECOVERY_WRAP: an
+// ephemeral public key, a nonce and the AES-256-GCM ciphertext), so Rekey
+// can re-seal a new store key for the recovery key without knowing it and
+// Recover can unlock the store with the recovery key alone. Stores created
+// before this have only RECOVERY_HASH; their recovery key cannot unlock
+// them, and changing the password issues one that can.
+
+const recoveryAAD = "dcx credential store recovery"
+
+var (
+	// ErrBadRecoveryKey is returned when the recovery key is wrong
+	ErrBadRecoveryKey = errors.New("wrong recovery key")
+	// ErrNoRecovery is returned by Recover for a store whose recovery key
+	// cannot unlock it
+	ErrNoRecovery = errors.New("the recovery key of this store cannot unlock it (it predates recovery support)")
+)
+
+// Recoverable reports whether Recover can unlock the store
+func (s *Store) Recoverable() bool {
+	return s.Header("VERSION") == LegacyVersion || s.Header("RECOVERY_WRAP") != ""
+}
+
+// ResetRecoveryKey gives an unlocked store a new recovery key and returns
+// it; the old one stops working
+func (s *Store) ResetRecoveryKey() (string, error) {
+	if !s.Unlocked() {
+		return "", ErrLocked
+	}
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	recoveryKey := base64.StdEncoding.EncodeToString(priv.Bytes())
+
+	s.SetHeader("RECOVERY_HASH", RecoveryHash(recoveryKey))
+	s.SetHeader("RECOVERY_PUBLIC", base64.StdEncoding.EncodeToString(priv.PublicKey().Bytes()))
+	if err := s.wrapRecovery(); err != nil {
+		return "", err
+	}
+	s.SetHeader("RECOVERY_SHOWN", "1")
+	return recoveryKey, nil
+}
+
+// Recover unlocks the store with its recovery key instead of the master
+// password; Rekey then sets a new password
+func (s *Store) Recover(recoveryKey string) error {
+	recoveryKey = strings.TrimSpace(recoveryKey)
+	if subtle.ConstantTimeCompare([]byte(RecoveryHash(recoveryKey)), []byte(s.Header("RECOVERY_HASH"))) != 1 {
+		return ErrBadRecoveryKey
+	}
+	if s.Header("VERSION") == LegacyVersion {
+		// version 1.0 values need no key to read
+		return s.upgrade(recoveryKey)
+	}
+	wrap := s.Header("RECOVERY_WRAP")
+	if wrap == "" {
+		return ErrNoRecovery
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(recoveryKey)
+	if err != nil {
+		return ErrBadRecoveryKey
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(secret)
+	if err != nil {
+		return ErrBadRecoveryKey
+	}
+	data, err := base64.StdEncoding.DecodeString(wrap)
+	if err != nil || len(data) < 32 {
+		return errors.New("corrupted recovery data")
+	}
+	eph, err := ecdh.X25519().NewPublicKey(data[:32])
+	if err != nil {
+		return fmt.Errorf("corrupted recovery data: %v", err)
+	}
+	shared, err := priv.ECDH(eph)
+	if err != nil {
+		return fmt.Errorf("corrupted recovery data: %v", err)
+	}
+	gcm, err := aead(recoveryKEK(shared, data[:32], priv.PublicKey().Bytes()))
+	if err != nil {
+		return err
+	}
+	body := data[32:]
+	if len(body) < gcm.NonceSize() {
+		return errors.New("corrupted recovery data")
+	}
+	key, err := gcm.Open(nil, body[:gcm.NonceSize()], body[gcm.NonceSize():], []byte(recoveryAAD))
+	if err != nil {
+		return errors.New("corrupted recovery data")
+	}
+	if stored := s.Header("VERIFIER"); stored != "" && stored != verifier(key) {
+		return errors.New("recovery data does not match the store")
+	}
+	s.key = key
+	return nil
+}
+
+// Rekey re-seals every value under a key derived from password and a new
+// salt, for Save to write in one go. The store must be unlocked; its
+// recovery key, if Recoverable, stays valid.
+func (s *Store) Rekey(password string) error {
+	if !s.Unlocked() {
+		return ErrLocked
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	key, err := deriveKey(password, salt, DefaultIterations)
+	if err != nil {
+		return err
+	}
+
+	// re-seal into a copy so a bad value leaves the store as it was
+	sealed := make([]string, len(s.entries))
+	for i, e := range s.entries {
+		plain, err := s.open(e.name, e.sealed)
+		if err != nil {
+			return fmt.Errorf("cannot decrypt %s: value is corrupted or was tampered with", e.name)
+		}
+		sealed[i], err = sealWith(key, e.name, plain)
+		clear(plain)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := range s.entries {
+		s.entries[i].sealed = sealed[i]
+	}
+	s.Lock()
+	s.key = key
+	s.SetHeader("KDF", kdfName)
+	s.SetHeader("ITERATIONS", strconv.Itoa(DefaultIterations))
+	s.SetHeader("SALT", hex.EncodeToString(salt))
+	s.SetHeader("VERIFIER", verifier(key))
+	if s.Header("RECOVERY_PUBLIC") != "" {
+		return s.wrapRecovery()
+	}
+	return nil
+}
+
+// wrapRecovery seals the store key to RECOVERY_PUBLIC as RECOVERY_WRAP
+func (s *Store) wrapRecovery() error {
+	public, err := base64.StdEncoding.DecodeString(s.Header("RECOVERY_PUBLIC"))
+	if err != nil {
+		return fmt.Errorf("invalid recovery public key: %v", err)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(public)
+	if err != nil {
+		return fmt.Errorf("invalid recovery public key: %v", err)
+	}
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	shared, err := eph.ECDH(pub)
+	if err != nil {
+		return err
+	}
+	gcm, err := aead(recoveryKEK(shared, eph.PublicKey().Bytes(), public))
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	out := append(eph.PublicKey().Bytes(), nonce...)
+	out = gcm.Seal(out, nonce, s.key, []byte(recoveryAAD))
+	s.SetHeader("RECOVERY_WRAP", base64.StdEncoding.EncodeToString(out))
+	return nil
+}
+
+// recoveryKEK is the key that seals RECOVERY_WRAP
+func recoveryKEK(shared, ephemeral, public []byte) []byte {
+	h := sha256.New()
+	h.Write(shared)
+	h.Write(ephemeral)
+	h.Write(public)
+	return h.Sum(nil)
+}
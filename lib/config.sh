@@ -16,29 +16,38 @@ declare -r _DCX_CONFIG_LOADED=1
 # Usage: config_get config.yaml "database.host" "localhost"
 # Arguments:
 #   $1 - Config file path
-#   $2 - Key path (dot notation, e.g., "database.host")
+#   $2 - Key path (e.g. "database.host", "dirs[0]", "urls.\"linux-amd64\"")
 #   $3 - Default value (optional)
+#   --json / --raw0 / --format F / --no-interpolate / --strict /
+#   --resolve-secrets
+#   may follow (see: dcx config help)
+# Returns 1 if the key is missing and no default was given. Maps and lists
+# print as YAML; a null value prints an empty line.
 #-------------------------------------------------------------------------------
 config_get() {
     local file="$1"
     local key="$2"
-    local default="${3:-}"
+    shift 2
 
-    "$DCX_GO" config yaml-get "$file" "$key" "$default"
+    "$DCX_GO" config yaml-get "$file" "$key" "$@"
 }
 
 #-------------------------------------------------------------------------------
 # config_set - Set a value in config file
 #-------------------------------------------------------------------------------
 # Usage: config_set config.yaml "database.host" "newhost"
-# Creates the file if it doesn't exist.
+#        config_set config.yaml "plugins.dirs" '["a","b"]' --type json
+# Creates the file if it doesn't exist. Extra options (--type, --value-file)
+# are passed to yaml-set; without --type the existing value's type is kept.
+# The write is atomic and locked, so parallel config_set calls are safe;
+# --backup keeps the old file as <file>.bak.N (see dcx config undo).
 #-------------------------------------------------------------------------------
 config_set() {
     local file="$1"
     local key="$2"
     local value="$3"
 
-    "$DCX_GO" config yaml-set "$file" "$key" "$value"
+    "$DCX_GO" config yaml-set "$file" "$key" "$value" "${@:4}"
 }
 
 #-------------------------------------------------------------------------------
@@ -68,54 +77,39 @@ config_keys() {
 }
 
 #-------------------------------------------------------------------------------
-# dc_config_cmd - CLI command handler for 'dcx config'
+# config_delete - Remove a key or list item from config file
 #-------------------------------------------------------------------------------
-dc_config_cmd() {
-    local subcmd="${1:-help}"
-    shift 2>/dev/null || true
+# Usage: config_delete config.yaml "database.port"
+# Returns 1 if the key does not exist.
+#-------------------------------------------------------------------------------
+config_delete() {
+    local file="$1"
+    local key="$2"
 
-    local config_file="${XDG_CONFIG_HOME:-$HOME/.config}/dcx/config.yaml"
+    "$DCX_GO" config yaml-delete "$file" "$key"
+}
 
-    case "$subcmd" in
-        get)
-            local key="${1:-}"
-            local default="${2:-}"
-            [[ -z "$key" ]] && { echo "Usage: dcx config get <key> [default]"; return 1; }
-            config_get "$config_file" "$key" "$default"
-            ;;
-        set)
-            local key="${1:-}"
-            local value="${2:-}"
-            [[ -z "$key" || -z "$value" ]] && { echo "Usage: dcx config set <key> <value>"; return 1; }
-            config_set "$config_file" "$key" "$value"
-            echo "Set $key = $value"
-            ;;
-        show)
-            if [[ -f "$config_file" ]]; then
-                cat "$config_file"
-            else
-                echo "No config file found: $config_file"
-            fi
-            ;;
-        path)
-            echo "$config_file"
-            ;;
-        help|*)
-            cat << 'EOF'
-Usage: dcx config <command> [options]
+#-------------------------------------------------------------------------------
+# config_merge - Overlay one config file on another
+#-------------------------------------------------------------------------------
+# Usage: config_merge base.yaml overlay.yaml > merged.yaml
+#        config_merge base.yaml overlay.yaml -o base.yaml --list merge-by-key
+# Extra options (-o, --list, --key) are passed to yaml-merge.
+#-------------------------------------------------------------------------------
+config_merge() {
+    local base="$1"
+    local overlay="$2"
 
-Commands:
-  get <key> [default]   Get config value
-  set <key> <value>     Set config value
-  show                  Show config file
-  path                  Show config file path
-  help                  Show this help
+    "$DCX_GO" config yaml-merge "$base" "$overlay" "${@:3}"
+}
 
-Examples:
-  dcx config get log.level info
-  dcx config set parallel.max_jobs 8
-  dcx config show
-EOF
-            ;;
-    esac
+#-------------------------------------------------------------------------------
+# dc_config_cmd - CLI command handler for 'dcx config'
+#-------------------------------------------------------------------------------
+# Usage: dc_config_cmd set log.level debug --local
+# Every subcommand (get, set, unset, list, edit, path, ...) is implemented
+# by the Go binary; see 'dcx config help'.
+#-------------------------------------------------------------------------------
+dc_config_cmd() {
+    "$DCX_GO" config "$@"
 }
@@ -2,10 +2,12 @@
 #===============================================================================
 # dcx/lib/cred.sh - Encrypted Credential Storage
 #===============================================================================
-# Secure credential management using AES-256-GCM encryption
+# Secure credential management via the Go binary (dcx cred), which keeps
+# the store encrypted with AES-256-GCM
 # - Master password unlocks all credentials
 # - Recovery key for password reset
 # - Key format: service/environment/name (e.g., oracle/prod/password)
+# Requires: core.sh (for DCX_GO binary)
 #===============================================================================
 
 # Prevent double sourcing
@@ -17,127 +19,28 @@ declare -r _DCX_CRED_LOADED=1
 #===============================================================================
 
 # Credentials file location (can be overridden)
-CRED_FILE="${DCX_HOME:-$HOME/.local/share/dcx}/etc/credentials.enc"
-CRED_VERSION="1.0"
+CRED_FILE="${DCX_CRED_FILE:-${DCX_HOME:-$HOME/.local/share/dcx}/etc/credentials.enc}"
 
-# Internal state
+# Internal state: the password given to cred_open, passed to each dcx cred
+# call so it is asked for once per shell
 _CRED_UNLOCKED=0
-_CRED_MASTER_KEY=""
-_CRED_SALT=""
+_CRED_PASSWORD=""
 
 #===============================================================================
 # INTERNAL FUNCTIONS
 #===============================================================================
 
-# _cred_init_internal - Initialize credentials file on first use
-# Called automatically by cred_set when credentials.enc doesn't exist
-# Returns: 0 on success, 1 on failure
-_cred_init_internal() {
-    local cred_dir
-    cred_dir="$(dirname "$CRED_FILE")"
-
-    # Create directory if needed
-    mkdir -p "$cred_dir"
-
-    echo ""
-    echo "==================================================================="
-    echo "  CREDENTIAL STORAGE INITIALIZATION"
-    echo "==================================================================="
-    echo ""
-
-    # Prompt for master password (twice for confirmation)
-    local password password2
-    _cred_prompt_password "password" "Create master password"
-    _cred_prompt_password "password2" "Confirm master password"
-
-    if [[ "$password" != "$password2" ]]; then
-        echo "[ERROR] Passwords do not match" >&2
-        return 1
-    fi
-
-    if [[ ${#password} -lt 8 ]]; then
-        echo "[ERROR] Password must be at least 8 characters" >&2
-        return 1
+# _cred_go - Run a dcx cred command on CRED_FILE
+# Usage: _cred_go get "service/env/name"
+_cred_go() {
+    if [[ $_CRED_UNLOCKED -eq 1 && -n "$_CRED_PASSWORD" ]]; then
+        DCX_CRED_FILE="$CRED_FILE" DCX_KEYRING_PASSWORD="$_CRED_PASSWORD" "$DCX_GO" cred "$@"
+    else
+        DCX_CRED_FILE="$CRED_FILE" "$DCX_GO" cred "$@"
     fi
-
-    # Generate random salt (16 bytes)
-    local salt
-    salt=$(openssl rand -hex 16)
-
-    # Generate recovery key (32 bytes base64)
-    local recovery_key
-    recovery_key=$(openssl rand -base64 32)
-
-    # Hash recovery key for storage
-    local recovery_hash
-    recovery_hash=$(echo -n "$recovery_key" | openssl dgst -sha256 -binary | openssl base64)
-
-    # Display recovery key (ONCE)
-    echo ""
-    echo "╔═════════════════════════════════════════════════════════════════╗"
-    echo "║                        RECOVERY KEY                             ║"
-    echo "╠═════════════════════════════════════════════════════════════════╣"
-    echo "║                                                                 ║"
-    echo "║  $recovery_key  ║"
-    echo "║                                                                 ║"
-    echo "║  SAVE THIS KEY SECURELY - IT CANNOT BE RECOVERED               ║"
-    echo "║  Use it to reset your master password if forgotten             ║"
-    echo "║                                                                 ║"
-    echo "╚═════════════════════════════════════════════════════════════════╝"
-    echo ""
-
-    # Wait for user confirmation
-    local confirmation
-    while true; do
-        echo -n "Type 'saved' to confirm you have saved the recovery key: "
-        read -r confirmation
-        if [[ "$confirmation" == "saved" ]]; then
-            break
-        fi
-        echo "Please type 'saved' to continue..."
-    done
-
-    # Derive key from password
-    _CRED_MASTER_KEY=$(_cred_derive_key "$password" "$salt")
-    _CRED_SALT="$salt"
-
-    # Create metadata header
-    local created
-    created=$(date -u +"%Y-%m-%dT%H:%M:%SZ")
-
-    local header
-    header="VERSION:$CRED_VERSION
-CREATED:$created
-SALT:$salt
-RECOVERY_HASH:$recovery_hash
-RECOVERY_SHOWN:1
----"
-
-    # Write header to file
-    echo "$header" > "$CRED_FILE"
-    chmod 600 "$CRED_FILE"
-
-    _CRED_UNLOCKED=1
-
-    echo ""
-    echo "[INFO] Credential storage initialized: $CRED_FILE"
-    echo ""
-
-    return 0
-}
-
-# _cred_derive_key - Derive encryption key from password using PBKDF2
-# Usage: _cred_derive_key "password" "salt"
-# Returns: Base64 encoded key (32 bytes)
-_cred_derive_key() {
-    local password="$1"
-    local salt="$2"
-
-    # Use OpenSSL PBKDF2 with 100k iterations
-    echo -n "$password" | openssl enc -pbkdf2 -pass stdin -S "$salt" -iter 100000 -md sha256 -P 2>/dev/null | grep "key=" | cut -d= -f2
 }
 
-# _cred_prompt_password - Secure password prompt with retry logic
+# _cred_prompt_password - Secure password prompt
 # Usage: _cred_prompt_password "varname" "prompt"
 # Sets variable with name $varname
 _cred_prompt_password() {
@@ -152,58 +55,18 @@ _cred_prompt_password() {
     printf -v "$varname" '%s' "${!varname}"
 }
 
-# _cred_read_header - Read and parse metadata header
-# Returns: 0 on success, sets _CRED_SALT
-_cred_read_header() {
-    if [[ ! -f "$CRED_FILE" ]]; then
-        return 1
-    fi
-
-    # Read header (lines before ---)
-    local header
-    header=$(sed -n '1,/^---$/p' "$CRED_FILE" | grep -v "^---$")
-
-    # Extract salt
-    _CRED_SALT=$(echo "$header" | grep "^SALT:" | cut -d: -f2)
-
-    if [[ -z "$_CRED_SALT" ]]; then
-        echo "[ERROR] Corrupted credentials file: missing salt" >&2
-        return 1
-    fi
-
-    return 0
-}
-
-# _cred_encrypt_value - Encrypt a value with AES-256-CBC
-# Usage: _cred_encrypt_value "value"
-# Returns: base64 encoded encrypted value
-_cred_encrypt_value() {
-    local value="$1"
-
-    # Encrypt with AES-256-CBC using PBKDF2
-    echo -n "$value" | openssl enc -aes-256-cbc -pbkdf2 -iter 100000 -salt -base64 -pass "pass:${_CRED_MASTER_KEY}" 2>/dev/null
-}
-
-# _cred_decrypt_value - Decrypt a value
-# Usage: _cred_decrypt_value "encrypted_base64"
-# Returns: Decrypted value
-_cred_decrypt_value() {
-    local encrypted="$1"
-
-    # Decrypt with AES-256-CBC using PBKDF2
-    echo "$encrypted" | openssl enc -aes-256-cbc -pbkdf2 -iter 100000 -d -base64 -pass "pass:${_CRED_MASTER_KEY}" 2>/dev/null
-}
-
 #===============================================================================
 # PUBLIC FUNCTIONS
 #===============================================================================
 
 # cred_open - Unlock credentials with master password
 # Usage: cred_open [password]
-# If password not provided, prompts user
-# Returns: 0 on success, 1 on failure
+# Checks the password (argument, DCX_KEYRING_PASSWORD or a prompt) against
+# the store, so a wrong one fails here and not on first use. A prompt
+# allows 3 attempts, waiting longer after each wrong password.
+# Returns: 0 on success, 1 on failure, 2 while failed unlocks delay tries
 cred_open() {
-    local password="${1:-}"
+    local password="${1:-${DCX_KEYRING_PASSWORD:-}}"
 
     if [[ $_CRED_UNLOCKED -eq 1 ]]; then
         return 0  # Already unlocked
@@ -214,38 +77,34 @@ cred_open() {
         return 1
     fi
 
-    # Read header to get salt
-    if ! _cred_read_header; then
-        return 1
-    fi
-
-    # Check for env var override (for CI/automation)
-    if [[ -n "${DCX_KEYRING_PASSWORD:-}" ]]; then
-        password="$DCX_KEYRING_PASSWORD"
-    fi
-
-    # Prompt for password if not provided
-    local attempt=0
-    while [[ $attempt -lt 3 ]]; do
+    local attempt rc prompted=0
+    for attempt in 1 2 3; do
         if [[ -z "$password" ]]; then
             _cred_prompt_password "password" "Enter master password"
+            prompted=1
         fi
 
-        # Derive key
-        _CRED_MASTER_KEY=$(_cred_derive_key "$password" "$_CRED_SALT")
-
-        # Verify by trying to read first credential
-        # For now, just check if we can derive key (actual validation happens on first decrypt)
-        _CRED_UNLOCKED=1
-        return 0
+        rc=1
+        if [[ -n "$password" ]]; then
+            DCX_CRED_FILE="$CRED_FILE" DCX_KEYRING_PASSWORD="$password" "$DCX_GO" cred verify
+            rc=$?
+        fi
+        if [[ $rc -eq 0 ]]; then
+            _CRED_PASSWORD="$password"
+            _CRED_UNLOCKED=1
+            return 0
+        fi
 
-        # TODO: Add proper password verification
-        # attempt=$((attempt + 1))
-        # password=""  # Clear for retry
+        # Only prompted passwords are retried, and not while locked out
+        if [[ $prompted -eq 0 || $rc -eq 2 ]]; then
+            return "$rc"
+        fi
+        password=""
+        [[ $attempt -lt 3 ]] && sleep "$attempt"
     done
 
     echo "[ERROR] Authentication failed after 3 attempts" >&2
-    exit 1
+    return 1
 }
 
 # cred_set - Store a credential
@@ -254,132 +113,96 @@ cred_open() {
 # Auto-creates credentials file on first use
 # Returns: 0 on success, 1 on failure
 cred_set() {
-    local key="$1"
-    local value="$2"
+    local key="${1:-}"
+    local value="${2:-}"
 
     if [[ -z "$key" || -z "$value" ]]; then
         echo "[ERROR] Usage: cred_set <key> <value>" >&2
         return 1
     fi
 
-    # Validate key format (service/env/name)
-    if [[ ! "$key" =~ ^[a-zA-Z0-9_-]+/[a-zA-Z0-9_-]+/[a-zA-Z0-9_-]+$ ]]; then
-        echo "[ERROR] Invalid key format. Use: service/environment/name" >&2
-        return 1
-    fi
-
-    # Auto-create on first use
-    if [[ ! -f "$CRED_FILE" ]]; then
-        if ! _cred_init_internal; then
-            return 1
-        fi
-    fi
-
-    # Unlock if needed
-    if [[ $_CRED_UNLOCKED -ne 1 ]]; then
-        if ! cred_open; then
-            return 1
-        fi
-    fi
-
-    # Encrypt value
-    local encrypted
-    encrypted=$(_cred_encrypt_value "$value")
-
-    # Remove existing key if present and append new one
-    if grep -q "^${key}:" "$CRED_FILE" 2>/dev/null; then
-        # Create temp file without the old entry
-        grep -v "^${key}:" "$CRED_FILE" > "${CRED_FILE}.tmp"
-        mv "${CRED_FILE}.tmp" "$CRED_FILE"
-    fi
-
-    # Append new credential
-    echo "${key}:${encrypted}" >> "$CRED_FILE"
-
-    echo "[INFO] Credential stored: $key"
-    return 0
+    # On stdin, not in argv where other users could read it; the binary
+    # drops the newline printf adds
+    printf '%s\n' "$value" | _cred_go set "$key" --stdin
 }
 
 # cred_get - Retrieve a credential
 # Usage: cred_get "service/env/name"
 # Returns: Decrypted value via stdout, or 1 if not found
 cred_get() {
-    local key="$1"
+    local key="${1:-}"
 
     if [[ -z "$key" ]]; then
         echo "[ERROR] Usage: cred_get <key>" >&2
         return 1
     fi
 
-    # Unlock if needed
-    if [[ $_CRED_UNLOCKED -ne 1 ]]; then
-        if ! cred_open; then
-            return 1
-        fi
-    fi
-
-    # Find credential
-    local line
-    line=$(grep "^${key}:" "$CRED_FILE" 2>/dev/null)
-
-    if [[ -z "$line" ]]; then
-        echo "[ERROR] Credential not found: $key" >&2
-        return 1
-    fi
-
-    # Extract encrypted value (everything after first colon)
-    local encrypted
-    encrypted=$(echo "$line" | cut -d: -f2-)
-
-    # Decrypt and output
-    _cred_decrypt_value "$encrypted"
+    _cred_go get "$key"
 }
 
 # cred_list - List all credential keys
 # Usage: cred_list
 # Returns: One key per line
 cred_list() {
-    if [[ ! -f "$CRED_FILE" ]]; then
-        echo "[ERROR] Credentials file not found: $CRED_FILE" >&2
-        return 1
-    fi
-
-    # Skip header (before ---) and blank lines
-    sed -n '/^---$/,$ p' "$CRED_FILE" | \
-        tail -n +2 | \
-        grep -v "^$" | \
-        cut -d: -f1 | \
-        sort
+    _cred_go list
 }
 
 # cred_delete - Remove a credential
 # Usage: cred_delete "service/env/name"
 # Returns: 0 on success
 cred_delete() {
-    local key="$1"
+    local key="${1:-}"
 
     if [[ -z "$key" ]]; then
         echo "[ERROR] Usage: cred_delete <key>" >&2
         return 1
     fi
 
-    if [[ ! -f "$CRED_FILE" ]]; then
-        echo "[ERROR] Credentials file not found: $CRED_FILE" >&2
-        return 1
-    fi
+    _cred_go delete "$key" -y
+}
 
-    # Check if key exists
-    if ! grep -q "^${key}:" "$CRED_FILE" 2>/dev/null; then
-        echo "[ERROR] Credential not found: $key" >&2
-        return 1
-    fi
+# cred_passwd - Change the master password
+# Usage: cred_passwd
+# Re-encrypts every credential; the shell has to cred_open again after
+# Returns: 0 on success
+cred_passwd() {
+    _cred_go passwd || return
+    _CRED_UNLOCKED=0
+    _CRED_PASSWORD=""
+}
 
-    # Remove the line (using grep -v for portability)
-    grep -v "^${key}:" "$CRED_FILE" > "${CRED_FILE}.tmp"
-    mv "${CRED_FILE}.tmp" "$CRED_FILE"
+# cred_recover - Reset a forgotten master password with the recovery key
+# Usage: cred_recover
+# Prints a new recovery key, which replaces the old one
+# Returns: 0 on success
+cred_recover() {
+    _cred_go recover || return
+    _CRED_UNLOCKED=0
+    _CRED_PASSWORD=""
+}
 
-    echo "[INFO] Credential deleted: $key"
-    return 0
+# cred_exec - Run a command with credentials in its environment only
+# Usage: cred_exec [--prefix X] [--only K,...] [--map key=VAR] [--files] -- cmd [args]
+# Example: cred_exec --prefix oracle/prod -- impdp system@PROD parfile=imp.par
+# Returns: the command's exit code
+cred_exec() {
+    _cred_go exec "$@"
+}
+
+# cred_unlock - Keep the store unlocked in a background agent
+# Usage: cred_unlock [--ttl 30m]
+# Later dcx cred get/export calls, from any shell, need no password
+# Returns: 0 on success
+cred_unlock() {
+    _cred_go unlock "$@"
+}
+
+# cred_lock - Stop the agent and forget the password given to cred_open
+# Usage: cred_lock
+cred_lock() {
+    _CRED_UNLOCKED=0
+    _CRED_PASSWORD=""
+    _cred_go lock
 }
 
 # cred_migrate - Migrate plain-text credentials to secure storage
@@ -468,7 +291,8 @@ cred_migrate() {
                     found=$((found + 1))
                     echo "Found: Password fields in $config_file"
                     echo "  Note: Manual migration required for YAML files"
-                    echo "  Use: cred_set <key> <password> then remove from YAML"
+                    echo "  Use: cred_set <key> <password> then replace the value"
+                    echo "  with cred://<key> (read with: dcx config get --resolve-secrets)"
                     echo ""
                 fi
             done <<< "$config_files"
@@ -501,55 +325,19 @@ cred_migrate() {
 }
 
 # cred_export - Export credentials as shell environment variables
-# Usage: cred_export [prefix]
-# Outputs: export statements for credentials matching prefix
+# Usage: cred_export [prefix] [--only K,...] [--map key=VAR] [--format F]
+# Outputs: export statements (or --format env|json|dotenv|nul data) for
+# credentials matching prefix
 # Key transformation: oracle/prod/password → ORACLE_PROD_PASSWORD
 # Example: eval "$(cred_export oracle/prod)"
 cred_export() {
-    local prefix="${1:-}"
+    local prefix=""
 
-    # Unlock if needed
-    if [[ $_CRED_UNLOCKED -ne 1 ]]; then
-        if ! cred_open; then
-            return 1
-        fi
+    if [[ -n "${1:-}" && "$1" != -* ]]; then
+        prefix="$1"
+        shift
     fi
-
-    if [[ ! -f "$CRED_FILE" ]]; then
-        echo "[ERROR] Credentials file not found: $CRED_FILE" >&2
-        return 1
-    fi
-
-    # Get list of keys
-    local keys
-    if [[ -n "$prefix" ]]; then
-        keys=$(cred_list | grep "^${prefix}")
-    else
-        keys=$(cred_list)
-    fi
-
-    if [[ -z "$keys" ]]; then
-        echo "[ERROR] No credentials found matching: ${prefix:-*}" >&2
-        return 1
-    fi
-
-    # Export each credential
-    while IFS= read -r key; do
-        # Transform key: oracle/prod/password → ORACLE_PROD_PASSWORD
-        local env_var
-        env_var=$(echo "$key" | tr '/' '_' | tr '[:lower:]' '[:upper:]')
-
-        # Get value
-        local value
-        value=$(cred_get "$key" 2>/dev/null)
-
-        if [[ -n "$value" ]]; then
-            # Output export statement (shell-escaped)
-            printf 'export %s=%q\n' "$env_var" "$value"
-        fi
-    done <<< "$keys"
-
-    return 0
+    _cred_go export ${prefix:+--prefix "$prefix"} "$@"
 }
 
 #===============================================================================
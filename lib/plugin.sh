@@ -155,6 +155,12 @@ dc_load_plugin() {
         export PATH="$plugin_dir/bin:$PATH"
     fi
 
+    # Plugins see the selected config profile (--profile, DCX_PROFILE or .dcx/profile)
+    if [[ -z "${DCX_PROFILE:-}" && -n "${DCX_GO:-}" ]]; then
+        DCX_PROFILE=$("$DCX_GO" config profile 2>/dev/null) || DCX_PROFILE=""
+    fi
+    [[ -n "${DCX_PROFILE:-}" ]] && export DCX_PROFILE
+
     # Source init script if exists
     if [[ -f "$plugin_dir/lib/init.sh" ]]; then
         # shellcheck source=/dev/null
@@ -45,6 +45,8 @@ test_core_functions() {
     run_test "config_set exists" "type config_set &>/dev/null"
     run_test "config_has exists" "type config_has &>/dev/null"
     run_test "config_keys exists" "type config_keys &>/dev/null"
+    run_test "config_delete exists" "type config_delete &>/dev/null"
+    run_test "config_merge exists" "type config_merge &>/dev/null"
 }
 
 test_config_get() {
@@ -63,6 +65,24 @@ test_config_default() {
     run_test "config_get missing file" "[[ \"$result\" == \"fallback\" ]]"
 }
 
+test_config_get_rendering() {
+    printf 'db:\n  host: x\n  port: 1521\nlist:\n  - a b\n  - c\nnothing: null\nempty: ""\n' > "${TMP_DIR}/render.yaml"
+    local f="${TMP_DIR}/render.yaml"
+
+    run_test "config_get map as YAML" "[[ \$(config_get \"$f\" db) == \$'host: x\\nport: 1521' ]]"
+    run_test "config_get list as YAML" "[[ \$(config_get \"$f\" list) == \$'- a b\\n- c' ]]"
+    run_test "config_get --json map" "[[ \$(config_get \"$f\" db --json | tr -d ' \\n') == '{\"host\":\"x\",\"port\":1521}' ]]"
+
+    local items=()
+    mapfile -d '' items < <(config_get "$f" list --raw0)
+    run_test "config_get --raw0 list" "[[ \${#items[@]} -eq 2 && \"\${items[0]}\" == 'a b' ]]"
+
+    run_test "config_get missing key exits 1" "config_get \"$f\" missing; [[ \$? -eq 1 ]]"
+    run_test "config_get null exits 0" "config_get \"$f\" nothing"
+    run_test "config_get empty exits 0" "config_get \"$f\" empty"
+    run_test "config_get --json null" "[[ \$(config_get \"$f\" nothing --json) == null ]]"
+}
+
 test_config_has() {
     run_test "config_has existing" "config_has \"${TMP_DIR}/test.yaml\" \"database.host\""
     run_test "config_has missing" "! config_has \"${TMP_DIR}/test.yaml\" \"missing.key\""
@@ -76,6 +96,239 @@ test_config_set() {
     config_set "${TMP_DIR}/test.yaml" "database.host" "newhost"
     result=$(config_get "${TMP_DIR}/test.yaml" "database.host")
     run_test "config_set update" "[[ \"$result\" == \"newhost\" ]]"
+
+    XDG_CONFIG_HOME="${TMP_DIR}/xdg" dc_config_cmd set log.level debug
+    run_test "dc_config_cmd set uses the global file" "[[ \$(config_get \"${TMP_DIR}/xdg/dcx/config.yaml\" log.level) == debug ]]"
+}
+
+test_config_set_preserves_format() {
+    cat > "${TMP_DIR}/commented.yaml" << 'EOF'
+---
+# Header comment
+zeta: 'quoted'   # keep me
+base: &base
+  host: db.local
+alpha:
+  <<: *base
+---
+second: doc
+EOF
+    config_set "${TMP_DIR}/commented.yaml" "base.host" "db2"
+    config_set "${TMP_DIR}/commented.yaml" "alpha.extra" "yes"
+    local content
+    content=$(cat "${TMP_DIR}/commented.yaml")
+
+    run_test "config_set keeps comments" "[[ \"\$content\" == *'# Header comment'* && \"\$content\" == *'# keep me'* ]]"
+    run_test "config_set keeps key order" "[[ \$(head -3 \"${TMP_DIR}/commented.yaml\" | tail -1) == zeta:* ]]"
+    run_test "config_set keeps quoting" "[[ \"\$content\" == *\"zeta: 'quoted'\"* ]]"
+    run_test "config_set keeps anchors" "[[ \"\$content\" == *'<<: *base'* ]]"
+    run_test "config_set keeps documents" "[[ \"\$content\" == *'second: doc'* ]]"
+    run_test "config_set edits in place" "[[ \"\$content\" == *'host: db2'* ]]"
+    run_test "config_set appends new key" "[[ \$(config_get \"${TMP_DIR}/commented.yaml\" alpha.extra) == yes ]]"
+}
+
+test_config_set_types() {
+    printf 'jobs: 4\nratio: 1.5\nenabled: true\nname: "x"\n' > "${TMP_DIR}/typed.yaml"
+
+    config_set "${TMP_DIR}/typed.yaml" "jobs" "8"
+    run_test "config_set keeps int type" "grep -q '^jobs: 8$' \"${TMP_DIR}/typed.yaml\""
+
+    config_set "${TMP_DIR}/typed.yaml" "name" "42"
+    run_test "config_set keeps string type" "grep -q '^name: \"42\"$' \"${TMP_DIR}/typed.yaml\""
+
+    config_set "${TMP_DIR}/typed.yaml" "enabled" "no"
+    run_test "config_set keeps bool type" "grep -q '^enabled: false$' \"${TMP_DIR}/typed.yaml\""
+
+    config_set "${TMP_DIR}/typed.yaml" "count" "3"
+    run_test "config_set infers new int" "grep -q '^count: 3$' \"${TMP_DIR}/typed.yaml\""
+
+    config_set "${TMP_DIR}/typed.yaml" "jobs" "8" --type string
+    run_test "config_set --type string" "grep -q '^jobs: \"8\"$' \"${TMP_DIR}/typed.yaml\""
+
+    config_set "${TMP_DIR}/typed.yaml" "dirs" '["a","b"]' --type json
+    run_test "config_set --type json list" "[[ \$(config_keys \"${TMP_DIR}/typed.yaml\" .) == *dirs* ]] && grep -q '^  - b$' \"${TMP_DIR}/typed.yaml\""
+
+    run_test "config_set rejects bad int" "! config_set \"${TMP_DIR}/typed.yaml\" jobs abc --type int 2>/dev/null"
+
+    printf 'host: db\nport: 1521\n' | "$DCX_GO" config yaml-set "${TMP_DIR}/typed.yaml" "db" --value-file -
+    run_test "yaml-set --value-file stdin" "[[ \$(config_get \"${TMP_DIR}/typed.yaml\" db.port) == 1521 ]]"
+}
+
+test_config_key_paths() {
+    cat > "${TMP_DIR}/paths.yaml" << 'EOF'
+urls:
+  "linux-amd64": https://example.com/linux
+  "1.2.3": release
+dirs:
+  - first
+  - second
+tools:
+  gum:
+    version: 0.14.5
+  yq:
+    version: 4.44.3
+EOF
+    local f="${TMP_DIR}/paths.yaml"
+    run_test "key path index" "[[ \$(config_get \"$f\" 'dirs[0]') == first ]]"
+    run_test "key path negative index" "[[ \$(config_get \"$f\" 'dirs[-1]') == second ]]"
+    run_test "key path quoted segment" "[[ \$(config_get \"$f\" 'urls.\"linux-amd64\"') == https://example.com/linux ]]"
+    run_test "key path bracketed key" "[[ \$(config_get \"$f\" 'urls[\"1.2.3\"]') == release ]]"
+    run_test "key path wildcard" "[[ \$(config_get \"$f\" 'tools.*.version' | wc -l) -eq 2 ]]"
+    run_test "key path wildcard keys" "[[ \$(config_keys \"$f\" 'tools.*' | head -1) == version ]]"
+
+    config_set "$f" 'dirs[+]' third
+    run_test "key path append" "[[ \$(config_get \"$f\" 'dirs[2]') == third ]]"
+    config_set "$f" 'dirs[0]' zero
+    run_test "key path set index" "[[ \$(config_get \"$f\" 'dirs[0]') == zero ]]"
+    run_test "key path set wildcard fails" "! config_set \"$f\" 'tools.*.version' 1 2>/dev/null"
+    run_test "key path invalid fails" "! config_get \"$f\" 'dirs[' 2>/dev/null"
+}
+
+test_config_delete() {
+    printf '# db settings\ndb:\n  # the host\n  host: x\n  port: 1\nlist:\n  - a\n  - b\n' > "${TMP_DIR}/delete.yaml"
+
+    config_delete "${TMP_DIR}/delete.yaml" "db.host"
+    run_test "config_delete removes key" "! config_has \"${TMP_DIR}/delete.yaml\" db.host"
+    run_test "config_delete removes head comment" "! grep -q 'the host' \"${TMP_DIR}/delete.yaml\""
+    run_test "config_delete keeps other comments" "grep -q '# db settings' \"${TMP_DIR}/delete.yaml\""
+
+    config_delete "${TMP_DIR}/delete.yaml" "list[0]"
+    run_test "config_delete list item" "[[ \$(config_get \"${TMP_DIR}/delete.yaml\" 'list[0]') == b ]]"
+    run_test "config_delete missing key fails" "! config_delete \"${TMP_DIR}/delete.yaml\" nope 2>/dev/null"
+}
+
+test_config_merge() {
+    local merged
+    merged=$(config_merge "${TMP_DIR}/test.yaml" "${TMP_DIR}/overlay.yaml")
+    run_test "config_merge overlay wins" "[[ \$(\"$DCX_GO\" config yaml-get /dev/stdin database.host <<< \"\$merged\") == production.db ]]"
+    run_test "config_merge keeps base keys" "[[ \$(\"$DCX_GO\" config yaml-get /dev/stdin database.name <<< \"\$merged\") == testdb ]]"
+
+    printf 'items:\n  - name: a\n    v: 1\n  - name: b\n    v: 2\n' > "${TMP_DIR}/list-base.yaml"
+    printf 'items:\n  - name: b\n    v: 20\n  - name: c\n    v: 3\n' > "${TMP_DIR}/list-overlay.yaml"
+
+    config_merge "${TMP_DIR}/list-base.yaml" "${TMP_DIR}/list-overlay.yaml" -o "${TMP_DIR}/replace.yaml"
+    run_test "config_merge list replace" "[[ \$(config_keys \"${TMP_DIR}/replace.yaml\" items | wc -l) -eq 2 ]]"
+
+    config_merge "${TMP_DIR}/list-base.yaml" "${TMP_DIR}/list-overlay.yaml" -o "${TMP_DIR}/append.yaml" --list append
+    run_test "config_merge list append" "[[ \$(config_keys \"${TMP_DIR}/append.yaml\" items | wc -l) -eq 4 ]]"
+
+    config_merge "${TMP_DIR}/list-base.yaml" "${TMP_DIR}/list-overlay.yaml" -o "${TMP_DIR}/bykey.yaml" --list merge-by-key
+    run_test "config_merge list merge-by-key" "[[ \$(config_keys \"${TMP_DIR}/bykey.yaml\" items | wc -l) -eq 3 && \$(config_get \"${TMP_DIR}/bykey.yaml\" 'items[1].v') == 20 ]]"
+}
+
+test_config_diff() {
+    local output
+    output=$("$DCX_GO" config yaml-diff "${TMP_DIR}/list-base.yaml" "${TMP_DIR}/bykey.yaml" || true)
+    run_test "yaml-diff changed path" "[[ \"\$output\" == *'~ items[1].v: 2 -> 20'* ]]"
+    run_test "yaml-diff added path" "[[ \"\$output\" == *'+ items[2]:'* ]]"
+    run_test "yaml-diff exit 1 on differences" "! \"$DCX_GO\" config yaml-diff \"${TMP_DIR}/list-base.yaml\" \"${TMP_DIR}/bykey.yaml\""
+    run_test "yaml-diff exit 0 when equal" "\"$DCX_GO\" config yaml-diff \"${TMP_DIR}/list-base.yaml\" \"${TMP_DIR}/list-base.yaml\""
+}
+
+test_config_formats() {
+    printf '{\n  "name": "app",\n  "deps": ["a", "b"]\n}\n' > "${TMP_DIR}/fmt.json"
+    run_test "config_get json" "[[ \$(config_get \"${TMP_DIR}/fmt.json\" 'deps[1]') == b ]]"
+    config_set "${TMP_DIR}/fmt.json" "version" "2"
+    run_test "config_set json stays json" "python3 -c 'import json,sys; assert json.load(open(sys.argv[1]))[\"version\"] == 2' \"${TMP_DIR}/fmt.json\""
+
+    printf '# settings\ntitle = "demo"\n\n[server]\nport = 8080\n' > "${TMP_DIR}/fmt.toml"
+    run_test "config_get toml table" "[[ \$(config_get \"${TMP_DIR}/fmt.toml\" server.port) == 8080 ]]"
+    config_set "${TMP_DIR}/fmt.toml" "server.host" "0.0.0.0"
+    run_test "config_set toml" "grep -q 'host = \"0.0.0.0\"' \"${TMP_DIR}/fmt.toml\""
+
+    printf '# comment\nexport A=1\nB="two words"\n' > "${TMP_DIR}/fmt.env"
+    run_test "config_get dotenv" "[[ \$(config_get \"${TMP_DIR}/fmt.env\" B) == 'two words' ]]"
+    config_set "${TMP_DIR}/fmt.env" "A" "3"
+    run_test "config_set dotenv keeps comments" "grep -q '^# comment' \"${TMP_DIR}/fmt.env\" && grep -q '^export A=3' \"${TMP_DIR}/fmt.env\""
+
+    # nested keys are the flattened variables on every command
+    "$DCX_GO" config yaml-set "${TMP_DIR}/fmt.env" db.user scott
+    run_test "dotenv set db.user writes DB_USER" "grep -qx 'DB_USER=scott' \"${TMP_DIR}/fmt.env\""
+    run_test "dotenv get db.user" "[[ \$(\"$DCX_GO\" config yaml-get \"${TMP_DIR}/fmt.env\" db.user) == scott ]]"
+    run_test "dotenv has db.user" "\"$DCX_GO\" config yaml-has \"${TMP_DIR}/fmt.env\" db.user"
+    "$DCX_GO" config yaml-set "${TMP_DIR}/fmt.env" db.user tiger
+    run_test "dotenv set db.user replaces DB_USER" "[[ \$(grep -c '^DB_USER=' \"${TMP_DIR}/fmt.env\") == 1 && \$(config_get \"${TMP_DIR}/fmt.env\" DB_USER) == tiger ]]"
+    run_test "dotenv delete db.user" "\"$DCX_GO\" config yaml-delete \"${TMP_DIR}/fmt.env\" db.user && ! grep -q DB_USER \"${TMP_DIR}/fmt.env\""
+
+    cp "${TMP_DIR}/fmt.json" "${TMP_DIR}/fmt.conf"
+    run_test "config_get --format" "[[ \$(config_get \"${TMP_DIR}/fmt.conf\" name --format json) == app ]]"
+
+    "$DCX_GO" config convert "${TMP_DIR}/fmt.toml" "${TMP_DIR}/conv.json"
+    "$DCX_GO" config convert "${TMP_DIR}/conv.json" "${TMP_DIR}/conv.yaml"
+    run_test "config convert roundtrip" "\"$DCX_GO\" config yaml-diff \"${TMP_DIR}/fmt.toml\" \"${TMP_DIR}/conv.yaml\""
+}
+
+test_config_interpolation() {
+    cat > "${TMP_DIR}/interp.yaml" << 'EOF'
+paths:
+  prefix: /opt/app
+  bin: ${prefix}/bin
+  data: ${paths.prefix}/data
+jobs: 4
+workers: ${jobs}
+home: ${DCX_TEST_HOME:-$HOME/fallback}
+literal: $${HOME}
+loop_a: ${loop_b}
+loop_b: ${loop_a}
+script: echo ${DCX_TEST_UNDEFINED} ${prefix}
+EOF
+    local f="${TMP_DIR}/interp.yaml"
+    run_test "interpolate sibling key" "[[ \$(config_get \"$f\" paths.bin) == /opt/app/bin ]]"
+    run_test "interpolate absolute key" "[[ \$(config_get \"$f\" paths.data) == /opt/app/data ]]"
+    run_test "interpolate keeps type" "[[ \$(config_get \"$f\" workers --json) == 4 ]]"
+    run_test "interpolate env var" "[[ \$(DCX_TEST_HOME=/h config_get \"$f\" home) == /h ]]"
+    run_test "interpolate default" "[[ \$(config_get \"$f\" home) == \"\$HOME/fallback\" ]]"
+    run_test "interpolate escape" "[[ \$(config_get \"$f\" literal) == '\${HOME}' ]]"
+    run_test "interpolate cycle fails" "! config_get \"$f\" loop_a 2>/dev/null"
+    run_test "--no-interpolate" "[[ \$(config_get \"$f\" paths.bin --no-interpolate) == '\${prefix}/bin' ]]"
+    run_test "undefined reference left as written" "[[ \$(config_get \"$f\" script) == 'echo \${DCX_TEST_UNDEFINED} \${prefix}' ]]"
+    run_test "undefined reference with --strict fails" "config_get \"$f\" script --strict 2>/dev/null; [[ \$? == 2 ]]"
+    run_test "yaml-get with undefined reference exits 0" "\"$DCX_GO\" config yaml-get \"$f\" script >/dev/null"
+}
+
+test_config_secrets() {
+    cat > "${TMP_DIR}/secrets.yaml" << 'EOF'
+db:
+  user: scott
+  password: env://DCX_TEST_SECRET
+  copy: ${db.password}
+  bad: cred://oracle/prod
+EOF
+    local f="${TMP_DIR}/secrets.yaml"
+    run_test "secret ref unresolved by default" "[[ \$(config_get \"$f\" db.password) == env://DCX_TEST_SECRET ]]"
+    run_test "resolve env:// ref" "[[ \$(DCX_TEST_SECRET=pw config_get \"$f\" db.password --resolve-secrets) == pw ]]"
+    run_test "resolve interpolated ref" "[[ \$(DCX_TEST_SECRET=pw config_get \"$f\" db.copy --resolve-secrets) == pw ]]"
+    run_test "unset env:// ref fails" "! config_get \"$f\" db.password --resolve-secrets 2>/dev/null"
+    run_test "invalid cred:// ref fails" "! config_get \"$f\" db.bad --resolve-secrets 2>/dev/null"
+}
+
+test_config_atomic_writes() {
+    local f="${TMP_DIR}/atomic.yaml"
+    printf 'log:\n  level: info\n' > "$f"
+    chmod 600 "$f"
+    config_set "$f" log.level debug --backup
+    run_test "--backup keeps old contents" "grep -x '  level: info' \"$f.bak.1\" >/dev/null"
+    run_test "file mode preserved" "[[ \$(stat -c %a \"$f\") == 600 ]]"
+    run_test "no temp files left" "[[ -z \$(find \"${TMP_DIR}\" -name '.atomic.yaml.tmp*') ]]"
+    run_test "config undo restores backup" "\"\$DCX_GO\" config undo \"$f\" >/dev/null && [[ \$(config_get \"$f\" log.level) == info ]]"
+    run_test "undo consumes the backup" "[[ ! -e \"$f.bak.1\" ]]"
+    run_test "undo without backup fails" "! \"\$DCX_GO\" config undo \"$f\" 2>/dev/null"
+
+    local i
+    for i in $(seq 1 20); do
+        config_set "$f" "parallel.k$i" "$i" &
+    done
+    wait
+    run_test "parallel config_set keeps every key" "[[ \$(config_keys \"$f\" parallel | wc -l) -eq 20 ]]"
+    run_test "no lock files next to the file" "[[ -z \$(find \"${TMP_DIR}\" -name '*.lock') ]]"
+
+    # relative paths lock the same file as the absolute ones (no deadlock)
+    mkdir -p "${TMP_DIR}/rel"
+    printf 'a: 1\nb: 2\n' > "${TMP_DIR}/rel/r.yaml"
+    run_test "yaml-set with a relative path" "(cd \"${TMP_DIR}/rel\" && timeout 10 \"\$DCX_GO\" config yaml-set r.yaml a 3) && [[ \$(config_get \"${TMP_DIR}/rel/r.yaml\" a) == 3 ]]"
+    run_test "yaml-delete with a relative path" "(cd \"${TMP_DIR}/rel\" && timeout 10 \"\$DCX_GO\" config yaml-delete r.yaml b) && ! grep -q '^b:' \"${TMP_DIR}/rel/r.yaml\""
+    run_test "config_set with a relative path" "(cd \"${TMP_DIR}/rel\" && DCX_GO=\"\$DCX_GO\" timeout 10 bash -c 'source \"\$1\" && config_set r.yaml c 4' _ \"${LIB_DIR}/config.sh\") && [[ \$(config_get \"${TMP_DIR}/rel/r.yaml\" c) == 4 ]]"
+    run_test "config set --local without .dcx" "(cd \"${TMP_DIR}/rel\" && timeout 10 \"\$DCX_GO\" config set log.level debug --local) && grep -q 'level: debug' \"${TMP_DIR}/rel/.dcx/config.yaml\""
 }
 
 test_config_keys() {
@@ -91,8 +344,19 @@ describe "Module Loading" test_module_loading
 describe "Core Functions" test_core_functions
 describe "Config Get" test_config_get
 describe "Config Default Values" test_config_default
+describe "Config Get Rendering" test_config_get_rendering
 describe "Config Has" test_config_has
 describe "Config Set" test_config_set
+describe "Config Set Formatting" test_config_set_preserves_format
+describe "Config Set Types" test_config_set_types
+describe "Config Key Paths" test_config_key_paths
+describe "Config Delete" test_config_delete
+describe "Config Merge" test_config_merge
+describe "Config Diff" test_config_diff
+describe "Config File Formats" test_config_formats
+describe "Config Interpolation" test_config_interpolation
+describe "Config Secret References" test_config_secrets
+describe "Config Atomic Writes" test_config_atomic_writes
 describe "Config Keys" test_config_keys
 
 test_summary
@@ -41,6 +41,7 @@ create_test_cred_file() {
 	local recovery_key recovery_hash
 	recovery_key=$(openssl rand -base64 32)
 	recovery_hash=$(echo -n "$recovery_key" | openssl dgst -sha256 -binary | openssl base64)
+	TEST_RECOVERY_KEY="$recovery_key"
 
 	# Create header
 	local created
@@ -209,6 +210,10 @@ test_delete() {
 
 	# Test deleting non-existent key
 	run_test "delete non-existent fails" "! cred_delete 'nonexistent/key/name' 2>/dev/null"
+
+	# Deleting does not need the master password
+	run_test "delete without password" "env -u DCX_KEYRING_PASSWORD \"\$DCX_GO\" cred delete mysql/dev/password -y </dev/null >/dev/null 2>&1"
+	run_test "deleted without password" "! cred_get 'mysql/dev/password' 2>/dev/null"
 }
 
 test_password_handling() {
@@ -237,6 +242,42 @@ test_password_handling() {
 	export DCX_KEYRING_PASSWORD="$TEST_PASSWORD"
 }
 
+test_password_verification() {
+	clean_test_cred
+	create_test_cred_file
+	cred_set 'oracle/prod/password' 'secret1' &>/dev/null
+
+	run_test "store has a verifier" "grep '^VERIFIER:' \"$CRED_FILE\" >/dev/null"
+	run_test "verify accepts the password" "\"\$DCX_GO\" cred verify"
+	run_test "verify rejects a wrong password" "! DCX_KEYRING_PASSWORD=wrongpass1 \"\$DCX_GO\" cred verify 2>/dev/null"
+	run_test "get fails at once on a wrong password" "[[ \$(DCX_KEYRING_PASSWORD=wrongpass1 \"\$DCX_GO\" cred get oracle/prod/password 2>&1) == *'wrong master password'* ]]"
+
+	_CRED_UNLOCKED=0
+	run_test "cred_open rejects a wrong password" "! cred_open wrongpass1 2>/dev/null"
+	run_test "still locked after a wrong password" "[[ \$_CRED_UNLOCKED -eq 0 ]]"
+	run_test "cred_open accepts the password" "cred_open '$TEST_PASSWORD'"
+
+	# Persistent failure counter (cred.lockout)
+	local xdg="${TEST_CRED_DIR}/xdg"
+	mkdir -p "$xdg/dcx"
+	printf 'cred:\n  lockout: true\n  lockout_delay: 60\n' >"$xdg/dcx/config.yaml"
+	local i
+	for i in 1 2 3; do
+		XDG_CONFIG_HOME="$xdg" DCX_KEYRING_PASSWORD=wrongpass1 "$DCX_GO" cred verify &>/dev/null
+	done
+	run_test "failures are counted" "[[ \$(cut -d' ' -f1 \"$CRED_FILE.failures\") == 3 ]]"
+	local rc=0
+	XDG_CONFIG_HOME="$xdg" "$DCX_GO" cred verify &>/dev/null || rc=$?
+	run_test "lockout delays a correct password" "[[ $rc -eq 2 ]]"
+	run_test "lockout message" "[[ \$(XDG_CONFIG_HOME=\"$xdg\" \"\$DCX_GO\" cred verify 2>&1) == *'try again in'* ]]"
+
+	printf 'cred:\n  lockout: true\n  lockout_delay: 0\n' >"$xdg/dcx/config.yaml"
+	run_test "unlock after the delay" "XDG_CONFIG_HOME=\"$xdg\" \"\$DCX_GO\" cred verify"
+	run_test "success clears the counter" "[[ ! -e \"$CRED_FILE.failures\" ]]"
+	run_test "no counter without cred.lockout" "! DCX_KEYRING_PASSWORD=wrongpass1 \"\$DCX_GO\" cred verify 2>/dev/null && [[ ! -e \"$CRED_FILE.failures\" ]]"
+	rm -rf "$xdg"
+}
+
 test_encryption_roundtrip() {
 	create_test_cred_file
 	cred_open &>/dev/null
@@ -354,18 +395,23 @@ test_export() {
 }
 
 test_security_injection() {
-	init_test_cred
+	clean_test_cred
+	create_test_cred_file
+	local marker="${TEST_CRED_DIR}/pwned"
+	rm -f "$marker"
 
 	run_test "injection: command substitution escaped" "
-        cred_set 'oracle/test/malicious' '\$(rm -rf /tmp/test)' 2>/dev/null
+        cred_set 'oracle/test/malicious' '\$(touch $marker)' 2>/dev/null
         output=\$(cred_export oracle/test 2>/dev/null)
-        [[ \"\$output\" == *'\\$'* ]]
+        eval \"\$output\" 2>/dev/null
+        [[ \"\${ORACLE_TEST_MALICIOUS}\" == '\$(touch $marker)' && ! -e '$marker' ]]
     "
 
 	run_test "injection: backticks escaped" "
-        cred_set 'oracle/test/backtick' '\`whoami\`' 2>/dev/null
+        cred_set 'oracle/test/backtick' '\`touch $marker\`' 2>/dev/null
         output=\$(cred_export oracle/test 2>/dev/null)
-        [[ \"\$output\" == *'\\'* ]]
+        eval \"\$output\" 2>/dev/null
+        [[ \"\${ORACLE_TEST_BACKTICK}\" == '\`touch $marker\`' && ! -e '$marker' ]]
     "
 
 	run_test "injection: semicolon safe" "
@@ -385,6 +431,270 @@ test_security_injection() {
 	clean_test_cred
 }
 
+test_format_migration() {
+	clean_test_cred
+	create_test_cred_file
+
+	# A value as the old cred.sh wrote it (its key derivation printed
+	# nothing, so values were encrypted under an empty passphrase)
+	local legacy
+	legacy=$(printf '%s' 'legacy_secret' | openssl enc -aes-256-cbc -pbkdf2 -iter 100000 -salt -base64 -pass pass: 2>/dev/null)
+	echo "oracle/old/password:${legacy}" >>"$CRED_FILE"
+
+	local retrieved
+	retrieved=$(cred_get 'oracle/old/password' 2>/dev/null)
+	run_test "reads version 1.0 values" "[[ \"$retrieved\" == legacy_secret ]]"
+	run_test "reading does not upgrade" "grep -x 'VERSION:1.0' \"$CRED_FILE\" >/dev/null"
+
+	run_test "migrate-format upgrades" "\"\$DCX_GO\" cred migrate-format >/dev/null"
+	run_test "store is version 2" "grep -x 'VERSION:2' \"$CRED_FILE\" >/dev/null"
+	run_test "no unencrypted backup kept" "! compgen -G \"$CRED_FILE.bak.*\" >/dev/null"
+	run_test "permissions kept at 600" "[[ \$(stat -c %a \"$CRED_FILE\" 2>/dev/null || stat -f %A \"$CRED_FILE\") == \"600\" ]]"
+	retrieved=$(cred_get 'oracle/old/password' 2>/dev/null)
+	run_test "value survives migration" "[[ \"$retrieved\" == legacy_secret ]]"
+	run_test "migrate-format is idempotent" "[[ \$(\"\$DCX_GO\" cred migrate-format) == *'already version 2'* ]]"
+	run_test "wrong password cannot decrypt" "! DCX_KEYRING_PASSWORD=wrongpass123 \"\$DCX_GO\" cred get 'oracle/old/password' 2>/dev/null"
+
+	cred_set 'oracle/new/password' 'plain_marker' &>/dev/null
+	run_test "values are not stored in clear" "! grep plain_marker \"$CRED_FILE\" >/dev/null"
+
+	# a copy made by hand (or by an older dcx) is pointed out
+	clean_test_cred
+	create_test_cred_file
+	echo "oracle/old/password:${legacy}" >>"$CRED_FILE"
+	cp -p "$CRED_FILE" "$CRED_FILE.bak.1"
+	local warning
+	warning=$("$DCX_GO" cred migrate-format 2>&1 >/dev/null)
+	run_test "migrate-format warns about old backups" "[[ '$warning' == *'shred'* ]]"
+	rm -f "$CRED_FILE".bak.*
+}
+
+test_value_sources() {
+	clean_test_cred
+	create_test_cred_file
+
+	printf 'from stdin\n' | "$DCX_GO" cred set app/test/stdin --stdin &>/dev/null
+	run_test "set --stdin" "[[ \$(cred_get app/test/stdin) == 'from stdin' ]]"
+
+	printf 'from file\n' >"$TEST_CRED_DIR/value.txt"
+	"$DCX_GO" cred set app/test/file --from-file "$TEST_CRED_DIR/value.txt" &>/dev/null
+	run_test "set --from-file" "[[ \$(cred_get app/test/file) == 'from file' ]]"
+	rm -f "$TEST_CRED_DIR/value.txt"
+
+	APP_TOKEN='from env' "$DCX_GO" cred set app/test/env --from-env APP_TOKEN &>/dev/null
+	run_test "set --from-env" "[[ \$(cred_get app/test/env) == 'from env' ]]"
+	run_test "unset --from-env variable fails" "! \"\$DCX_GO\" cred set app/test/env --from-env DCX_NO_SUCH_VAR 2>/dev/null"
+
+	# an empty value is refused from every source
+	: >"$TEST_CRED_DIR/empty.txt"
+	run_test "empty --stdin refused" "! printf '\\n' | \"\$DCX_GO\" cred set app/test/empty --stdin 2>/dev/null"
+	run_test "empty --from-file refused" "! \"\$DCX_GO\" cred set app/test/empty --from-file \"$TEST_CRED_DIR/empty.txt\" 2>/dev/null"
+	run_test "empty --from-env refused" "! DCX_EMPTY_VAR= \"\$DCX_GO\" cred set app/test/empty --from-env DCX_EMPTY_VAR 2>/dev/null"
+	run_test "empty argument refused" "! \"\$DCX_GO\" cred set app/test/empty '' 2>/dev/null"
+	run_test "nothing stored for empty values" "! cred_get app/test/empty 2>/dev/null"
+	rm -f "$TEST_CRED_DIR/empty.txt"
+
+	local out
+	out=$("$DCX_GO" cred set app/test/gen --generate --length 40 --charset hex 2>&1)
+	run_test "generate does not print the secret" "[[ '$out' == *'40-character'* && '$out' != *\$(cred_get app/test/gen)* ]]"
+	run_test "generate length and charset" "[[ \$(cred_get app/test/gen) =~ ^[0-9a-f]{40}\$ ]]"
+	run_test "generate default length" "\"\$DCX_GO\" cred set app/test/gen2 --generate &>/dev/null && [[ \$(cred_get app/test/gen2 | wc -c) -eq 32 ]]"
+
+	run_test "conflicting sources fail" "! echo x | \"\$DCX_GO\" cred set app/test/x value --stdin 2>/dev/null"
+	run_test "--length needs --generate" "! echo x | \"\$DCX_GO\" cred set app/test/x --stdin --length 8 2>/dev/null"
+	run_test "no value and no terminal fails" "! setsid \"\$DCX_GO\" cred set app/test/x </dev/null 2>/dev/null"
+	run_test "positional value warns" "[[ \$(\"\$DCX_GO\" cred set app/test/pos value 2>&1) == *'Warning'* ]]"
+
+	cred_set app/test/lines $'two\nlines\n' &>/dev/null
+	run_test "cred_set keeps trailing newlines" "[[ \"\$(cred_get app/test/lines; echo .)\" == \$'two\\nlines\\n.' ]]"
+}
+
+# recovery_key_of - The recovery key in the output of a command that shows one
+recovery_key_of() {
+	awk '/RECOVERY KEY/ { getline; getline; print $1; exit }' <<<"$1"
+}
+
+test_passwd_and_recover() {
+	clean_test_cred
+	local out rk rk2 newpass='newpass1234'
+	out=$(echo 'value1' | setsid "$DCX_GO" cred set app/prod/one --stdin 2>&1)
+	rk=$(recovery_key_of "$out")
+	run_test "new store shows a recovery key" "[[ -n '$rk' ]]"
+	run_test "new store has recovery data" "grep '^RECOVERY_WRAP:' \"$CRED_FILE\" >/dev/null"
+	cred_set app/prod/two 'value2' &>/dev/null
+
+	# passwd
+	local salt
+	salt=$(grep '^SALT:' "$CRED_FILE")
+	run_test "passwd changes the password" "DCX_KEYRING_NEW_PASSWORD=$newpass \"\$DCX_GO\" cred passwd >/dev/null"
+	run_test "passwd uses a new salt" "! grep -x '$salt' \"$CRED_FILE\" >/dev/null"
+	run_test "old password is rejected" "! \"\$DCX_GO\" cred verify 2>/dev/null"
+	run_test "values read with the new password" "[[ \$(DCX_KEYRING_PASSWORD=$newpass \"\$DCX_GO\" cred get app/prod/two) == value2 ]]"
+	run_test "passwd keeps permissions at 600" "[[ \$(stat -c %a \"$CRED_FILE\" 2>/dev/null || stat -f %A \"$CRED_FILE\") == \"600\" ]]"
+	run_test "passwd rejects a short password" "! DCX_KEYRING_PASSWORD=$newpass DCX_KEYRING_NEW_PASSWORD=short \"\$DCX_GO\" cred passwd 2>/dev/null"
+	local sum
+	sum=$(cksum <"$CRED_FILE")
+	DCX_KEYRING_PASSWORD=wrongpass1 DCX_KEYRING_NEW_PASSWORD=otherpass1 "$DCX_GO" cred passwd &>/dev/null
+	run_test "passwd needs the current password" "[[ \$(cksum <\"$CRED_FILE\") == '$sum' ]]"
+
+	# recover
+	run_test "wrong recovery key fails" "! DCX_RECOVERY_KEY=bm90LXRoZS1rZXk= DCX_KEYRING_NEW_PASSWORD=otherpass1 \"\$DCX_GO\" cred recover 2>/dev/null"
+	out=$(DCX_RECOVERY_KEY="$rk" DCX_KEYRING_NEW_PASSWORD="$TEST_PASSWORD" setsid "$DCX_GO" cred recover 2>&1)
+	rk2=$(recovery_key_of "$out")
+	run_test "recovery key survives passwd" "[[ '$out' == *'password reset'* ]]"
+	run_test "recover issues a new recovery key" "[[ -n '$rk2' && '$rk2' != '$rk' ]]"
+	run_test "values read after recover" "[[ \$(cred_get app/prod/one) == value1 ]]"
+	run_test "used recovery key stops working" "! DCX_RECOVERY_KEY='$rk' DCX_KEYRING_NEW_PASSWORD=otherpass1 \"\$DCX_GO\" cred recover 2>/dev/null"
+
+	# stores without recovery data
+	sed -i.orig '/^RECOVERY_PUBLIC:/d; /^RECOVERY_WRAP:/d' "$CRED_FILE" && rm -f "$CRED_FILE.orig"
+	run_test "old recovery key cannot unlock" "[[ \$(DCX_RECOVERY_KEY='$rk2' DCX_KEYRING_NEW_PASSWORD=otherpass1 \"\$DCX_GO\" cred recover 2>&1) == *'predates'* ]]"
+	out=$(DCX_KEYRING_NEW_PASSWORD="$TEST_PASSWORD" setsid "$DCX_GO" cred passwd 2>&1)
+	rk=$(recovery_key_of "$out")
+	run_test "passwd issues a usable recovery key" "[[ -n '$rk' ]] && DCX_RECOVERY_KEY='$rk' DCX_KEYRING_NEW_PASSWORD='$TEST_PASSWORD' setsid \"\$DCX_GO\" cred recover &>/dev/null"
+
+	# version 1.0 stores
+	clean_test_cred
+	create_test_cred_file
+	local legacy
+	legacy=$(printf '%s' 'legacy_secret' | openssl enc -aes-256-cbc -pbkdf2 -iter 100000 -salt -base64 -pass pass: 2>/dev/null)
+	echo "oracle/old/password:${legacy}" >>"$CRED_FILE"
+	run_test "recover a version 1.0 store" "DCX_RECOVERY_KEY='$TEST_RECOVERY_KEY' DCX_KEYRING_NEW_PASSWORD='$TEST_PASSWORD' setsid \"\$DCX_GO\" cred recover &>/dev/null"
+	run_test "version 1.0 value survives recover" "[[ \$(cred_get oracle/old/password) == legacy_secret ]] && grep -x 'VERSION:2' \"$CRED_FILE\" >/dev/null"
+	rm -f "$CRED_FILE".bak.*
+}
+
+test_agent() {
+	clean_test_cred
+	cred_set app/prod/one 'value1' &>/dev/null
+	local DCX_CRED_AGENT_SOCK="${TEST_CRED_DIR}/agent/agent.sock"
+	export DCX_CRED_AGENT_SOCK
+
+	run_test "invalid --ttl fails" "! \"\$DCX_GO\" cred unlock --ttl soon 2>/dev/null"
+	run_test "unlock starts the agent" "\"\$DCX_GO\" cred unlock --ttl 1m >/dev/null && [[ -S \"$DCX_CRED_AGENT_SOCK\" ]]"
+	run_test "socket is 600" "[[ \$(stat -c %a \"$DCX_CRED_AGENT_SOCK\" 2>/dev/null || stat -f %A \"$DCX_CRED_AGENT_SOCK\") == \"600\" ]]"
+	run_test "socket directory is 700" "[[ \$(stat -c %a \"${DCX_CRED_AGENT_SOCK%/*}\" 2>/dev/null || stat -f %A \"${DCX_CRED_AGENT_SOCK%/*}\") == \"700\" ]]"
+	local agent_pid
+	agent_pid=$(pgrep -f "cred agent --socket $DCX_CRED_AGENT_SOCK" | head -1)
+	if [[ -r "/proc/$agent_pid/environ" ]]; then
+		run_test "agent environment has no password" "! tr '\\0' '\\n' <\"/proc/$agent_pid/environ\" | grep -q '^DCX_KEYRING_PASSWORD='"
+	fi
+	run_test "get needs no password" "[[ \$(env -u DCX_KEYRING_PASSWORD setsid \"\$DCX_GO\" cred get app/prod/one </dev/null) == value1 ]]"
+	cred_set app/prod/two 'value2' &>/dev/null
+	run_test "agent sees new values" "[[ \$(env -u DCX_KEYRING_PASSWORD setsid \"\$DCX_GO\" cred get app/prod/two </dev/null) == value2 ]]"
+	run_test "export needs no password" "[[ \$(env -u DCX_KEYRING_PASSWORD setsid \"\$DCX_GO\" cred export --prefix app/prod </dev/null) == *APP_PROD_TWO=* ]]"
+	run_test "missing key fails" "! env -u DCX_KEYRING_PASSWORD \"\$DCX_GO\" cred get app/prod/none 2>/dev/null"
+	cp "$CRED_FILE" "$TEST_CRED_DIR/other.enc"
+	run_test "agent ignores another store" "! env -u DCX_KEYRING_PASSWORD DCX_CRED_FILE=\"$TEST_CRED_DIR/other.enc\" setsid \"\$DCX_GO\" cred get app/prod/one </dev/null 2>/dev/null"
+
+	run_test "lock stops the agent" "[[ \$(\"\$DCX_GO\" cred lock) == *'agent locked'* && ! -e \"$DCX_CRED_AGENT_SOCK\" ]]"
+	run_test "get needs the password again" "! env -u DCX_KEYRING_PASSWORD setsid \"\$DCX_GO\" cred get app/prod/one </dev/null 2>/dev/null"
+	run_test "lock without an agent" "[[ \$(\"\$DCX_GO\" cred lock) == *'No credential agent'* ]]"
+
+	"$DCX_GO" cred unlock --ttl 1s >/dev/null
+	sleep 2
+	run_test "agent exits after the TTL" "[[ ! -e \"$DCX_CRED_AGENT_SOCK\" ]] && ! env -u DCX_KEYRING_PASSWORD setsid \"\$DCX_GO\" cred get app/prod/one </dev/null 2>/dev/null"
+
+	"$DCX_GO" cred unlock --ttl 1m >/dev/null
+	DCX_KEYRING_NEW_PASSWORD=newpass1234 "$DCX_GO" cred passwd &>/dev/null
+	run_test "passwd invalidates the agent" "[[ \$(env -u DCX_KEYRING_PASSWORD setsid \"\$DCX_GO\" cred get app/prod/one </dev/null 2>&1) == *'password has changed'* ]]"
+	"$DCX_GO" cred lock &>/dev/null
+	rm -rf "${TEST_CRED_DIR}/agent" "$TEST_CRED_DIR/other.enc"
+}
+
+test_export_formats() {
+	clean_test_cred
+	cred_set oracle/prod/password "it's secret" &>/dev/null
+	cred_set oracle/prod/username 'prod_user' &>/dev/null
+	cred_set mysql/dev/password 'dev_secret' &>/dev/null
+
+	local out
+	out=$("$DCX_GO" cred export --prefix oracle/prod --format env)
+	run_test "env format is NAME=value" "[[ \"\$(printf '%s' \"$out\" | head -1)\" == \"ORACLE_PROD_PASSWORD=it's secret\" ]]"
+	run_test "--env is --format env" "[[ \$(\"\$DCX_GO\" cred export --prefix oracle/prod --env) == \"\$(\"\$DCX_GO\" cred export --prefix oracle/prod --format=env)\" ]]"
+	run_test "json format" "\"\$DCX_GO\" cred export --prefix oracle/prod --format json | python3 -c 'import json,sys; d=json.load(sys.stdin); assert d[\"ORACLE_PROD_USERNAME\"]==\"prod_user\"'"
+	run_test "dotenv format quotes" "[[ \$(\"\$DCX_GO\" cred export --only oracle/prod/password --format dotenv) == \"ORACLE_PROD_PASSWORD=\\\"it's secret\\\"\" ]]"
+	run_test "nul format" "[[ \$(\"\$DCX_GO\" cred export --prefix oracle --format nul | tr '\\0' '|') == 'ORACLE_PROD_PASSWORD=it'\\''s secret|ORACLE_PROD_USERNAME=prod_user|' ]]"
+	run_test "unknown format fails" "! \"\$DCX_GO\" cred export --format yaml 2>/dev/null"
+
+	out=$("$DCX_GO" cred export --map oracle/prod/password=DB_PASSWORD --only DB_PASSWORD,oracle/prod/username --format env)
+	run_test "--map renames" "[[ \"$out\" == *'DB_PASSWORD=it'* && \"$out\" != *ORACLE_PROD_PASSWORD* ]]"
+	run_test "--only selects" "[[ \"$out\" == *ORACLE_PROD_USERNAME=prod_user* && \"$out\" != *MYSQL* ]]"
+	run_test "--only with a missing key fails" "! \"\$DCX_GO\" cred export --only oracle/prod/none 2>/dev/null"
+	run_test "--map with a missing key fails" "! \"\$DCX_GO\" cred export --map oracle/prod/none=X 2>/dev/null"
+	run_test "--map with a bad name fails" "! \"\$DCX_GO\" cred export --map oracle/prod/password=1BAD 2>/dev/null"
+	run_test "clashing names fail" "! \"\$DCX_GO\" cred export --map oracle/prod/password=X --map oracle/prod/username=X 2>/dev/null"
+
+	# the data-only parsing the plugin contract allows
+	cred_set oracle/prod/token 'dG9rZW4=' &>/dev/null
+	local DB_PASSWORD="" DB_TOKEN="" line key value
+	while IFS= read -r line; do
+		key=${line%%=*} value=${line#*=}
+		case "$key" in
+		DB_PASSWORD) DB_PASSWORD="$value" ;;
+		DB_TOKEN) DB_TOKEN="$value" ;;
+		esac
+	done < <("$DCX_GO" cred export --prefix oracle/prod --map oracle/prod/password=DB_PASSWORD --map oracle/prod/token=DB_TOKEN --format=env)
+	run_test "env format parses without eval" "[[ \"\$DB_PASSWORD\" == \"it's secret\" ]]"
+	run_test "env format keeps a trailing =" "[[ \"\$DB_TOKEN\" == 'dG9rZW4=' ]]"
+	DB_TOKEN=""
+	while IFS= read -r -d '' line; do
+		key=${line%%=*} value=${line#*=}
+		[[ "$key" == DB_TOKEN ]] && DB_TOKEN="$value"
+	done < <("$DCX_GO" cred export --only oracle/prod/token --map oracle/prod/token=DB_TOKEN --format=nul)
+	run_test "nul format parses without eval" "[[ \"\$DB_TOKEN\" == 'dG9rZW4=' ]]"
+	run_test "cred_export passes options" "[[ \$(cred_export oracle/prod --only oracle/prod/username --format env) == ORACLE_PROD_USERNAME=prod_user ]]"
+}
+
+test_exec() {
+	clean_test_cred
+	cred_set oracle/prod/password 'prod_secret' &>/dev/null
+	cred_set oracle/prod/username 'prod_user' &>/dev/null
+	cred_set mysql/dev/password 'dev_secret' &>/dev/null
+
+	run_test "child gets the secrets" "[[ \$(\"\$DCX_GO\" cred exec --prefix oracle/prod -- sh -c 'echo \$ORACLE_PROD_PASSWORD') == prod_secret ]]"
+	run_test "only the selected ones" "[[ -z \$(\"\$DCX_GO\" cred exec --prefix oracle/prod -- sh -c 'echo \${MYSQL_DEV_PASSWORD:-}') ]]"
+	run_test "--map renames" "[[ \$(\"\$DCX_GO\" cred exec --only oracle/prod/password --map oracle/prod/password=DB_PASSWORD -- sh -c 'echo \$DB_PASSWORD') == prod_secret ]]"
+	run_test "master password is hidden" "[[ -z \$(\"\$DCX_GO\" cred exec --prefix oracle -- sh -c 'echo \${DCX_KEYRING_PASSWORD:-}') ]]"
+	run_test "caller's environment untouched" "[[ -z \"\${ORACLE_PROD_PASSWORD:-}\" ]]"
+	local rc=0
+	"$DCX_GO" cred exec --prefix oracle -- sh -c 'exit 7' || rc=$?
+	run_test "exit code propagates" "[[ $rc -eq 7 ]]"
+	rc=0
+	{ "$DCX_GO" cred exec --prefix oracle -- sh -c 'kill -TERM $$' || rc=$?; } 2>/dev/null
+	run_test "signal death propagates" "[[ $rc -eq 143 ]]"
+	rc=0
+	"$DCX_GO" cred exec --prefix oracle -- dcx-no-such-command 2>/dev/null || rc=$?
+	run_test "missing command exits 127" "[[ $rc -eq 127 ]]"
+	run_test "command is required" "! \"\$DCX_GO\" cred exec --prefix oracle 2>/dev/null"
+
+	# --files
+	local out dir
+	out=$("$DCX_GO" cred exec --only oracle/prod/password --files -- sh -c 'cat "$ORACLE_PROD_PASSWORD_FILE"; echo; stat -c %a "$ORACLE_PROD_PASSWORD_FILE" 2>/dev/null || stat -f %A "$ORACLE_PROD_PASSWORD_FILE"; echo "$DCX_CRED_DIR"; echo "${ORACLE_PROD_PASSWORD:-none}"')
+	dir=$(sed -n 3p <<<"$out")
+	run_test "--files writes the secret" "[[ \$(sed -n 1p <<<'$out') == prod_secret ]]"
+	run_test "secret file is 600" "[[ \$(sed -n 2p <<<'$out') == 600 ]]"
+	run_test "no value in the environment" "[[ \$(sed -n 4p <<<'$out') == none ]]"
+	run_test "directory removed on exit" "[[ -n '$dir' && ! -e '$dir' ]]"
+	rc=0
+	"$DCX_GO" cred exec --prefix oracle --files -- sh -c 'echo "$DCX_CRED_DIR" >"$1"; kill -TERM $$' sh "$TEST_CRED_DIR/dir" 2>/dev/null || rc=$?
+	run_test "--files propagates signal death" "[[ $rc -eq 143 ]]"
+	run_test "directory removed after a signal" "[[ ! -e \$(cat \"$TEST_CRED_DIR/dir\") ]]"
+	rm -f "$TEST_CRED_DIR/dir"
+	rc=0
+	"$DCX_GO" cred exec --prefix oracle --files -- sh -c 'kill -INT $$; echo survived' >"$TEST_CRED_DIR/out" || rc=$?
+	run_test "--files child can be interrupted" "[[ $rc -eq 130 && ! -s \"$TEST_CRED_DIR/out\" ]]"
+	rm -f "$TEST_CRED_DIR/out"
+	rc=0
+	"$DCX_GO" cred exec --prefix oracle --files -- sh -c 'sleep 5' &
+	local pid=$!
+	sleep 0.5
+	kill -TERM "$pid"
+	wait "$pid" || rc=$?
+	run_test "--files relays SIGTERM" "[[ $rc -eq 143 ]]"
+	run_test "cred_exec wrapper" "[[ \$(cred_exec --prefix mysql -- sh -c 'echo \$MYSQL_DEV_PASSWORD') == dev_secret ]]"
+}
+
 #===============================================================================
 # Run Tests
 #===============================================================================
@@ -398,10 +708,17 @@ describe "Key Format Validation" test_key_format_validation
 describe "List Credentials" test_list
 describe "Delete Credentials" test_delete
 describe "Password Handling" test_password_handling
+describe "Password Verification" test_password_verification
 describe "Encryption Roundtrip" test_encryption_roundtrip
 describe "Error Handling" test_error_handling
 describe "Migration" test_migration
 describe "Export" test_export
+describe "Export Formats" test_export_formats
+describe "Exec" test_exec
+describe "Format Migration" test_format_migration
+describe "Value Sources" test_value_sources
+describe "Password Change and Recovery" test_passwd_and_recover
+describe "Credential Agent" test_agent
 describe "Security: Injection Resistance" test_security_injection
 
 # Cleanup
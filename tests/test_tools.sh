@@ -52,6 +52,301 @@ test_config_commands() {
     run_test "config get platform" "[[ -n \$($DCX_GO config get platform) ]]"
 }
 
+test_effective_config() {
+    local tmp
+    tmp=$(mktemp -d)
+    mkdir -p "$tmp/xdg/dcx" "$tmp/system" "$tmp/project/.dcx" "$tmp/project/sub"
+    printf 'log:\n  level: warn\n' > "$tmp/system/config.yaml"
+    printf 'log:\n  format: json\nparallel:\n  max_jobs: 6\n' > "$tmp/xdg/dcx/config.yaml"
+    printf 'parallel:\n  max_jobs: 2\n' > "$tmp/project/.dcx/config.yaml"
+
+    cfg() { (cd "$tmp/project/sub" && XDG_CONFIG_HOME="$tmp/xdg" DCX_SYSTEM_CONFIG_DIR="$tmp/system" "$DCX_GO" config "$@"); }
+
+    run_test "config get defaults key" "[[ \$(cfg get update.auto_check) == true ]]"
+    run_test "config get system layer" "[[ \$(cfg get log.level) == warn ]]"
+    run_test "config get global layer" "[[ \$(cfg get log.format) == json ]]"
+    run_test "config get nearest local layer" "[[ \$(cfg get parallel.max_jobs) == 2 ]]"
+    run_test "config get env layer" "[[ \$(DCX_LOG_LEVEL=debug cfg get log.level) == debug ]]"
+    run_test "config get --set wins" "[[ \$(DCX_LOG_LEVEL=debug cfg get log.level --set log.level=error) == error ]]"
+    run_test "config get unknown key fails" "! cfg get no.such.key 2>/dev/null"
+
+    output=$(cfg get parallel.max_jobs --explain 2>&1) || true
+    run_test "config get --explain names layer" "[[ \"\$output\" == *\"local ($tmp/project/.dcx/config.yaml:2)\"* ]]"
+    run_test "config get --explain shows overridden" "[[ \"\$output\" == *\"overrides global\"* ]]"
+
+    run_test "config get interpolates project paths" "[[ \$(HOME=/home/t cfg get paths.share) == /home/t/.local/share/dcx ]]"
+
+    printf 'db:\n  password: env://DCX_TEST_PW\n  admin_password: hunter2\n' >> "$tmp/project/.dcx/config.yaml"
+    run_test "config get --resolve-secrets" "[[ \$(DCX_TEST_PW=s3cr3t cfg get db.password --resolve-secrets) == s3cr3t ]]"
+    output=$(DCX_TEST_PW=s3cr3t cfg get db.password --resolve-secrets --explain 2>&1 >/dev/null) || true
+    run_test "config get --explain redacts secrets" "[[ \"\$output\" != *s3cr3t* ]]"
+    output=$(cfg show 2>&1) || true
+    run_test "config show lists secret refs" "[[ \"\$output\" == *\"db.password = env://DCX_TEST_PW\"* ]]"
+    run_test "config show redacts plain secrets" "[[ \"\$output\" != *hunter2* && \"\$output\" == *\"db.admin_password = ********\"* ]]"
+
+    output=$(cfg effective --explain 2>&1) || true
+    run_test "config effective --explain" "[[ \"\$output\" == *\"log.format = json\"*\"# global\"* ]]"
+
+    unset -f cfg
+    rm -rf "$tmp"
+}
+
+test_config_validate() {
+    local tmp
+    tmp=$(mktemp -d)
+    mkdir -p "$tmp/xdg/dcx/plugins/ora" "$tmp/system"
+    printf 'log:\n  level: verbose\nparallel:\n  max_job: 8\nora:\n  port: x\n' > "$tmp/xdg/dcx/config.yaml"
+    printf 'name: ora\nconfig_schema:\n  type: object\n  properties:\n    port:\n      type: integer\n      description: Listener port.\n' \
+        > "$tmp/xdg/dcx/plugins/ora/plugin.yaml"
+
+    cfg() { (cd "$tmp" && XDG_CONFIG_HOME="$tmp/xdg" DCX_SYSTEM_CONFIG_DIR="$tmp/system" "$DCX_GO" config "$@"); }
+
+    run_test "config validate shipped files" "cfg validate \"\$DCX_HOME/etc/defaults.yaml\" \"\$DCX_HOME/etc/tools.yaml\" \"\$DCX_HOME/etc/project.yaml\" >/dev/null"
+
+    output=$(cfg validate 2>&1) || true
+    run_test "config validate enum" "[[ \"\$output\" == *'config.yaml:2: log.level: \"verbose\" is not one of'* ]]"
+    run_test "config validate unknown key" "[[ \"\$output\" == *'parallel.max_job: unknown key (did you mean max_jobs?)'* ]]"
+    run_test "config validate plugin fragment" "[[ \"\$output\" == *'ora.port: expected integer, got string'* ]]"
+    run_test "config validate exit 1" "! cfg validate >/dev/null 2>&1"
+
+    run_test "config describe" "[[ \$(cfg describe log.level) == *'Allowed:  debug, info, warn, error, fatal'* ]]"
+    run_test "config describe plugin key" "[[ \$(cfg describe ora.port) == *'Listener port.'* ]]"
+    run_test "config describe unknown key fails" "! cfg describe no.such.key 2>/dev/null"
+
+    unset -f cfg
+    rm -rf "$tmp"
+}
+
+test_config_profiles() {
+    local tmp
+    tmp=$(mktemp -d)
+    mkdir -p "$tmp/xdg/dcx" "$tmp/system" "$tmp/project/.dcx" "$tmp/project/sub"
+    printf 'log:\n  level: info\nprofiles:\n  prod:\n    log:\n      level: warn\n  staging:\n    log:\n      level: debug\n' \
+        > "$tmp/xdg/dcx/config.yaml"
+    printf 'parallel:\n  max_jobs: 2\n' > "$tmp/project/.dcx/config.yaml"
+    printf 'parallel:\n  max_jobs: 16\n' > "$tmp/project/.dcx/config.prod.yaml"
+
+    cfg() { (cd "$tmp/project/sub" && XDG_CONFIG_HOME="$tmp/xdg" DCX_SYSTEM_CONFIG_DIR="$tmp/system" "$DCX_GO" "$@"); }
+
+    run_test "no profile by default" "[[ \$(cfg config get log.level) == info ]]"
+    run_test "--profile selects overlay" "[[ \$(cfg config get log.level --profile prod) == warn ]]"
+    run_test "--profile selects sibling file" "[[ \$(cfg config get parallel.max_jobs --profile prod) == 16 ]]"
+    run_test "DCX_PROFILE selects profile" "[[ \$(DCX_PROFILE=staging cfg config get log.level) == debug ]]"
+    run_test "unknown profile fails" "! cfg config get log.level --profile nope 2>/dev/null"
+    run_test "profiles key not in effective config" "! cfg config get profiles 2>/dev/null"
+
+    echo staging > "$tmp/project/.dcx/profile"
+    run_test ".dcx/profile selects profile" "[[ \$(cfg config get log.level) == debug ]]"
+    run_test "--profile beats .dcx/profile" "[[ \$(cfg config get log.level --profile prod) == warn ]]"
+    run_test "config profile prints name" "[[ \$(cfg config profile) == staging ]]"
+    run_test "config show prints profile" "[[ \$(cfg config show) == *\"Profile: staging ($tmp/project/.dcx/profile)\"* ]]"
+    run_test "env exports DCX_PROFILE" "[[ \$(cfg env --shell env) == *DCX_PROFILE=staging* ]]"
+
+    unset -f cfg
+    rm -rf "$tmp"
+}
+
+test_config_scopes() {
+    local tmp
+    tmp=$(mktemp -d)
+    mkdir -p "$tmp/xdg" "$tmp/system" "$tmp/project/.dcx" "$tmp/project/sub"
+    printf 'log:\n  level: warn\n' > "$tmp/system/config.yaml"
+
+    cfg() { (cd "$tmp/project/sub" && XDG_CONFIG_HOME="$tmp/xdg" DCX_SYSTEM_CONFIG_DIR="$tmp/system" "$DCX_GO" config "$@"); }
+
+    cfg set log.format json
+    run_test "set writes the global file" "grep -x '  format: json' \"$tmp/xdg/dcx/config.yaml\" >/dev/null"
+    cfg set log.level debug --local
+    run_test "set --local writes the nearest .dcx" "grep -x '  level: debug' \"$tmp/project/.dcx/config.yaml\" >/dev/null"
+    run_test "get reads the effective config" "[[ \$(cfg get log.level) == debug ]]"
+    run_test "get --system reads one layer" "[[ \$(cfg get log.level --system) == warn ]]"
+    run_test "get --global missing key fails" "! cfg get log.level --global 2>/dev/null"
+    run_test "get default for missing key" "[[ \$(cfg get no.such.key fallback) == fallback ]]"
+    run_test "list shows every value" "[[ \$(cfg list) == *log.level=debug* && \$(cfg list) == *log.format=json* ]]"
+    run_test "list --explain names layer" "[[ \$(cfg list --explain) == *'log.level=debug  # local'* ]]"
+    run_test "list --local shows one file" "[[ \$(cfg list --local) == log.level=debug ]]"
+    run_test "set --profile writes profile file" "cfg set log.level error --local --profile prod && [[ -f \"$tmp/project/.dcx/config.prod.yaml\" ]]"
+    run_test "unset --local" "cfg unset log.level --local && [[ \$(cfg get log.level) == warn ]]"
+    run_test "unset missing key fails" "! cfg unset log.level --local 2>/dev/null"
+    run_test "two scopes fail" "! cfg set a b --local --global 2>/dev/null"
+    run_test "path --local" "[[ \$(cfg path --local) == $tmp/project/.dcx/config.yaml ]]"
+    run_test "edit runs \$EDITOR on the file" "EDITOR='sed -i s/json/text/' cfg edit && [[ \$(cfg get log.format --global) == text ]]"
+    run_test "edit rejects invalid YAML" "! EDITOR='sed -i s/text/[/' cfg edit 2>/dev/null"
+
+    unset -f cfg
+    rm -rf "$tmp"
+}
+
+test_config_bundle() {
+    local tmp
+    tmp=$(mktemp -d)
+    mkdir -p "$tmp/xdg/dcx/plugins/ora" "$tmp/system"
+    printf 'name: ora\nconfig_schema:\n  type: object\n  properties:\n    port:\n      type: integer\nconfig_env:\n  DCX_ORA_CONNECTION:\n    key: ora.connection\n    required: true\n  DCX_ORA_LINK:\n    key: ora.link\n    required_if: ora.mode=network-link\n  DCX_ORA_PORT: ora.port\n  DCX_ORA_PASSWORD: ora.password\n' \
+        > "$tmp/xdg/dcx/plugins/ora/plugin.yaml"
+    printf 'ora:\n  connection: /@PROD\n  port: 1521\n  password: env://DCX_TEST_PW\n' > "$tmp/xdg/dcx/config.yaml"
+
+    cfg() { (cd "$tmp" && XDG_CONFIG_HOME="$tmp/xdg" DCX_SYSTEM_CONFIG_DIR="$tmp/system" DCX_TEST_PW=s3cr3t "$DCX_GO" config "$@"); }
+
+    output=$(cfg bundle --plugin ora 2>/dev/null) || true
+    run_test "bundle maps keys to env vars" "[[ \"\$output\" == *DCX_ORA_CONNECTION=/@PROD* && \"\$output\" == *DCX_ORA_PORT=1521* ]]"
+    run_test "bundle resolves secret refs" "[[ \"\$output\" == *DCX_ORA_PASSWORD=s3cr3t* ]]"
+    output=$(cfg bundle --plugin ora 2>&1 >/dev/null) || true
+    run_test "bundle logs config on stderr" "[[ \"\$output\" == *'DCX_ORA_CONNECTION=/@PROD  # ora.connection, global'* ]]"
+    run_test "bundle log redacts secrets" "[[ \"\$output\" != *s3cr3t* ]]"
+    run_test "bundle json" "[[ \$(cfg bundle --plugin ora --format json -q) == *'\"DCX_ORA_PORT\": \"1521\"'* ]]"
+    run_test "bundle null-delimited" "cfg bundle --plugin ora --format null-delimited -q | grep -zx 'DCX_ORA_CONNECTION=/@PROD' >/dev/null"
+
+    cfg bundle --plugin ora --set ora.connection= -q >/dev/null 2>&1 && status=0 || status=$?
+    run_test "bundle missing required key exits 3" "[[ $status -eq 3 ]]"
+    output=$(cfg bundle --plugin ora --set ora.mode=network-link -q 2>&1 >/dev/null) || true
+    run_test "bundle conditional key" "[[ \"\$output\" == *'DCX_ORA_LINK (ora.link) is required when ora.mode=network-link'* ]]"
+    run_test "bundle validates config_schema" "! cfg bundle --plugin ora --set ora.port=x -q >/dev/null 2>&1"
+    run_test "bundle unknown plugin fails" "! cfg bundle --plugin nope >/dev/null 2>&1"
+
+    unset -f cfg
+    rm -rf "$tmp"
+}
+
+test_binary_registry() {
+    local tmp
+    tmp=$(mktemp -d)
+    mkdir -p "$tmp/dcx/plugins/dcx-test"
+    printf 'name: dcx-test\nversion: 1.0.0\nbinaries:\n  - sqlplus\n  - name: impdp\n    required: true\n' \
+        > "$tmp/dcx/plugins/dcx-test/plugin.yaml"
+
+    names=$(XDG_CONFIG_HOME="$tmp" "$DCX_GO" binary list --names 2>/dev/null) || true
+    run_test "binary list includes registry tools" "[[ \"\$names\" == *yq* ]]"
+    run_test "binary list includes plugin binaries" "[[ \"\$names\" == *sqlplus* && \"\$names\" == *impdp* ]]"
+
+    output=$(XDG_CONFIG_HOME="$tmp" "$DCX_GO" version 2>&1) || true
+    run_test "version lists plugin binaries" "[[ \"\$output\" == *impdp* ]]"
+
+    rm -rf "$tmp"
+}
+
+test_env_command() {
+    output=$("$DCX_GO" env --shell env 2>/dev/null) || true
+    run_test "env prints DCX_HOME" "[[ \"\$output\" == *DCX_HOME=* ]]"
+    run_test "env prints platform" "[[ \"\$output\" == *DCX_PLATFORM=* ]]"
+    run_test "env prints tool variables" "[[ \"\$output\" == *YQ=* ]]"
+    run_test "env format is data-only" "! grep -qv '^[A-Z_][A-Z0-9_]*=' <<< \"\$output\""
+
+    # parsed as printEnvHelp shows: a value ending in '=' stays whole
+    local parsed="" line
+    while IFS= read -r line; do
+        [[ "${line%%=*}" == DCX_HOME ]] && parsed=${line#*=}
+    done < <(DCX_HOME=/tmp/dcx-home= "$DCX_GO" env --shell env 2>/dev/null)
+    run_test "env format keeps a trailing =" "[[ \"\$parsed\" == /tmp/dcx-home= ]]"
+
+    output=$("$DCX_GO" env --shell bash 2>/dev/null) || true
+    run_test "env bash format" "[[ \"\$output\" == *\"export DCX_HOME='\"* ]]"
+
+    output=$("$DCX_GO" env --shell fish 2>/dev/null) || true
+    run_test "env fish format" "[[ \"\$output\" == *\"set -gx DCX_HOME '\"* ]]"
+
+    run_test "env rejects unknown shell" "! $DCX_GO env --shell tcsh"
+}
+
+test_oracle_homes() {
+    local tmp
+    tmp=$(mktemp -d)
+    mkdir -p "$tmp/db19/bin"
+    printf '#!/bin/sh\n' > "$tmp/db19/bin/sqlplus"
+    chmod +x "$tmp/db19/bin/sqlplus"
+    printf '# test oratab\nORCL:%s/db19:Y\n*:%s/agent:N\n' "$tmp" "$tmp" > "$tmp/oratab"
+
+    output=$(DCX_ORATAB="$tmp/oratab" DCX_ORAINST_LOC=/nonexistent "$DCX_GO" oracle homes 2>&1) || true
+    run_test "oracle homes lists SID" "[[ \"\$output\" == *ORCL* ]]"
+
+    output=$(DCX_ORATAB="$tmp/oratab" DCX_ORAINST_LOC=/nonexistent "$DCX_GO" oracle env --sid ORCL --shell env 2>&1) || true
+    run_test "oracle env sets ORACLE_HOME" "[[ \"\$output\" == *\"ORACLE_HOME=$tmp/db19\"* ]]"
+    run_test "oracle env prepends PATH" "[[ \"\$output\" == *\"PATH=$tmp/db19/bin:\"* ]]"
+
+    output=$(DCX_ORATAB="$tmp/oratab" DCX_ORAINST_LOC=/nonexistent "$DCX_GO" binary find sqlplus --sid ORCL 2>&1) || true
+    run_test "binary find --sid uses oratab home" "[[ \"\$output\" == \"$tmp/db19/bin/sqlplus\" ]]"
+
+    # an explicit SID never falls back to another home, DCX_HOME/bin or PATH
+    mkdir -p "$tmp/path"
+    printf '#!/bin/sh\n' > "$tmp/path/rman"
+    chmod +x "$tmp/path/rman"
+    output=$(PATH="$tmp/path:$PATH" DCX_ORATAB="$tmp/oratab" DCX_ORAINST_LOC=/nonexistent "$DCX_GO" binary find rman --sid ORCL 2>&1) && rc=0 || rc=$?
+    run_test "binary find --sid does not fall back to PATH" "[[ $rc -ne 0 && \"\$output\" == *\"rman not found in $tmp/db19/bin\"* ]]"
+    mkdir -p "$tmp/baddir"
+    output=$(DCX_ORATAB="$tmp/baddir" DCX_ORAINST_LOC=/nonexistent "$DCX_GO" binary find sqlplus --sid ORCL 2>&1) && rc=0 || rc=$?
+    run_test "binary find --sid reports unreadable oratab" "[[ $rc -ne 0 && \"\$output\" == *'is a directory'* ]]"
+
+    rm -rf "$tmp"
+}
+
+test_tns() {
+    local tmp listener="" port=1 dead_port=1
+    tmp=$(mktemp -d)
+
+    # A local listener on a free port for the reachability probe, and a
+    # port nothing listens on (bound and closed while the listener holds its
+    # own); without python3 only the closed-port check runs, on port 1
+    if command -v python3 &>/dev/null; then
+        python3 -c "
+import os, socket, sys, time
+s = socket.socket(); s.bind(('127.0.0.1', 0)); s.listen(1)
+d = socket.socket(); d.bind(('127.0.0.1', 0)); dead = d.getsockname()[1]; d.close()
+with open(sys.argv[1] + '.tmp', 'w') as f: f.write('%d %d\\n' % (s.getsockname()[1], dead))
+os.rename(sys.argv[1] + '.tmp', sys.argv[1])
+time.sleep(30)
+" "$tmp/ports" &
+        listener=$!
+        local i
+        for i in $(seq 1 50); do
+            [[ -s "$tmp/ports" ]] && break
+            sleep 0.1
+        done
+        read -r port dead_port < "$tmp/ports"
+    fi
+
+    cat > "$tmp/tnsnames.ora" << EOF
+# test aliases
+PRODDB =
+  (DESCRIPTION =
+    (ADDRESS_LIST =
+      (ADDRESS = (PROTOCOL = TCP)(HOST = db1.example.com)(PORT = 1521))
+    )
+    (CONNECT_DATA = (SERVICE_NAME = prod.example.com))
+  )
+IFILE = local.ora
+EOF
+    cat > "$tmp/local.ora" << EOF
+LOCALDB = (DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=127.0.0.1)(PORT=$port))(CONNECT_DATA=(SERVICE_NAME=local)))
+DEADDB = (DESCRIPTION=(ADDRESS=(PROTOCOL=TCP)(HOST=127.0.0.1)(PORT=$dead_port))(CONNECT_DATA=(SERVICE_NAME=local)))
+EOF
+    cat > "$tmp/sqlnet.ora" <<'EOF'
+NAMES.DIRECTORY_PATH = (TNSNAMES, EZCONNECT)
+SQLNET.AUTHENTICATION_SERVICES = (NTS)
+WALLET_LOCATION = (SOURCE = (METHOD = FILE)(METHOD_DATA = (DIRECTORY = /opt/wallet)))
+SQLNET.WALLET_OVERRIDE = TRUE
+EOF
+
+    output=$(TNS_ADMIN="$tmp" "$DCX_GO" tns list 2>&1) || true
+    run_test "tns list shows alias" "[[ \"\$output\" == *PRODDB* ]]"
+    run_test "tns list follows IFILE" "[[ \"\$output\" == *LOCALDB* ]]"
+
+    output=$(TNS_ADMIN="$tmp" "$DCX_GO" tns resolve proddb --json 2>&1) || true
+    run_test "tns resolve host" "[[ \"\$output\" == *'\"host\": \"db1.example.com\"'* ]]"
+    run_test "tns resolve service" "[[ \"\$output\" == *'\"service_name\": \"prod.example.com\"'* ]]"
+
+    output=$(TNS_ADMIN="$tmp" "$DCX_GO" tns wallet 2>&1) || true
+    run_test "tns wallet from sqlnet.ora" "[[ \"\$output\" == /opt/wallet ]]"
+
+    run_test "tns check fails without listener" "! TNS_ADMIN=\"$tmp\" $DCX_GO tns check DEADDB --timeout 1s"
+
+    if [[ -n "$listener" ]]; then
+        run_test "tns check with local listener" "TNS_ADMIN=\"$tmp\" $DCX_GO tns check LOCALDB --timeout 1s"
+        kill "$listener" 2>/dev/null || true
+        wait "$listener" 2>/dev/null || true
+    fi
+
+    rm -rf "$tmp"
+}
+
 #-------------------------------------------------------------------------------
 # Run Tests
 #-------------------------------------------------------------------------------
@@ -64,5 +359,14 @@ describe "Tools List" test_tools_list
 describe "JSON Output" test_json_output
 describe "Binary Discovery" test_binary_discovery
 describe "Config Commands" test_config_commands
+describe "Effective Config" test_effective_config
+describe "Config Validate" test_config_validate
+describe "Config Profiles" test_config_profiles
+describe "Config Scopes" test_config_scopes
+describe "Config Bundle" test_config_bundle
+describe "Binary Registry" test_binary_registry
+describe "Env Command" test_env_command
+describe "Oracle Homes" test_oracle_homes
+describe "TNS" test_tns
 
 test_summary